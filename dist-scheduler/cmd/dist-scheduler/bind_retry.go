@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/podservice"
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/util"
+	"google.golang.org/grpc/encoding"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// bindRetrier handles a failed bind on the scheduler that won the CollectScore consensus.
+// The framework has already forgotten the assumed pod, so the node is free again in this scheduler's cache,
+// and no other scheduler assumed it. The rest of the tree still believes the decision was made, though,
+// so if the pod is really unbound it is sent back through the leader for another round of scoring.
+type bindRetrier struct {
+	client       kubernetes.Interface
+	schedulerSet *schedulerset.SchedulerSet
+	podQueue     *util.PodQueue
+	podName      string
+	// maxRetries is the number of times a pod is rescored after failed binds. 0 disables
+	maxRetries int
+}
+
+// handleBindFailure verifies the pod at the apiserver and, if it is still unbound, re-triggers scoring
+func (r *bindRetrier) handleBindFailure(pod *v1.Pod) {
+	bindFailureCounter.Inc()
+	if r == nil || r.maxRetries <= 0 {
+		return
+	}
+	// The failure handler runs on the binding goroutine, don't hold it up
+	go r.retry(pod)
+}
+
+// rescore sends a pod back for scoring after DistPermit found its winning node gone. Nothing was bound or assumed,
+// so it is the same as a failed bind, just not counted as one. Returns false, leaving the pod failed, if
+// --bind-failure-retries is 0 or the pod has used up its retries
+func (r *bindRetrier) rescore(pod *v1.Pod) bool {
+	if r == nil || r.maxRetries <= 0 || int(util.ScoringRound(pod)) >= r.maxRetries {
+		return false
+	}
+	go r.retry(pod)
+	return true
+}
+
+func (r *bindRetrier) retry(pod *v1.Pod) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	logger := klog.FromContext(ctx).WithName("BindRetry").WithValues("namespace", pod.Namespace, "pod", pod.Name)
+
+	current, err := r.client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		bindRetryCounter.WithLabelValues("deleted").Inc()
+		return
+	case err != nil:
+		logger.Error(err, "Failed to verify pod after failed bind")
+		bindRetryCounter.WithLabelValues("error").Inc()
+		return
+	case current.Spec.NodeName != "":
+		// The bind landed even though it was reported as failed, e.g. a timeout
+		logger.Info("Pod is bound despite bind failure", "node", current.Spec.NodeName)
+		bindRetryCounter.WithLabelValues("bound").Inc()
+		return
+	}
+
+	retries := int(util.ScoringRound(pod))
+	if retries >= r.maxRetries {
+		logger.Info("Giving up on pod after failed binds", "retries", retries)
+		bindRetryCounter.WithLabelValues("exhausted").Inc()
+		return
+	}
+	current = current.DeepCopy()
+	if current.Annotations == nil {
+		current.Annotations = map[string]string{}
+	}
+	current.Annotations[util.BindRetriesAnnotationKey] = strconv.Itoa(retries + 1)
+
+	leader, ok := r.schedulerSet.GetLeaderMember()
+	if !ok {
+		logger.Error(nil, "No leader to send pod back to after failed bind")
+		bindRetryCounter.WithLabelValues("error").Inc()
+		return
+	}
+	logger.Info("Sending pod back for scoring after failed bind", "retries", retries+1, "leader", leader.PodName)
+	if leader.PodName == r.podName {
+		r.podQueue.Enqueue(current)
+		bindRetryCounter.WithLabelValues("retried").Inc()
+		return
+	}
+	// The leader relays it to the whole tree just like a pod from the webhook
+	rawPod, err := encoding.GetCodec("proto").Marshal(&podservice.NewPodRequest{Pod: current})
+	if err == nil {
+		err = sendPodToEndpoint(ctx, leader, rawPod, util.NewCountDownLatchAbsolute(1, 0), current.Name, "bind-retry", nil)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to send pod back to the leader", "leader", leader.PodName)
+		bindRetryCounter.WithLabelValues("error").Inc()
+		return
+	}
+	bindRetryCounter.WithLabelValues("retried").Inc()
+}
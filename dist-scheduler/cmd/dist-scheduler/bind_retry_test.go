@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBindRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodeName  string
+		retries   string
+		wantQueue bool
+	}{
+		{
+			name:      "unbound pod is rescored",
+			wantQueue: true,
+		},
+		{
+			name:     "bound pod is left alone",
+			nodeName: "node-1",
+		},
+		{
+			name:    "retries exhausted",
+			retries: "2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"},
+				Spec:       v1.PodSpec{NodeName: tt.nodeName},
+			}
+			client := fake.NewSimpleClientset(pod)
+			ss, err := schedulerset.NewSchedulerSet(context.Background(), client, "default", "dist-scheduler-0", 10, false, 0)
+			if err != nil {
+				t.Fatalf("NewSchedulerSet() error = %v", err)
+			}
+			ss.SetMembersForTest([]schedulerset.EndpointItem{{PodName: "dist-scheduler-0", Addresses: []string{"10.0.0.1"}}})
+			ss.SetLeader("dist-scheduler-0")
+			podQueue := util.NewPodQueue(10, 10)
+			r := &bindRetrier{
+				client:       client,
+				schedulerSet: ss,
+				podQueue:     podQueue,
+				podName:      "dist-scheduler-0",
+				maxRetries:   2,
+			}
+
+			// The scheduler's copy of the pod was never bound
+			failed := pod.DeepCopy()
+			failed.Spec.NodeName = ""
+			if tt.retries != "" {
+				failed.Annotations = map[string]string{util.BindRetriesAnnotationKey: tt.retries}
+			}
+			r.retry(failed)
+
+			if got := podQueue.Len() == 1; got != tt.wantQueue {
+				t.Fatalf("pod queued = %v, want %v", got, tt.wantQueue)
+			}
+			if !tt.wantQueue {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			queued, _ := podQueue.Dequeue(ctx)
+			if got := queued.Annotations[util.BindRetriesAnnotationKey]; got != "1" {
+				t.Errorf("%s = %q, want 1", util.BindRetriesAnnotationKey, got)
+			}
+		})
+	}
+}
+
+func TestRescoreDisabledByDefault(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	client := fake.NewSimpleClientset(pod)
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), client, "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{{PodName: "dist-scheduler-0", Addresses: []string{"10.0.0.1"}}})
+	ss.SetLeader("dist-scheduler-0")
+	podQueue := util.NewPodQueue(10, 10)
+	r := &bindRetrier{
+		client:       client,
+		schedulerSet: ss,
+		podQueue:     podQueue,
+		podName:      "dist-scheduler-0",
+		maxRetries:   DefaultBindFailureRetries,
+	}
+
+	// DistPermit counts the pod as failed instead of sent back for scoring
+	if r.rescore(pod) {
+		t.Errorf("rescore() = true with --bind-failure-retries=%d, want false", DefaultBindFailureRetries)
+	}
+
+	// A pod that has used up its retries isn't sent back either
+	r.maxRetries = 1
+	exhausted := pod.DeepCopy()
+	exhausted.Annotations = map[string]string{util.BindRetriesAnnotationKey: "1"}
+	if r.rescore(exhausted) {
+		t.Errorf("rescore() = true with retries exhausted, want false")
+	}
+
+	if !r.rescore(pod) {
+		t.Fatalf("rescore() = false, want true")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if queued, ok := podQueue.Dequeue(ctx); !ok || queued.Name != "pod-1" {
+		t.Errorf("pod was not sent back for scoring")
+	}
+}
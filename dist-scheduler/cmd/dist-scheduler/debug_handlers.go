@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/scoreevaluator"
+	"bchess.org/dist-scheduler/pkg/util"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/server/mux"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	configv1 "k8s.io/kube-scheduler/config/v1"
+	kubeschedulerconfig "k8s.io/kubernetes/pkg/scheduler/apis/config"
+	kubeschedulerscheme "k8s.io/kubernetes/pkg/scheduler/apis/config/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// leaderNodeInformer holds the node labeler's informer while this scheduler is the leader,
+// so that debug endpoints can inspect it without listing nodes from the apiserver.
+var leaderNodeInformer struct {
+	sync.RWMutex
+	informer cache.SharedInformer
+}
+
+func setLeaderNodeInformer(informer cache.SharedInformer) {
+	leaderNodeInformer.Lock()
+	defer leaderNodeInformer.Unlock()
+	leaderNodeInformer.informer = informer
+}
+
+func getLeaderNodeInformer() cache.SharedInformer {
+	leaderNodeInformer.RLock()
+	defer leaderNodeInformer.RUnlock()
+	return leaderNodeInformer.informer
+}
+
+// grpcScoreEvaluator holds the gRPC server's ScoreEvaluator once it is started, which is after the admin
+// endpoints start serving
+var grpcScoreEvaluator struct {
+	sync.RWMutex
+	evaluator *scoreevaluator.ScoreEvaluator
+}
+
+func setGrpcScoreEvaluator(evaluator *scoreevaluator.ScoreEvaluator) {
+	grpcScoreEvaluator.Lock()
+	defer grpcScoreEvaluator.Unlock()
+	grpcScoreEvaluator.evaluator = evaluator
+}
+
+func getGrpcScoreEvaluator() *scoreevaluator.ScoreEvaluator {
+	grpcScoreEvaluator.RLock()
+	defer grpcScoreEvaluator.RUnlock()
+	return grpcScoreEvaluator.evaluator
+}
+
+// effectiveConfig holds the completed configuration once the schedulers have been created,
+// which is after the debug endpoints start serving
+var effectiveConfig struct {
+	sync.RWMutex
+	componentConfig *kubeschedulerconfig.KubeSchedulerConfiguration
+	// distSchedulerFlags maps every flag in the "Dist Scheduler" flag set to its value, defaulted or not
+	distSchedulerFlags map[string]string
+}
+
+// setEffectiveConfig records cfg, with its profiles replaced by the completed ones, and the dist-scheduler flags for /debug/config
+func setEffectiveConfig(cfg *kubeschedulerconfig.KubeSchedulerConfiguration, completedProfiles []kubeschedulerconfig.KubeSchedulerProfile, dsFlags *pflag.FlagSet) {
+	cfg = cfg.DeepCopy()
+	cfg.Profiles = completedProfiles
+	flags := make(map[string]string)
+	dsFlags.VisitAll(func(f *pflag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	effectiveConfig.Lock()
+	defer effectiveConfig.Unlock()
+	effectiveConfig.componentConfig = cfg
+	effectiveConfig.distSchedulerFlags = flags
+}
+
+// encodeEffectiveConfig returns the recorded configuration as YAML, or JSON if asJSON is set.
+// ok is false until setEffectiveConfig has been called.
+func encodeEffectiveConfig(asJSON bool) (out []byte, ok bool, err error) {
+	effectiveConfig.RLock()
+	defer effectiveConfig.RUnlock()
+	if effectiveConfig.componentConfig == nil {
+		return nil, false, nil
+	}
+
+	// The internal config type has no JSON tags, so encode it as the versioned type like --write-config-to does
+	info, found := runtime.SerializerInfoForMediaType(kubeschedulerscheme.Codecs.SupportedMediaTypes(), runtime.ContentTypeJSON)
+	if !found {
+		return nil, true, fmt.Errorf("unable to locate encoder for %s", runtime.ContentTypeJSON)
+	}
+	encoder := kubeschedulerscheme.Codecs.EncoderForVersion(info.Serializer, configv1.SchemeGroupVersion)
+	var componentConfig bytes.Buffer
+	if err := encoder.Encode(effectiveConfig.componentConfig, &componentConfig); err != nil {
+		return nil, true, err
+	}
+
+	out, err = json.MarshalIndent(struct {
+		ComponentConfig    json.RawMessage   `json:"componentConfig"`
+		DistSchedulerFlags map[string]string `json:"distSchedulerFlags"`
+	}{
+		ComponentConfig:    componentConfig.Bytes(),
+		DistSchedulerFlags: effectiveConfig.distSchedulerFlags,
+	}, "", "  ")
+	if err != nil || asJSON {
+		return out, true, err
+	}
+	out, err = yaml.JSONToYAML(out)
+	return out, true, err
+}
+
+func installDebugHandlers(pathRecorderMux *mux.PathRecorderMux, schedulerSet *schedulerset.SchedulerSet) {
+	pathRecorderMux.HandleFunc("/debug/config", func(w http.ResponseWriter, req *http.Request) {
+		asJSON := req.URL.Query().Get("format") == "json"
+		out, ok, err := encodeEffectiveConfig(asJSON)
+		switch {
+		case !ok:
+			http.Error(w, "scheduler is not configured yet", http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "application/yaml")
+		}
+		w.Write(out)
+	})
+	pathRecorderMux.HandleFunc("/debug/node-distribution", func(w http.ResponseWriter, req *http.Request) {
+		nodeInformer := getLeaderNodeInformer()
+		if nodeInformer == nil {
+			http.Error(w, "not the leader", http.StatusServiceUnavailable)
+			return
+		}
+		d := computeNodeDistribution(nodeInformer.GetStore().List(), schedulerSet.GetMembers())
+		w.Header().Set("Content-Type", "text/plain")
+		d.write(w)
+	})
+	pathRecorderMux.HandleFunc("/debug/schedulerset", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(schedulerSet.Snapshot()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// installAdminHandlers adds endpoints to pause and resume pod processing, to change the number
+// of workers processing pods and to change --score-window-per-tier. They rely on the authn/authz filters of the secure serving handler chain.
+func installAdminHandlers(pathRecorderMux *mux.PathRecorderMux, podQueue *util.PodQueue, workerPool *util.WorkerPool) {
+	pathRecorderMux.HandleFunc("/admin/pause", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		podQueue.Pause()
+		klog.Infof("Pod processing paused, queue_len=%d", podQueue.Len())
+		writeAdminStatus(w, podQueue)
+	})
+	pathRecorderMux.HandleFunc("/admin/resume", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		podQueue.Resume()
+		klog.Infof("Pod processing resumed, queue_len=%d", podQueue.Len())
+		writeAdminStatus(w, podQueue)
+	})
+	pathRecorderMux.HandleFunc("/admin/status", func(w http.ResponseWriter, req *http.Request) {
+		writeAdminStatus(w, podQueue)
+	})
+	pathRecorderMux.HandleFunc("/admin/workers", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			n, err := strconv.Atoi(req.URL.Query().Get("count"))
+			if err != nil {
+				http.Error(w, "invalid count", http.StatusBadRequest)
+				return
+			}
+			size, err := workerPool.SetSize(n)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			numSchedulersGauge.Set(float64(size))
+			klog.Infof("Number of workers set to %d", size)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "workers: %d\nactive: %d\n", workerPool.Size(), workerPool.Active())
+	})
+	pathRecorderMux.HandleFunc("/admin/score-window", func(w http.ResponseWriter, req *http.Request) {
+		evaluator := getGrpcScoreEvaluator()
+		if evaluator == nil {
+			http.Error(w, "gRPC server is not started yet", http.StatusServiceUnavailable)
+			return
+		}
+		if req.Method == http.MethodPost {
+			perTier, err := time.ParseDuration(req.URL.Query().Get("per-tier"))
+			if err != nil || perTier <= 0 {
+				http.Error(w, "invalid per-tier, must be a positive duration", http.StatusBadRequest)
+				return
+			}
+			evaluator.SetDelay(perTier)
+			klog.Infof("Score window per tier set to %v", perTier)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "per_tier: %v\n", evaluator.Delay())
+	})
+}
+
+func writeAdminStatus(w http.ResponseWriter, podQueue *util.PodQueue) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "paused: %v\nqueue_len: %d\n", podQueue.Paused(), podQueue.Len())
+}
+
+type nodeDistribution struct {
+	nodeCount      int
+	unlabeledCount int
+	// nodes labeled for a scheduler that is not currently a member
+	unknownCount int
+	perScheduler map[string]int
+	min          int
+	max          int
+	mean         float64
+	stddev       float64
+}
+
+func computeNodeDistribution(nodes []interface{}, members []schedulerset.EndpointItem) *nodeDistribution {
+	d := &nodeDistribution{
+		nodeCount:    len(nodes),
+		perScheduler: make(map[string]int, len(members)),
+	}
+	for _, m := range members {
+		if strings.HasPrefix(m.PodName, schedulerset.RelayPrefix) {
+			continue
+		}
+		d.perScheduler[m.PodName] = 0
+	}
+
+	for _, n := range nodes {
+		group := n.(metav1.Object).GetLabels()[SchedulerGroupLabelKey]
+		if group == "" {
+			d.unlabeledCount++
+			continue
+		}
+		if _, ok := d.perScheduler[group]; !ok {
+			d.unknownCount++
+			continue
+		}
+		d.perScheduler[group]++
+	}
+
+	if len(d.perScheduler) == 0 {
+		return d
+	}
+	d.min = math.MaxInt
+	sum := 0
+	for _, count := range d.perScheduler {
+		d.min = min(d.min, count)
+		d.max = max(d.max, count)
+		sum += count
+	}
+	d.mean = float64(sum) / float64(len(d.perScheduler))
+	variance := 0.0
+	for _, count := range d.perScheduler {
+		variance += (float64(count) - d.mean) * (float64(count) - d.mean)
+	}
+	d.stddev = math.Sqrt(variance / float64(len(d.perScheduler)))
+	return d
+}
+
+func (d *nodeDistribution) write(w io.Writer) {
+	fmt.Fprintf(w, "nodes: %d\n", d.nodeCount)
+	fmt.Fprintf(w, "schedulers: %d\n", len(d.perScheduler))
+	fmt.Fprintf(w, "unlabeled: %d\n", d.unlabeledCount)
+	fmt.Fprintf(w, "unknown_scheduler: %d\n", d.unknownCount)
+	fmt.Fprintf(w, "min: %d\nmax: %d\nmean: %.2f\nstddev: %.2f\n", d.min, d.max, d.mean, d.stddev)
+
+	names := make([]string, 0, len(d.perScheduler))
+	for name := range d.perScheduler {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	fmt.Fprintln(w)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s %d\n", name, d.perScheduler[name])
+	}
+}
@@ -4,19 +4,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"slices"
 	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
 
 	"bchess.org/dist-scheduler/pkg/podservice"
 	"bchess.org/dist-scheduler/pkg/schedulerset"
 	"bchess.org/dist-scheduler/pkg/scoreevaluator"
+	"bchess.org/dist-scheduler/pkg/util"
 	"k8s.io/klog/v2"
 )
 
@@ -88,12 +93,27 @@ func (s *podServiceServer) UnmarshalPodRaw(bytes []byte, v interface{}) error {
 	if err != nil {
 		return err
 	}
-	newPodRequest := v.(*podservice.NewPodRequest)
+	newPodRequest, ok := v.(*podservice.NewPodRequest)
+	if !ok {
+		return fmt.Errorf("UnmarshalPodRaw: unexpected message type %T", v)
+	}
 
 	// TODO: if ds.relayOnly, then we can skip deserializing the pod. ProcessOne() will still want the name though for logging reasons
 	pod := newPodRequest.Pod
+	if pod == nil {
+		return fmt.Errorf("UnmarshalPodRaw: request %d has no pod", newPodRequest.RequestId)
+	}
+	if pod.Name == "" {
+		// An unnamed pod can't be bound
+		name := pod.GenerateName
+		if name == "" {
+			name = "<unnamed>"
+		}
+		return fmt.Errorf("UnmarshalPodRaw: request %d has invalid pod name %q", newPodRequest.RequestId, name)
+	}
 	var logger klog.Logger
-	if pod.Name[len(pod.Name)-1] == '0' && pod.Name[len(pod.Name)-2] == '0' {
+	doLog := util.ShouldSampleLog(pod.Name)
+	if doLog {
 		// logger v2
 		logger = klog.FromContext(ctx).WithValues("namespace", pod.ObjectMeta.Namespace, "pod", pod.ObjectMeta.Name)
 		logger.Info("Received NewPod")
@@ -106,7 +126,7 @@ func (s *podServiceServer) UnmarshalPodRaw(bytes []byte, v interface{}) error {
 		return bytes[5:], nil
 	})
 	duration := time.Since(start)
-	if pod.Name[len(pod.Name)-1] == '0' && pod.Name[len(pod.Name)-2] == '0' {
+	if doLog {
 		logger.Info("Total time", "time_us", duration.Microseconds())
 	}
 
@@ -114,25 +134,113 @@ func (s *podServiceServer) UnmarshalPodRaw(bytes []byte, v interface{}) error {
 }
 
 func (s *podServiceServer) CollectScore(ctx context.Context, score *podservice.SchedulingScore) (*podservice.ScheduleResponse, error) {
-	logger := klog.FromContext(ctx)
-	logger.V(4).Info("CollectScore", "namespace", score.Namespace, "pod", score.PodName, "node", score.NodeName, "score", score.Score)
+	logger := klog.FromContext(ctx).WithValues("namespace", score.Namespace, "pod", score.PodName, "node", score.NodeName, "score", score.Score)
+	v := logger.V(4)
+	if util.ShouldSampleLog(score.PodName) {
+		// Logged by default, like the pod's relay and permit, so it can be followed through every scheduler
+		v = logger.V(0)
+	}
+	v.Info("CollectScore")
 
-	highestScore := s.scoreEvaluator.RecordAndWait(fmt.Sprintf("%s/%s", score.Namespace, score.PodName), scoreevaluator.Score{
-		NodeName: score.NodeName,
-		Score:    int(score.Score),
+	highestScore, runnerUps, err := s.scoreEvaluator.RecordAndWaitRanked(fmt.Sprintf("%s/%s", score.Namespace, score.PodName), scoreevaluator.Score{
+		NodeName:  score.NodeName,
+		Score:     int(score.Score),
+		Weight:    float64(score.Weight),
+		Round:     score.Round,
+		Scheduler: score.Scheduler,
 	})
-	return &podservice.ScheduleResponse{
-		Permit: highestScore.NodeName == score.NodeName,
-	}, nil
+	if errors.Is(err, scoreevaluator.ErrAlreadyDecided) {
+		// A straggler, the winner was decided without this score
+		v.Info("CollectScore after the winner was decided", "winner", highestScore.NodeName, "winning_score", highestScore.Score)
+		return &podservice.ScheduleResponse{
+			Permit:       false,
+			WinningNode:  highestScore.NodeName,
+			WinningScore: int32(highestScore.Score),
+		}, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	response := &podservice.ScheduleResponse{
+		Permit:       highestScore.NodeName == score.NodeName,
+		WinningNode:  highestScore.NodeName,
+		WinningScore: int32(highestScore.Score),
+	}
+	if response.Permit {
+		// Only the winner binds, so only it needs somewhere to fall back to
+		for _, runnerUp := range runnerUps {
+			response.RunnerUpNodes = append(response.RunnerUpNodes, runnerUp.NodeName)
+		}
+	}
+	v.Info("CollectScore decided", "permit", response.Permit, "winner", response.WinningNode, "winning_score", response.WinningScore)
+	return response, nil
+}
+
+// CollectScoreStream answers each request as CollectScore would. Each waits for its own pod's winner, so the
+// answers go back as the winners are decided rather than in order
+func (s *podServiceServer) CollectScoreStream(stream grpc.BidiStreamingServer[podservice.CollectScoreRequest, podservice.CollectScoreResponse]) error {
+	var sendLock sync.Mutex
+	var inFlight sync.WaitGroup
+	// The stream can't be sent on once this returns
+	defer inFlight.Wait()
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		inFlight.Add(1)
+		go func(req *podservice.CollectScoreRequest) {
+			defer inFlight.Done()
+			answer := &podservice.CollectScoreResponse{RequestId: req.RequestId}
+			var err error
+			if req.Score == nil {
+				err = status.Errorf(codes.InvalidArgument, "request %d has no score", req.RequestId)
+			} else {
+				answer.Response, err = s.CollectScore(stream.Context(), req.Score)
+			}
+			if err != nil {
+				st := status.Convert(err)
+				answer.ErrorCode = uint32(st.Code())
+				answer.ErrorMessage = st.Message()
+			}
+			sendLock.Lock()
+			defer sendLock.Unlock()
+			if err := stream.Send(answer); err != nil {
+				klog.V(4).Infof("CollectScoreStream: failed to answer request %d: %v", req.RequestId, err)
+			}
+		}(req)
+	}
+}
+
+// ReportMarker records that a scheduler received a self-test marker pod
+func (s *podServiceServer) ReportMarker(ctx context.Context, report *podservice.MarkerReport) (*podservice.MarkerReportResponse, error) {
+	if selfTestRecorder == nil {
+		return nil, status.Error(codes.FailedPrecondition, "--self-test is not enabled")
+	}
+	selfTestRecorder.Record(report.Marker, report.Scheduler)
+	return &podservice.MarkerReportResponse{}, nil
 }
 
-func StartGrpcServer(ctx context.Context, address string, schedulerSet *schedulerset.SchedulerSet, distScheduler *DistScheduler) {
-	lis, err := net.Listen("tcp", address)
+func StartGrpcServer(ctx context.Context, address string, schedulerSet *schedulerset.SchedulerSet, distScheduler *DistScheduler, scoreWindowPerTier time.Duration, scoreCollectionTimeout time.Duration, maxScoreEvaluators int, minScoreLimit int, decisionLog *scoreevaluator.DecisionLog, validator *scoreevaluator.Validator) {
+	network, listenAddr := util.ListenAddress(address)
+	if network == "unix" {
+		// A socket left behind by a previous run would make Listen fail with "address already in use"
+		if err := os.Remove(listenAddr); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("failed to remove stale socket %s: %v", listenAddr, err)
+		}
+	}
+	lis, err := net.Listen(network, listenAddr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	scoreEvaluator := scoreevaluator.New(5*time.Second, schedulerSet)
+	scoreEvaluator := scoreevaluator.New(scoreWindowPerTier, schedulerSet, maxScoreEvaluators)
+	scoreEvaluator.SetTimeout(scoreCollectionTimeout)
+	scoreEvaluator.SetMinLimit(minScoreLimit)
+	scoreEvaluator.SetDecisionLog(decisionLog)
+	scoreEvaluator.SetValidator(validator)
+	setGrpcScoreEvaluator(scoreEvaluator)
+	go scoreEvaluator.RunJanitor(ctx)
 	podServiceServer := &podServiceServer{
 		scoreEvaluator: scoreEvaluator,
 		distScheduler:  distScheduler,
@@ -145,7 +253,7 @@ func StartGrpcServer(ctx context.Context, address string, schedulerSet *schedule
 	}
 	encoding.RegisterCodec(rawCodec)
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(util.GRPCServerOptions()...)
 	podservice.RegisterPodServiceServer(s, podServiceServer)
 	klog.Infof("gRPC server listening on %s", address)
 
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/distpermit"
+	"bchess.org/dist-scheduler/pkg/podservice"
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/scoreevaluator"
+	"bchess.org/dist-scheduler/pkg/util"
+	"google.golang.org/grpc/encoding"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUnmarshalPodRawInvalid(t *testing.T) {
+	protoCodec := encoding.GetCodec("proto")
+	// distScheduler is nil: every case must be rejected before the pod is processed
+	s := &podServiceServer{protoCodec: protoCodec}
+
+	tests := []struct {
+		name    string
+		request *podservice.NewPodRequest
+		v       interface{}
+		wantErr string
+	}{
+		{
+			name:    "nil pod",
+			request: &podservice.NewPodRequest{RequestId: 7},
+			v:       &podservice.NewPodRequest{},
+			wantErr: "has no pod",
+		},
+		{
+			name: "unnamed pod falls back to generateName",
+			request: &podservice.NewPodRequest{RequestId: 7, Pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "web-"},
+			}},
+			v:       &podservice.NewPodRequest{},
+			wantErr: `"web-"`,
+		},
+		{
+			name:    "wrong message type",
+			request: &podservice.NewPodRequest{RequestId: 7},
+			v:       &podservice.SchedulingScore{},
+			wantErr: "unexpected message type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := protoCodec.Marshal(tt.request)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			err = s.UnmarshalPodRaw(data, tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("UnmarshalPodRaw() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCollectScoreReportsWinner(t *testing.T) {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{
+		{PodName: "dist-scheduler-0", Addresses: []string{"10.0.0.1"}},
+		{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.2"}},
+	})
+	s := &podServiceServer{scoreEvaluator: scoreevaluator.New(5*time.Second, ss, 0)}
+
+	// Both schedulers' scores are needed before either call returns
+	loser := make(chan *podservice.ScheduleResponse, 1)
+	go func() {
+		response, err := s.CollectScore(context.Background(), &podservice.SchedulingScore{PodName: "pod-1", Namespace: "default", NodeName: "node-1", Score: 50})
+		if err != nil {
+			t.Errorf("CollectScore() error = %v", err)
+		}
+		loser <- response
+	}()
+	winner, err := s.CollectScore(context.Background(), &podservice.SchedulingScore{PodName: "pod-1", Namespace: "default", NodeName: "node-2", Score: 80})
+	if err != nil {
+		t.Fatalf("CollectScore() error = %v", err)
+	}
+
+	if !winner.Permit {
+		t.Errorf("winner Permit = false, want true")
+	}
+	response := <-loser
+	if response.Permit {
+		t.Errorf("loser Permit = true, want false")
+	}
+	for _, r := range []*podservice.ScheduleResponse{winner, response} {
+		if r.WinningNode != "node-2" || r.WinningScore != 80 {
+			t.Errorf("CollectScore() winner = %s/%d, want node-2/80", r.WinningNode, r.WinningScore)
+		}
+	}
+	if fmt.Sprint(winner.RunnerUpNodes) != "[node-1]" {
+		t.Errorf("winner RunnerUpNodes = %v, want [node-1]", winner.RunnerUpNodes)
+	}
+	if len(response.RunnerUpNodes) != 0 {
+		t.Errorf("loser RunnerUpNodes = %v, want none", response.RunnerUpNodes)
+	}
+	t.Logf("lost to node %s with score %d", response.WinningNode, response.WinningScore)
+}
+
+func TestGrpcServerUnixSocket(t *testing.T) {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	// A co-located relay reaches its scheduler through the socket rather than a pod IP
+	address := util.UnixScheme + filepath.Join(t.TempDir(), "grpc.sock")
+	ss.SetMembersForTest([]schedulerset.EndpointItem{
+		{PodName: "dist-scheduler-0", Addresses: []string{address}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	StartGrpcServer(ctx, address, ss, nil, 5*time.Second, 0, 0, 0, nil, nil)
+
+	// With a single member its own score decides the pod
+	response, err := distpermit.SendScore(ctx, ss.GetMembers()[0], "pod-1", "default", "node-1", 50, 1, 0, "dist-scheduler-1")
+	if err != nil {
+		t.Fatalf("SendScore() error = %v", err)
+	}
+	if !response.GetPermit() || response.GetWinningNode() != "node-1" {
+		t.Errorf("SendScore() = permit %v, winner %s, want permit true, winner node-1", response.GetPermit(), response.GetWinningNode())
+	}
+}
@@ -5,6 +5,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -15,6 +17,9 @@ import (
 	"time"
 
 	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/util"
+	"bchess.org/dist-scheduler/pkg/webhook"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -22,27 +27,49 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 )
 
+// DefaultElectionID is the name of the leader election Lease unless --election-id is set
+const DefaultElectionID = "dist-scheduler"
+
+// validateElectionID checks that id can be the name of the leader election Lease
+func validateElectionID(id string) error {
+	if errs := validation.IsDNS1123Subdomain(id); len(errs) > 0 {
+		return fmt.Errorf("invalid --election-id %q: %s", id, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
 func StartLeaderActivities(ctx context.Context,
 	podName string,
 	namespace string,
-	podQueue chan *v1.Pod,
+	electionID string,
+	podQueue *util.PodQueue,
 	cs kubernetes.Interface,
 	schedulerSet *schedulerset.SchedulerSet,
 	watchPods bool,
 	nodeSelector string,
+	nodePatchLimiter flowcontrol.RateLimiter,
+	nodeLabelParallelism int,
+	informerResync time.Duration,
+	webhookConfig *admissionregistrationv1.ValidatingWebhookConfiguration,
+	webhookPort int32,
+	minMembers int,
+	minMembersTimeout time.Duration,
 ) {
 	lock, err := resourcelock.New(resourcelock.LeasesResourceLock,
-		namespace,        // Namespace where the lock will live.
-		"dist-scheduler", // Name of the resource lock.
+		namespace,  // Namespace where the lock will live.
+		electionID, // Name of the resource lock.
 		cs.CoreV1(),
 		cs.CoordinationV1(),
 		resourcelock.ResourceLockConfig{
@@ -60,11 +87,18 @@ func StartLeaderActivities(ctx context.Context,
 			OnStartedLeading: func(lctx context.Context) {
 				// lctx will cancel when the leader election stops
 				klog.Infof("Became leader: %s", podName)
-				startNodeLabeler(lctx, schedulerSet, cs, nodeSelector)
+				startNodeLabeler(lctx, schedulerSet, cs, nodeSelector, nodePatchLimiter, nodeLabelParallelism, informerResync)
+				// Don't take pods until there are sub-schedulers to share them with
+				waitForMembers(lctx, schedulerSet, minMembers, minMembersTimeout)
 				if watchPods {
 					startPodWatcher(lctx, podQueue, cs)
 				}
-				manageWebhookEndpoints(lctx, namespace, cs)
+				manageWebhookEndpoints(lctx, namespace, cs, webhookPort)
+				if webhookConfig != nil {
+					if err := webhook.ApplyValidatingWebhookConfiguration(lctx, cs, webhookConfig); err != nil {
+						klog.Error(err, "Error applying ValidatingWebhookConfiguration")
+					}
+				}
 			},
 			OnStoppedLeading: func() {
 				// lctx will cancel when the leader election stops
@@ -97,7 +131,41 @@ func StartLeaderActivities(ctx context.Context,
 	}()
 }
 
-func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerSet, cs kubernetes.Interface, labelSelector string) {
+// waitForMembers blocks until schedulerSet has at least minMembers members, timeout passes or ctx is done.
+// minMembers of 0 returns immediately.
+func waitForMembers(ctx context.Context, schedulerSet *schedulerset.SchedulerSet, minMembers int, timeout time.Duration) {
+	if minMembers <= 0 {
+		return
+	}
+	start := time.Now()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	lastLog := start
+	for {
+		count := int(schedulerSet.GetMemberCount())
+		if count >= minMembers {
+			klog.Infof("Have %d of %d scheduler members after %v, starting to relay", count, minMembers, time.Since(start))
+			timeToQuorumGauge.Set(time.Since(start).Seconds())
+			return
+		}
+		if timeout > 0 && time.Since(start) >= timeout {
+			klog.Warningf("Only %d of %d scheduler members after %v, starting to relay anyway", count, minMembers, timeout)
+			timeToQuorumGauge.Set(time.Since(start).Seconds())
+			return
+		}
+		if time.Since(lastLog) >= 5*time.Second {
+			klog.Infof("Waiting for scheduler members before relaying: have %d of %d", count, minMembers)
+			lastLog = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerSet, cs kubernetes.Interface, labelSelector string, nodePatchLimiter flowcontrol.RateLimiter, nodeLabelParallelism int, informerResync time.Duration) {
 	klog.Infoln("Node labeler started")
 
 	// Not sure why this is needed
@@ -119,7 +187,7 @@ func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 				Resource("nodes").
 				VersionedParams(&options, scheme.ParameterCodec).
 				SetHeader("Accept", "application/vnd.kubernetes.protobuf;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1,application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1,application/json").
-				Do(context.Background()).
+				Do(ctx).
 				Into(result)
 			return result, err
 		},
@@ -132,7 +200,7 @@ func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 				VersionedParams(&options, scheme.ParameterCodec).
 				SetHeader("Accept", "application/vnd.kubernetes.protobuf;as=PartialObjectMetadata;g=meta.k8s.io;v=v1,application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1,application/json").
 				Param("watch", "true").
-				Watch(context.Background())
+				Watch(ctx)
 		},
 	}
 
@@ -152,24 +220,7 @@ func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 	}
 	schedulerSet.AddUpdateHandler(stateChanged)
 
-	emptyMap := map[string]string{}
-	nodeInformer := cache.NewSharedInformer(lw, &metav1.PartialObjectMetadata{}, 0)
-	nodeInformer.SetTransform(func(obj interface{}) (interface{}, error) {
-		// Save memory by stripping everything we don't need
-		n := obj.(*metav1.PartialObjectMetadata)
-		n.ManagedFields = nil
-		n.Annotations = nil
-		n.OwnerReferences = nil
-		n.Finalizers = nil
-		v, exists := n.Labels[SchedulerGroupLabelKey]
-		labels := emptyMap
-		if exists {
-			labels = map[string]string{}
-			labels[SchedulerGroupLabelKey] = v
-		}
-		n.Labels = labels
-		return n, nil
-	})
+	nodeInformer := newNodeInformer(lw, informerResync)
 	go nodeInformer.Run(ctx.Done())
 
 	nodeInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
@@ -186,6 +237,20 @@ func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 			klog.Infof("Node added: %s\n", metadata.GetName())
 			stateChanged()
 		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Only resyncs (see --informer-resync) are of interest. Let the ticker rebalance from the store
+			oldMeta, err := meta.Accessor(oldObj)
+			if err != nil {
+				return
+			}
+			newMeta, err := meta.Accessor(newObj)
+			if err != nil {
+				return
+			}
+			if oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+				dirty.Store(true)
+			}
+		},
 		DeleteFunc: func(obj interface{}) {
 			metadata, err := meta.Accessor(obj)
 			if err != nil {
@@ -199,35 +264,90 @@ func startNodeLabeler(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 
 	cache.WaitForCacheSync(ctx.Done(), nodeInformer.HasSynced)
 	klog.Infof("this many nodes: %v\n", len(nodeInformer.GetStore().ListKeys()))
-	updateNodeLabels(ctx, schedulerSet, nodeInformer, cs)
-	lastUpdateTime = time.Now()
+	setLeaderNodeInformer(nodeInformer)
+	rebalance := func() {
+		if updateNodeLabels(ctx, schedulerSet, nodeInformer, cs, nodePatchLimiter, nodeLabelParallelism) > 0 {
+			// Nodes left on the wrong scheduler are retried on the next tick
+			dirty.Store(true)
+		}
+		lastUpdateTime = time.Now()
+	}
+	rebalance()
 
 	go func() {
 		ticker := time.NewTicker(minInterval)
 		for {
 			select {
 			case <-ctx.Done():
+				setLeaderNodeInformer(nil)
 				klog.Infoln("Node labeler stopped")
 				return
 			case <-dirtyChan:
 				if dirty.Swap(false) {
-					updateNodeLabels(ctx, schedulerSet, nodeInformer, cs)
-					lastUpdateTime = time.Now()
+					rebalance()
 				}
 			case <-ticker.C:
 				if dirty.Swap(false) {
-					updateNodeLabels(ctx, schedulerSet, nodeInformer, cs)
-					lastUpdateTime = time.Now()
+					rebalance()
 				}
 			}
 		}
 	}()
 }
 
-func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerSet, nodeInformer cache.SharedInformer, cs kubernetes.Interface) {
+// newNodeInformer returns the node labeler's informer over lw, which lists and watches PartialObjectMetadata
+func newNodeInformer(lw cache.ListerWatcher, informerResync time.Duration) cache.SharedInformer {
+	emptyMap := map[string]string{}
+	nodeInformer := cache.NewSharedInformer(lw, &metav1.PartialObjectMetadata{}, informerResync)
+	nodeInformer.SetTransform(func(obj interface{}) (interface{}, error) {
+		// Save memory by stripping everything we don't need
+		n := obj.(*metav1.PartialObjectMetadata)
+		n.ManagedFields = nil
+		n.Annotations = nil
+		n.OwnerReferences = nil
+		n.Finalizers = nil
+		v, exists := n.Labels[SchedulerGroupLabelKey]
+		labels := emptyMap
+		if exists {
+			labels = map[string]string{}
+			labels[SchedulerGroupLabelKey] = v
+		}
+		n.Labels = labels
+		return n, nil
+	})
+	// The informer relists and rewatches with backoff on its own, but the default handler only reports
+	// some failures, at a verbosity that hides a labeler stuck retrying
+	if err := nodeInformer.SetWatchErrorHandler(nodeWatchErrorHandler); err != nil {
+		klog.Errorf("Failed to set node labeler watch error handler: %v", err)
+	}
+	return nodeInformer
+}
+
+// nodeWatchErrorHandler logs and counts failures of the node labeler's list and watch
+func nodeWatchErrorHandler(r *cache.Reflector, err error) {
+	switch {
+	case err == io.EOF:
+		// Watch closed normally, it is rewatched from the last resource version
+	case errors.IsResourceExpired(err) || errors.IsGone(err):
+		// The informer relists from the apiserver cache
+		klog.V(2).Infof("Node labeler watch expired, relisting: %v", err)
+	default:
+		nodeLabelerWatchErrorCounter.Inc()
+		klog.Errorf("Node labeler list or watch of nodes failed, retrying with backoff: %v", err)
+	}
+}
+
+// updateNodeLabels relabels nodes to spread them evenly over the schedulers, and returns how many could not be
+// relabeled
+func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerSet, nodeInformer cache.SharedInformer, cs kubernetes.Interface, nodePatchLimiter flowcontrol.RateLimiter, nodeLabelParallelism int) int {
 	// Re-distribute nodes to schedulers evenly, and minimize the number of nodes moved.
 	klog.Infoln("Updating node labels")
-	schedulers := schedulerSet.GetMembers()
+	rebalanceStart := time.Now()
+	defer func() {
+		nodeRebalanceDuration.Observe(time.Since(rebalanceStart).Seconds())
+	}()
+	// GetMembers is shared, so copy it before filtering in place
+	schedulers := slices.Clone(schedulerSet.GetMembers())
 	schedulers = slices.DeleteFunc(schedulers, func(m schedulerset.EndpointItem) bool {
 		// exclude relay pods
 		return strings.HasPrefix(m.PodName, schedulerset.RelayPrefix)
@@ -243,7 +363,7 @@ func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 
 	if len(schedulers) == 0 {
 		klog.Info("No schedulers, skipping node label update")
-		return
+		return 0
 	}
 
 	desiredNodeCountPerGroup := int(math.Ceil(float64(len(nodeList)) / float64(len(schedulers))))
@@ -266,7 +386,8 @@ func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 	}
 	if len(toMove) == 0 {
 		klog.Info("Moved 0 nodes\n")
-		return
+		nodeRebalanceLastMovedGauge.Set(0)
+		return 0
 	}
 
 	for group, count := range nodeCountPerGroup {
@@ -276,18 +397,22 @@ func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 	}
 	if len(shortGroups) == 0 {
 		klog.Info("All groups are full")
-		return
+		nodeRebalanceLastMovedGauge.Set(0)
+		return 0
 	}
 
 	movedCount := int32(0)
-	nodeLabelParallelism := 1000 // TODO: make this configurable
+	failedCount := int32(0)
+	patchStart := time.Now()
 	sem := make(chan struct{}, nodeLabelParallelism)
+	filler := &groupFiller{groups: shortGroups, counts: nodeCountPerGroup, desired: desiredNodeCountPerGroup}
 
 	for i, node := range toMove {
-		desiredPartition := shortGroups[i%len(shortGroups)]
-		nodeCountPerGroup[desiredPartition]++
-		if nodeCountPerGroup[desiredPartition] >= desiredNodeCountPerGroup {
-			shortGroups = slices.Delete(shortGroups, i%len(shortGroups), i%len(shortGroups)+1)
+		desiredPartition, ok := filler.next()
+		if !ok {
+			// Can't happen: the short groups have room for every node to move
+			klog.Errorf("No group has room for node %s", node.GetName())
+			break
 		}
 
 		// This shouldn't happen but just checking
@@ -312,17 +437,28 @@ func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 			continue
 		}
 
+		// Rate limit separately from the concurrency cap so a large rebalance doesn't trip APF
+		if err := nodePatchLimiter.Wait(ctx); err != nil {
+			klog.Infof("Stopping node label update: %v", err)
+			break
+		}
 		sem <- struct{}{}
 		go func(nodeName string) {
-			// Use this instead of client.Nodes().Patch() to avoid unmarshalling the response
-			_, err := cs.CoreV1().RESTClient().Patch(types.MergePatchType).
-				Resource("nodes").
-				Name(nodeName).
-				Body(patchBytes).
-				Do(ctx).
-				Raw()
+			// Throttling and apiserver errors are retried with backoff. A merge patch has no resourceVersion,
+			// so it can't conflict
+			err := util.Retry(ctx, util.DefaultAttempts, func() error {
+				// Use this instead of client.Nodes().Patch() to avoid unmarshalling the response
+				_, err := cs.CoreV1().RESTClient().Patch(types.MergePatchType).
+					Resource("nodes").
+					Name(nodeName).
+					Body(patchBytes).
+					Do(ctx).
+					Raw()
+				return err
+			})
 			if err != nil {
-				klog.Infof("Error updating node labels: %v", err)
+				klog.Infof("Error updating labels of node %s: %v", nodeName, err)
+				atomic.AddInt32(&failedCount, 1)
 			} else {
 				atomic.AddInt32(&movedCount, 1)
 			}
@@ -338,11 +474,44 @@ func updateNodeLabels(ctx context.Context, schedulerSet *schedulerset.SchedulerS
 	for i := 0; i < nodeLabelParallelism; i++ {
 		sem <- struct{}{}
 	}
-	klog.Infof("Moved %d nodes\n", movedCount)
+	patchDuration := time.Since(patchStart)
+	nodeRebalanceMovesCounter.Add(float64(movedCount))
+	nodeRebalanceLastMovedGauge.Set(float64(movedCount))
+	klog.Infof("Moved %d nodes, failed to move %d, in %v (%.1f patches/sec)\n", movedCount, failedCount, patchDuration, float64(movedCount)/patchDuration.Seconds())
 	goruntime.GC()
+	return int(failedCount)
+}
+
+// groupFiller hands out the groups short of nodes round-robin, dropping each once it has desired nodes
+type groupFiller struct {
+	groups  []string
+	counts  map[string]int
+	desired int
+	// cursor is the index into groups of the next group to fill
+	cursor int
 }
 
-func manageWebhookEndpoints(ctx context.Context, namespace string, cs kubernetes.Interface) {
+// next returns the group to move the next node to and counts the node in it. ok is false if every group is full.
+func (f *groupFiller) next() (group string, ok bool) {
+	if len(f.groups) == 0 {
+		return "", false
+	}
+	if f.cursor >= len(f.groups) {
+		f.cursor = 0
+	}
+	group = f.groups[f.cursor]
+	f.counts[group]++
+	if f.counts[group] >= f.desired {
+		// The group after it moves up to the cursor
+		f.groups = slices.Delete(f.groups, f.cursor, f.cursor+1)
+	} else {
+		f.cursor++
+	}
+	return group, true
+}
+
+// manageWebhookEndpoints points the webhook Service at this pod's webhook server, which listens on port
+func manageWebhookEndpoints(ctx context.Context, namespace string, cs kubernetes.Interface, port int32) {
 	// Get pod IP from environment variable
 	podIP := os.Getenv("POD_IP")
 	if podIP == "" {
@@ -353,7 +522,7 @@ func manageWebhookEndpoints(ctx context.Context, namespace string, cs kubernetes
 	// Create or update the endpoints object
 	endpoints := &v1.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "dist-scheduler-webhook",
+			Name:      webhook.ServiceName,
 			Namespace: namespace,
 		},
 		Subsets: []v1.EndpointSubset{
@@ -366,7 +535,7 @@ func manageWebhookEndpoints(ctx context.Context, namespace string, cs kubernetes
 				Ports: []v1.EndpointPort{
 					{
 						Name:     "webhook",
-						Port:     8443,
+						Port:     port,
 						Protocol: v1.ProtocolTCP,
 					},
 				},
@@ -376,20 +545,28 @@ func manageWebhookEndpoints(ctx context.Context, namespace string, cs kubernetes
 
 	// Try to create the endpoints object
 	_, err := cs.CoreV1().Endpoints(namespace).Create(ctx, endpoints, metav1.CreateOptions{})
-	if err != nil {
-		if !errors.IsAlreadyExists(err) {
-			klog.Error(err, "Error creating endpoints")
-			return
-		}
-		// If it already exists, update it
-		_, err = cs.CoreV1().Endpoints(namespace).Update(ctx, endpoints, metav1.UpdateOptions{})
+	if err == nil {
+		return
+	}
+	if !errors.IsAlreadyExists(err) {
+		klog.Error(err, "Error creating endpoints")
+		return
+	}
+	// If it already exists, update it. Another pod that briefly thinks it is leader may be writing it too
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := cs.CoreV1().Endpoints(namespace).Get(ctx, endpoints.Name, metav1.GetOptions{})
 		if err != nil {
-			klog.Error(err, "Error updating endpoints")
-			return
+			return err
 		}
+		endpoints.ResourceVersion = existing.ResourceVersion
+		_, err = cs.CoreV1().Endpoints(namespace).Update(ctx, endpoints, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		klog.Error(err, "Error updating endpoints")
 	}
 }
 
 func clearWebhookEndpoints(ctx context.Context, namespace string, cs kubernetes.Interface) error {
-	return cs.CoreV1().Endpoints(namespace).Delete(ctx, "dist-scheduler-webhook", metav1.DeleteOptions{})
+	return cs.CoreV1().Endpoints(namespace).Delete(ctx, webhook.ServiceName, metav1.DeleteOptions{})
 }
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/webhook"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+func TestManageWebhookEndpointsConflict(t *testing.T) {
+	t.Setenv("POD_IP", "10.0.0.2")
+	// The previous leader's endpoints are still in place
+	cs := fake.NewSimpleClientset(&v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: webhook.ServiceName, Namespace: "kube-system"},
+		Subsets: []v1.EndpointSubset{
+			{Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}},
+		},
+	})
+	// Another writer gets in first, so the first update conflicts
+	conflicts := 1
+	cs.PrependReactor("update", "endpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "endpoints"}, webhook.ServiceName, nil)
+	})
+
+	manageWebhookEndpoints(context.Background(), "kube-system", cs, 9443)
+
+	got, err := cs.CoreV1().Endpoints("kube-system").Get(context.Background(), webhook.ServiceName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Subsets) != 1 || len(got.Subsets[0].Addresses) != 1 || got.Subsets[0].Addresses[0].IP != "10.0.0.2" {
+		t.Errorf("endpoints subsets = %+v, want this pod's IP 10.0.0.2", got.Subsets)
+	} else if ports := got.Subsets[0].Ports; len(ports) != 1 || ports[0].Port != 9443 {
+		t.Errorf("endpoints ports = %+v, want the webhook server's port 9443", ports)
+	}
+	if conflicts != 0 {
+		t.Errorf("update was not attempted through the conflict")
+	}
+}
+
+func TestValidateElectionID(t *testing.T) {
+	for _, id := range []string{DefaultElectionID, "dist-scheduler-canary", "team.dist-scheduler"} {
+		if err := validateElectionID(id); err != nil {
+			t.Errorf("validateElectionID(%q) error = %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "Dist-Scheduler", "dist_scheduler", "dist-scheduler-"} {
+		if err := validateElectionID(id); err == nil {
+			t.Errorf("validateElectionID(%q) error = nil, want an error", id)
+		}
+	}
+}
+
+func TestWaitForMembers(t *testing.T) {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{{PodName: "dist-scheduler-0", Addresses: []string{"10.0.0.1"}}})
+
+	done := make(chan struct{})
+	go func() {
+		waitForMembers(context.Background(), ss, 2, 0)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("waitForMembers() returned with 1 of 2 members")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	ss.SetMembersForTest([]schedulerset.EndpointItem{
+		{PodName: "dist-scheduler-0", Addresses: []string{"10.0.0.1"}},
+		{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.2"}},
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("waitForMembers() did not return once 2 members joined")
+	}
+
+	// The timeout starts relaying even without enough members
+	start := time.Now()
+	waitForMembers(context.Background(), ss, 3, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("waitForMembers() with timeout returned after %v, want about 200ms", elapsed)
+	}
+
+	// A cancelled ctx returns right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	waitForMembers(ctx, ss, 3, 0)
+}
+
+func TestGroupFiller(t *testing.T) {
+	// 20 nodes over 4 schedulers: b is already full and 11 nodes are to move
+	counts := map[string]int{"a": 0, "b": 5, "c": 4, "d": 0}
+	filler := &groupFiller{groups: []string{"a", "c", "d"}, counts: counts, desired: 5}
+
+	var got []string
+	for i := 0; i < 11; i++ {
+		group, ok := filler.next()
+		if !ok {
+			t.Fatalf("next() = false after %v", got)
+		}
+		got = append(got, group)
+	}
+	// c fills first, after which a and d alternate
+	if want := "[a c d a d a d a d a d]"; fmt.Sprint(got) != want {
+		t.Errorf("next() = %v, want %s", got, want)
+	}
+	for group, count := range counts {
+		if count != 5 {
+			t.Errorf("group %s has %d nodes, want 5", group, count)
+		}
+	}
+	if group, ok := filler.next(); ok {
+		t.Errorf("next() = %s with every group full, want false", group)
+	}
+}
+
+// nodeLabelerWatchErrors reads distscheduler_node_labeler_watch_error_count from the registry
+func nodeLabelerWatchErrors(t *testing.T) float64 {
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "distscheduler_node_labeler_watch_error_count" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestNodeInformerListError(t *testing.T) {
+	registerMetrics()
+	before := nodeLabelerWatchErrors(t)
+
+	lists := make(chan struct{}, 10)
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			lists <- struct{}{}
+			return nil, fmt.Errorf("connection refused")
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+	nodeInformer := newNodeInformer(lw, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go nodeInformer.Run(ctx.Done())
+
+	select {
+	case <-lists:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("node informer never listed")
+	}
+	// The error handler runs after the failed list returns
+	deadline := time.Now().Add(5 * time.Second)
+	for nodeLabelerWatchErrors(t) <= before {
+		if time.Now().After(deadline) {
+			t.Fatalf("failed list was not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nodeInformer.HasSynced() {
+		t.Errorf("HasSynced() = true after only failed lists")
+	}
+}
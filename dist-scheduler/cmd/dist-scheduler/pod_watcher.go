@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	"bchess.org/dist-scheduler/pkg/util"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,7 +18,7 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func startPodWatcher(ctx context.Context, podQueue chan *v1.Pod, cs kubernetes.Interface) {
+func startPodWatcher(ctx context.Context, podQueue *util.PodQueue, cs kubernetes.Interface) {
 	klog.Info("Pod watcher started")
 
 	informerFactory := informers.NewSharedInformerFactory(cs, 0)
@@ -27,17 +28,17 @@ func startPodWatcher(ctx context.Context, podQueue chan *v1.Pod, cs kubernetes.I
 	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			if pod, ok := obj.(*v1.Pod); ok {
-				if pod.Name[len(pod.Name)-1] == '0' && pod.Name[len(pod.Name)-2] == '0' {
-					logger.Info("New unscheduled pod added", "namespace", pod.Namespace, "pod", pod.Name, "qs", len(podQueue))
+				if util.ShouldSampleLog(pod.Name) {
+					logger.Info("New unscheduled pod added", "namespace", pod.Namespace, "pod", pod.Name, "qs", podQueue.Len())
 				} else {
-					logger.V(2).Info("New unscheduled pod added", "namespace", pod.Namespace, "pod", pod.Name, "qs", len(podQueue))
+					logger.V(2).Info("New unscheduled pod added", "namespace", pod.Namespace, "pod", pod.Name, "qs", podQueue.Len())
 				}
 				if pod.Spec.SchedulerName != "dist-scheduler" {
 					// TODO: maybe avoid hard-coding
 					return
 				}
 				podObservedCounter.Inc()
-				podQueue <- pod
+				podQueue.Enqueue(pod)
 			}
 		},
 	})
@@ -5,8 +5,10 @@ package main
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,12 +17,14 @@ import (
 	"bchess.org/dist-scheduler/pkg/schedulerset"
 	"bchess.org/dist-scheduler/pkg/util"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding"
 	"k8s.io/klog/v2"
 )
 
-func RelayPod(ctx context.Context, getRawPod func() ([]byte, error), schedulerSet *schedulerset.SchedulerSet, waitForSubSchedulers float64, clientIndex int) (util.CountDownLatch, error) {
+// ErrNoRelayDestination is returned by RelayPod when there were sub-schedulers but none of them was sent the pod
+var ErrNoRelayDestination = errors.New("pod was not relayed to any sub-scheduler")
+
+func RelayPod(ctx context.Context, getRawPod func() ([]byte, error), schedulerSet *schedulerset.SchedulerSet, waitForSubSchedulers float64, subSchedulerStragglers int, clientIndex int, streams *relayStreams, backoff *util.ReconnectBackoff) (util.CountDownLatch, error) {
 	members := schedulerSet.GetSubMembers()
 	if len(members) == 0 {
 		return nil, nil
@@ -32,7 +36,12 @@ func RelayPod(ctx context.Context, getRawPod func() ([]byte, error), schedulerSe
 		return nil, err
 	}
 
-	wg := util.NewCountDownLatch(len(members), waitForSubSchedulers)
+	var wg util.CountDownLatch
+	if subSchedulerStragglers >= 0 {
+		wg = util.NewCountDownLatchAbsolute(len(members), len(members)-subSchedulerStragglers)
+	} else {
+		wg = util.NewCountDownLatch(len(members), waitForSubSchedulers)
+	}
 
 	// Hack to get the pod name, but just for logging
 	podNameLen := rawPod[7]
@@ -41,12 +50,17 @@ func RelayPod(ctx context.Context, getRawPod func() ([]byte, error), schedulerSe
 	logger := klog.FromContext(ctx).WithName("Relay").WithValues("pod", podName)
 	v4 := logger.V(4)
 
-	clientIndexStr := strconv.Itoa(clientIndex)
-
+	delivered := 0
 	for _, member := range members {
+		if !backoff.Allow(member.PodName) {
+			// Don't pay the cost of reconnecting to a destination that keeps failing
+			v4.Info("Skipping dead destination", "destination_pod", member.PodName)
+			wg.Done()
+			continue
+		}
 		v4.Info("Relaying pod", "destination_pod", member.PodName)
 		start := time.Now()
-		err := sendPodToEndpoint(ctx, member, rawPod, wg, podName, clientIndexStr)
+		err := sendPodToEndpoint(ctx, member, rawPod, wg, podName, streams.key(member.PodName, clientIndex), backoff)
 		if err != nil {
 			logger.Error(err, "failed to send pod to", "destination_pod", member.PodName)
 			wg.Done()
@@ -56,10 +70,41 @@ func RelayPod(ctx context.Context, getRawPod func() ([]byte, error), schedulerSe
 		v4.Info("Sent pod", "destination_pod", member.PodName, "duration_ms", duration*1000)
 		podRelayTime.WithLabelValues(member.PodName).Add(duration)
 		podRelayCounter.WithLabelValues(member.PodName).Inc()
+		delivered++
+	}
+	if delivered == 0 {
+		// Every destination was dead or failed, so wg is already released
+		return wg, ErrNoRelayDestination
 	}
 	return wg, nil
 }
 
+// relayStreams picks which of a destination's cached streams a pod is relayed on
+type relayStreams struct {
+	// perDestination is the number of streams to each destination, shared round-robin by every worker.
+	// 0 gives each worker its own stream to every destination instead
+	perDestination int
+	// next maps a destination pod name to the *atomic.Uint32 counting pods relayed to it
+	next sync.Map
+}
+
+func newRelayStreams(perDestination int) *relayStreams {
+	return &relayStreams{perDestination: perDestination}
+}
+
+// key returns the stream cache key, relative to the destination, for the next pod relayed by worker clientIndex
+func (r *relayStreams) key(destination string, clientIndex int) string {
+	if r == nil || r.perDestination <= 0 {
+		return strconv.Itoa(clientIndex)
+	}
+	counter, ok := r.next.Load(destination)
+	if !ok {
+		counter, _ = r.next.LoadOrStore(destination, new(atomic.Uint32))
+	}
+	n := counter.(*atomic.Uint32).Add(1) - 1
+	return "rr" + strconv.Itoa(int(n%uint32(r.perDestination)))
+}
+
 type PendingRequest struct {
 	wg      util.CountDownLatch
 	start   time.Time
@@ -68,49 +113,98 @@ type PendingRequest struct {
 }
 
 type NewPodStream struct {
-	stream           grpc.BidiStreamingClient[podservice.NewPodRequest, podservice.NewPodResponse]
+	conn   *grpc.ClientConn
+	stream grpc.BidiStreamingClient[podservice.NewPodRequest, podservice.NewPodResponse]
+	// cacheKey is the stream's key in clientCache
+	cacheKey string
+	// done is closed when the receiverLoop exits, after which no response will be matched
+	done chan struct{}
+	// sendLock serializes SendMsg, which is not safe to call concurrently, when workers share the stream
+	sendLock         sync.Mutex
 	pendingRequests  sync.Map
 	requestIdCounter uint32
 }
 
+// NewRelayBackoff returns a ReconnectBackoff for relay destinations that reports dead destinations to relayDeadDestinationGauge
+func NewRelayBackoff(maxFailures int, window time.Duration, cooldown time.Duration) *util.ReconnectBackoff {
+	return util.NewReconnectBackoff(maxFailures, window, cooldown, func(destination string, dead bool) {
+		if dead {
+			klog.Warningf("Relay destination %s failed %d times within %v, skipping it for %v", destination, maxFailures, window, cooldown)
+			relayDeadDestinationGauge.WithLabelValues(destination).Set(1)
+		} else {
+			relayDeadDestinationGauge.WithLabelValues(destination).Set(0)
+		}
+	})
+}
+
 var clientCacheLock sync.Mutex
+
+// clientCache is keyed by the destination pod name and the stream key, see relayStreams.key
 var clientCache = make(map[string]*NewPodStream)
 
-func sendPodToEndpoint(ctx context.Context, member schedulerset.EndpointItem, pod []byte, wg util.CountDownLatch, podName string, clientIndex string) error {
+// evictRelayStreams closes and forgets the cached streams to departed members, so that a pod that takes over
+// one's name or address is dialed afresh
+func evictRelayStreams(departed []schedulerset.EndpointItem) {
+	clientCacheLock.Lock()
+	defer clientCacheLock.Unlock()
+	for _, member := range departed {
+		prefix := member.PodName + "/"
+		for cacheKey, cs := range clientCache {
+			if strings.HasPrefix(cacheKey, prefix) {
+				cs.conn.Close()
+				delete(clientCache, cacheKey)
+			}
+		}
+	}
+}
+
+func sendPodToEndpoint(ctx context.Context, member schedulerset.EndpointItem, pod []byte, wg util.CountDownLatch, podName string, streamKey string, backoff *util.ReconnectBackoff) error {
 	var err error
-	cacheKey := member.PodName + "/" + clientIndex
+	cacheKey := member.PodName + "/" + streamKey
 
 	logger := klog.FromContext(ctx).WithValues("destination_pod", member.PodName)
 	v4 := logger.V(4)
 
 	clientCacheLock.Lock()
 	cs, ok := clientCache[cacheKey]
+	if ok && cs.dead() {
+		// The receiverLoop will exit, if it hasn't, and its close won't remove the replacement
+		delete(clientCache, cacheKey)
+		ok = false
+	}
 	if !ok {
-		addr := util.GRPCAddress(member.Addresses[0], "50051") // TODO: do not hard-code port
+		addr := member.GRPCAddress()
 
 		// Create a context with timeout for the entire operation
 		client, err := grpc.NewClient(
 			addr,
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
-			grpc.WithDefaultCallOptions(
-				grpc.ForceCodec(&RawCodec{
-					ParentCodec: encoding.GetCodec("proto"),
-				}),
-			),
+			util.GRPCDialOptions(
+				grpc.WithDefaultCallOptions(
+					grpc.ForceCodec(&RawCodec{
+						ParentCodec: encoding.GetCodec("proto"),
+					}),
+				),
+			)...,
 		)
 		if err != nil {
 			err = fmt.Errorf("failed NewClient: %w", err)
 			clientCacheLock.Unlock()
+			backoff.RecordFailure(member.PodName)
 			return err
 		}
 		stream, err := podservice.NewPodServiceClient(client).NewPod(context.Background(), grpc.CallContentSubtype(RawCodecName))
 		if err != nil {
 			err = fmt.Errorf("failed NewPodServiceClient: %w", err)
 			clientCacheLock.Unlock()
+			backoff.RecordFailure(member.PodName)
 			return err
 		}
+		backoff.RecordSuccess(member.PodName)
 		cs = &NewPodStream{
+			conn:             client,
 			stream:           stream,
+			cacheKey:         cacheKey,
+			done:             make(chan struct{}),
 			pendingRequests:  sync.Map{},
 			requestIdCounter: 0,
 		}
@@ -121,7 +215,7 @@ func sendPodToEndpoint(ctx context.Context, member schedulerset.EndpointItem, po
 
 	v4.Info("SendPod Calling NewPod", "pod", podName, "destination_addresses", member.Addresses, "cache_key", cacheKey)
 
-	doLog := podName[len(podName)-1] == '0' && podName[len(podName)-2] == '0'
+	doLog := util.ShouldSampleLog(podName)
 	if doLog {
 		logger.Info("SendPodToEndpoint SendMsg", "pod", podName)
 	}
@@ -139,12 +233,18 @@ func sendPodToEndpoint(ctx context.Context, member schedulerset.EndpointItem, po
 	requestIdBytes[0] = 0x0d // field 1, wiretype fixed32
 	binary.LittleEndian.PutUint32(requestIdBytes[1:], requestId)
 	msg := append(requestIdBytes[:], pod...)
+	cs.sendLock.Lock()
 	err = cs.stream.SendMsg(msg)
+	cs.sendLock.Unlock()
 	if err != nil {
 		err = fmt.Errorf("failed SendMsg: %w", err)
 		clientCacheLock.Lock()
-		delete(clientCache, cacheKey)
+		if clientCache[cacheKey] == cs {
+			cs.conn.Close()
+			delete(clientCache, cacheKey)
+		}
 		clientCacheLock.Unlock()
+		backoff.RecordFailure(member.PodName)
 		return err
 	}
 	v4.Info("SendPodToEndpoint SendMsg", "time_us", time.Since(pr.start).Microseconds())
@@ -152,8 +252,32 @@ func sendPodToEndpoint(ctx context.Context, member schedulerset.EndpointItem, po
 	return nil
 }
 
+// dead reports whether the stream has ended or its receiverLoop has exited, so it must not be reused.
+// The stream's context ends as soon as the stream does, possibly before the receiverLoop has noticed
+func (cs *NewPodStream) dead() bool {
+	select {
+	case <-cs.done:
+		return true
+	default:
+		return cs.stream.Context().Err() != nil
+	}
+}
+
+// close removes the stream from clientCache, unless it was already replaced, and closes its connection.
+// Pods still awaiting a response are left to their latch's timeout
+func (cs *NewPodStream) close() {
+	clientCacheLock.Lock()
+	close(cs.done)
+	if clientCache[cs.cacheKey] == cs {
+		delete(clientCache, cs.cacheKey)
+	}
+	clientCacheLock.Unlock()
+	cs.conn.Close()
+}
+
 func (cs *NewPodStream) receiverLoop(ctx context.Context, member schedulerset.EndpointItem) {
 	logger := klog.FromContext(ctx).WithValues("destination_pod", member.PodName)
+	defer cs.close()
 	// This is the receiver loop for the NewPod stream. Every response gets mapped into the pendingRequests map,
 	// and the corresponding latch/waitgroup is marked as done.
 	for {
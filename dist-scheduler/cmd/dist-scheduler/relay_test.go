@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/podservice"
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRelayStreamsKey(t *testing.T) {
+	streams := newRelayStreams(3)
+	var got []string
+	for i := 0; i < 4; i++ {
+		// The worker index doesn't matter, every worker shares the same streams
+		got = append(got, streams.key("dist-scheduler-1", i))
+	}
+	want := []string{"rr0", "rr1", "rr2", "rr0"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("key() = %v, want %v", got, want)
+		}
+	}
+	if got := streams.key("dist-scheduler-2", 5); got != "rr0" {
+		t.Errorf("key() for a new destination = %q, want rr0", got)
+	}
+
+	// Without a per-destination count each worker has its own stream
+	for _, streams := range []*relayStreams{nil, newRelayStreams(0)} {
+		if got := streams.key("dist-scheduler-1", 5); got != "5" {
+			t.Errorf("key() = %q, want 5", got)
+		}
+	}
+}
+
+// BenchmarkRelayStreams relays pods from concurrent workers to a single destination that just acknowledges them,
+// comparing per-worker streams (streams=0) with a shared round-robin pool of each size
+func BenchmarkRelayStreams(b *testing.B) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("Listen() error = %v", err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	encoding.RegisterCodec(&RawCodec{ParentCodec: encoding.GetCodec("proto")})
+	s := grpc.NewServer()
+	podservice.RegisterPodServiceServer(s, &podServiceServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	rawPod, err := encoding.GetCodec("proto").Marshal(&podservice.NewPodRequest{Pod: &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bench-pod-1"},
+	}})
+	if err != nil {
+		b.Fatalf("Marshal() error = %v", err)
+	}
+
+	for _, n := range []int{0, 1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("streams=%d", n), func(b *testing.B) {
+			// A distinct destination name keeps each run's streams out of the others' cache entries
+			member := schedulerset.EndpointItem{PodName: fmt.Sprintf("bench-%d", n), Addresses: []string{"127.0.0.1"}, Port: port}
+			streams := newRelayStreams(n)
+			var workers atomic.Int32
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				clientIndex := int(workers.Add(1))
+				for pb.Next() {
+					wg := util.NewCountDownLatchAbsolute(1, 1)
+					if err := sendPodToEndpoint(context.Background(), member, rawPod, wg, "bench-pod-1", streams.key(member.PodName, clientIndex), nil); err != nil {
+						b.Error(err)
+						return
+					}
+					wg.Wait()
+				}
+			})
+		})
+	}
+}
+
+// startRelayDestination serves a podServiceServer that just acknowledges relayed pods, returning its port
+func startRelayDestination(t *testing.T) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	s := grpc.NewServer()
+	podservice.RegisterPodServiceServer(s, &podServiceServer{})
+	go s.Serve(lis)
+	return port, s
+}
+
+func TestRelayStreamRebuiltAfterReceiverExits(t *testing.T) {
+	encoding.RegisterCodec(&RawCodec{ParentCodec: encoding.GetCodec("proto")})
+	rawPod, err := encoding.GetCodec("proto").Marshal(&podservice.NewPodRequest{Pod: &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-1"},
+	}})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	cached := func() *NewPodStream {
+		clientCacheLock.Lock()
+		defer clientCacheLock.Unlock()
+		return clientCache["rebuild-1/0"]
+	}
+	send := func(member schedulerset.EndpointItem) {
+		t.Helper()
+		wg := util.NewCountDownLatchAbsolute(1, 1)
+		if err := sendPodToEndpoint(context.Background(), member, rawPod, wg, "pod-1", "0", nil); err != nil {
+			t.Fatalf("sendPodToEndpoint() error = %v", err)
+		}
+		acked := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(acked)
+		}()
+		select {
+		case <-acked:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("pod was not acknowledged")
+		}
+	}
+
+	port, s := startRelayDestination(t)
+	send(schedulerset.EndpointItem{PodName: "rebuild-1", Addresses: []string{"127.0.0.1"}, Port: port})
+	first := cached()
+	if first == nil {
+		t.Fatalf("stream was not cached")
+	}
+
+	// The destination going away ends the receiver, which must drop the stream
+	s.Stop()
+	select {
+	case <-first.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("receiverLoop did not exit")
+	}
+	if cached() != nil {
+		t.Errorf("stream is still cached after its receiver exited")
+	}
+
+	// The same destination comes back elsewhere, and a new stream is dialed to it
+	port, s = startRelayDestination(t)
+	defer s.Stop()
+	send(schedulerset.EndpointItem{PodName: "rebuild-1", Addresses: []string{"127.0.0.1"}, Port: port})
+	if second := cached(); second == nil || second == first {
+		t.Errorf("stream was not rebuilt")
+	}
+}
+
+func TestRelayOnlyAllSubSchedulersDown(t *testing.T) {
+	registerMetrics()
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{
+		{PodName: "dist-scheduler-0", Addresses: []string{"10.0.0.1"}},
+		{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.2"}},
+		{PodName: "dist-scheduler-2", Addresses: []string{"10.0.0.3"}},
+	})
+	ss.SetLeader("dist-scheduler-0")
+	// Both sub-schedulers are marked dead, so nothing is dialed
+	backoff := util.NewReconnectBackoff(1, time.Minute, time.Minute, nil)
+	backoff.RecordFailure("dist-scheduler-1")
+	backoff.RecordFailure("dist-scheduler-2")
+
+	ds := &DistScheduler{
+		schedulerStack: util.NewStack[*Scheduler](nil),
+		podQueue:       util.NewPodQueue(10, 10),
+		schedulerSet:   ss,
+		relayBackoff:   backoff,
+		relayOnly:      true,
+		relayOnlyHold:  time.Minute,
+	}
+	// RelayPod reads the pod name at a fixed offset that assumes the pod and its metadata are over 127 bytes
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-1", Annotations: map[string]string{
+		"padding": strings.Repeat("x", 200),
+	}}}
+	getRawPod := func() ([]byte, error) {
+		return encoding.GetCodec("proto").Marshal(&podservice.NewPodRequest{Pod: pod})
+	}
+
+	if err := ds.ProcessOne(context.Background(), 0, pod, getRawPod); err != nil {
+		t.Fatalf("ProcessOne() error = %v, want the pod held", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	requeued, ok := ds.podQueue.Dequeue(ctx)
+	if !ok || requeued.Name != "pod-1" {
+		t.Fatalf("held pod was not requeued")
+	}
+
+	// Past --relay-only-hold the pod is dropped
+	ds.relayOnlyHold = 0
+	if err := ds.ProcessOne(context.Background(), 0, pod, getRawPod); err == nil {
+		t.Errorf("ProcessOne() error = nil, want the pod dropped")
+	}
+	if _, held := ds.undeliveredSince.Load("default/pod-1"); held {
+		t.Errorf("dropped pod is still tracked as held")
+	}
+}
+
+func TestForceLocalOnlyOnScoringTarget(t *testing.T) {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-relay-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	podNames := []string{"dist-scheduler-relay-0", "dist-scheduler-1", "dist-scheduler-2", "dist-scheduler-3"}
+	members := make([]schedulerset.EndpointItem, 0, len(podNames))
+	for i, podName := range podNames {
+		members = append(members, schedulerset.EndpointItem{PodName: podName, Addresses: []string{fmt.Sprintf("10.0.0.%d", i)}})
+	}
+	ss.SetMembersForTest(members)
+	ss.SetLeader("dist-scheduler-relay-0")
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-1", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}}
+	forced := 0
+	// The relay-only leader relays the pod like any other, and the schedulers below it decide who schedules it
+	for _, podName := range podNames[1:] {
+		ds := &DistScheduler{podName: podName, schedulerSet: ss, maxPendingAge: time.Minute}
+		force, skip := ds.forceLocal(pod)
+		if force == skip {
+			t.Errorf("%s forceLocal() = %v, %v, want exactly one set", podName, force, skip)
+		}
+		if force {
+			forced++
+		}
+	}
+	if forced != 1 {
+		t.Errorf("%d schedulers force the pod, want 1", forced)
+	}
+
+	ds := &DistScheduler{podName: "dist-scheduler-1", schedulerSet: ss, maxPendingAge: 2 * time.Hour}
+	if force, skip := ds.forceLocal(pod); force || skip {
+		t.Errorf("forceLocal() of a young pod = %v, %v, want false, false", force, skip)
+	}
+}
@@ -4,10 +4,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"runtime/trace"
+	"sync"
 	"time"
 
 	traceexp "golang.org/x/exp/trace"
@@ -15,14 +17,18 @@ import (
 	"bchess.org/dist-scheduler/pkg/distpermit"
 	"bchess.org/dist-scheduler/pkg/podservice"
 	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/scoreevaluator"
+	"bchess.org/dist-scheduler/pkg/selftest"
 	"bchess.org/dist-scheduler/pkg/util"
 	"bchess.org/dist-scheduler/pkg/webhook"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc/encoding"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	apiserver "k8s.io/apiserver/pkg/server"
@@ -33,6 +39,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/util/flowcontrol"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/cli/globalflag"
 	"k8s.io/component-base/logs"
@@ -52,8 +59,10 @@ import (
 )
 
 const SchedulerGroupLabelKey = "dist-scheduler.dev/scheduler"
-const PodQueueSize = 1000000
-const NumSchedulers = 100
+const DefaultPodQueueSize = 1000000
+const DefaultUrgentQueueSize = 10000
+const DefaultBindFailureRetries = 0
+const DefaultNumInternalSchedulers = 100
 const DefaultNumConcurrentSchedulers = 8
 
 func NewSchedulerCommand() *cobra.Command {
@@ -77,14 +86,57 @@ func NewSchedulerCommand() *cobra.Command {
 	fs := cmd.Flags()
 
 	myFs := pflag.NewFlagSet("Dist Scheduler", pflag.ExitOnError)
-	myFs.String("grpc-addr", ":50051", "gRPC server address")
+	myFs.String("grpc-addr", ":"+util.DefaultGRPCPort, "gRPC server address, host:port or unix:///path/to.sock to listen on a Unix domain socket for a co-located relay. The other schedulers are dialed on the same port")
+	myFs.String("grpc-tls-cert", "", "Certificate this scheduler presents to the other schedulers, for both its gRPC server and its clients. With --grpc-tls-key and --grpc-tls-ca, the gRPC connections between schedulers use mutual TLS. Unset, they are plaintext")
+	myFs.String("grpc-tls-key", "", "Key of --grpc-tls-cert")
+	myFs.String("grpc-tls-ca", "", "CA bundle the other schedulers' certificates must be signed by. Their names are not checked, as they are dialed by pod IP")
+	myFs.Duration("grpc-keepalive", util.DefaultGRPCKeepalive, "How often connections to the other schedulers are pinged when idle. A connection whose ping is not answered within this long is closed and redialed, so a scheduler that stops responding fails relays and scores instead of hanging them. At least 10s, 0 disables")
 	myFs.String("node-selector", "", "Scheduler only tracks nodes with this label selector. (Only applies for leader)")
 	myFs.Int("num-concurrent-schedulers", DefaultNumConcurrentSchedulers, "number of concurrent schedulers")
+	myFs.Int("num-internal-schedulers", DefaultNumInternalSchedulers, "Number of kube-scheduler instances to create, the most --num-concurrent-schedulers can be raised to at runtime. Each holds its own scheduling framework, so fewer save memory")
+	myFs.Int("pod-queue-size", DefaultPodQueueSize, "Number of normal pods the ingress queue holds before enqueueing blocks. The queue's memory is allocated up front")
+	myFs.Int("urgent-queue-size", DefaultUrgentQueueSize, "Number of urgent pods the ingress queue holds, separately from --pod-queue-size, before enqueueing them blocks. The queue's memory is allocated up front")
 	myFs.Float64("wait-for-subschedulers", 1.0, "wait for sub-schedulers to finish before proceeding")
+	myFs.Int("subscheduler-stragglers", -1, "If >= 0, wait for all but this many sub-schedulers instead of using --wait-for-subschedulers")
+	myFs.Int("relay-max-reconnect-failures", 3, "Mark a sub-scheduler dead after this many failed relay stream creations within --relay-reconnect-window. 0 disables")
+	myFs.Duration("relay-reconnect-window", 10*time.Second, "Window for --relay-max-reconnect-failures")
+	myFs.Duration("relay-dead-cooldown", 30*time.Second, "How long to skip relaying to a dead sub-scheduler before retrying it")
+	myFs.Duration("relay-topology-settle", 0, "Wait for scheduler membership to be unchanged for this long before recomputing relay sub-members, so rolling deploys don't rebuild the relay tree on every change. 0 disables")
+	myFs.Duration("relay-topology-max-settle", 10*time.Second, "Recompute relay sub-members at most this long after the first membership change, even if membership hasn't settled")
+	myFs.Uint32("relay-fanout", 10, "Number of sub-schedulers each scheduler relays pods to. Must be the same on every scheduler, or they will disagree on the relay tree")
+	myFs.Int("relay-streams-per-destination", 0, "Number of NewPod streams to each sub-scheduler, shared round-robin by all concurrent schedulers. 0 gives each of --num-concurrent-schedulers its own stream to every sub-scheduler")
+	myFs.Duration("informer-resync", 0, "Resync period for the node and EndpointSlice informers. A resync re-delivers every cached object to the handlers, correcting drift from missed events at the cost of extra CPU. 0 disables")
+	myFs.Duration("max-pending-age", 0, "Pods older than this when they reach a scheduler are scheduled by their scoring target alone, skipping CollectScore, and not scored by the other schedulers. They are still relayed, so a relay-only leader passes them on. A pod whose scoring target is down stays pending. 0 disables")
+	myFs.Duration("depth-sample-interval", time.Second, "How often to sample the pod queue depth and available schedulers into metrics. 0 disables")
+	myFs.Int("bind-failure-retries", DefaultBindFailureRetries, "When a bind fails, or the winning node is gone by Permit, check the pod at the apiserver and, if it is still unbound, send it back through the leader to be scored again, up to this many times. 0 disables rescoring, and such pods are left failed")
+	myFs.Bool("self-test", false, "Report received self-test marker pods to the leader, and as leader serve /admin/selftest to verify the relay tree delivers every pod to every scheduler exactly once. Must be set on every scheduler")
+	myFs.Bool("include-terminating-members", false, "Keep relaying pods to, and waiting for the scores of, scheduler pods that are terminating but still serving. Otherwise they are dropped from the members as soon as they start terminating, like pods that are not ready")
 	myFs.Bool("leader-eligible", true, "Whether this scheduler should run for leader election")
+	myFs.String("election-id", DefaultElectionID, "Name of the leader election Lease. Must be unique per scheduler deployment in the namespace, e.g. when running a canary beside a stable deployment, or they will share one leader")
+	myFs.Float32("score-weight", 1, "Multiplier the CollectScore target applies to this scheduler's scores when picking a winner")
 	myFs.Bool("permit-always-deny", false, "Have Permit deny all pods. For testing only")
 	myFs.Bool("relay-only", false, "Only relay pods, do not schedule ourselves")
+	myFs.Duration("relay-only-hold", 0, "With --relay-only, requeue a pod no sub-scheduler could be sent every second for up to this long, instead of dropping it. 0 drops it")
+	myFs.Bool("allow-debug-scoring-target", false, "DEBUG ONLY: honor the dist-scheduler.dev/debug-scoring-target pod annotation. Must be set on every scheduler")
+	myFs.Int("min-members-before-relay", 0, "On becoming leader, wait for this many scheduler members, including the leader, before watching pods or taking pods from the admission hook. 0 disables")
+	myFs.Duration("min-members-timeout", time.Minute, "Start anyway if --min-members-before-relay members have not joined within this long. 0 waits forever")
 	myFs.Bool("watch-pods", false, "Leader watches for unscheduled pods (otherwise just use admission hook)")
+	myFs.String("webhook-addr", fmt.Sprintf(":%d", webhook.DefaultPort), "Admission hook server address, host:port. The leader points the webhook Service endpoints at this port")
+	myFs.String("webhook-pod-selector", "", "Only queue pods from the admission hook that match this label selector. Also applied as the objectSelector with --manage-webhook-config")
+	myFs.String("queue-full-policy", "block", "What the admission hook does with a pod when the pod queue is full: block, holding up the admission request until there is room, which the apiserver may time out, or drop, leaving the pod pending and counting it in distscheduler_pod_dropped_count")
+	myFs.String("webhook-client-ca-file", "", "CA bundle the admission hook verifies client certificates against. When set, clients without a certificate signed by it, i.e. anything but an apiserver configured to present one, are rejected")
+	myFs.Bool("manage-webhook-config", false, "Leader creates or updates the ValidatingWebhookConfiguration for the admission hook, using the CA bundle from the mounted webhook certs")
+	myFs.Float32("node-patch-qps", 0, "Maximum node label patches per second when rebalancing nodes. 0 means unlimited (Only applies for leader)")
+	myFs.Int("node-patch-burst", 1000, "Burst for --node-patch-qps")
+	myFs.Int("node-label-parallelism", 1000, "Maximum node label patches in flight at once when rebalancing nodes (Only applies for leader)")
+	myFs.Duration("score-window-per-tier", 5*time.Second, "How long CollectScore waits for every scheduler's score, per relay tier below the leader, before deciding a pod's winner with the scores it has. Deeper trees take longer for a pod to reach every scheduler. Can be changed while running with a POST to /admin/score-window?per-tier=<duration>")
+	myFs.Duration("score-collection-timeout", 0, "Total time CollectScore waits for every scheduler's score before deciding a pod's winner, split evenly over the relay tiers below the leader. Overrides --score-window-per-tier. 0 uses --score-window-per-tier")
+	myFs.Int("min-score-limit", 0, "Fewest scores CollectScore needs for a pod before deciding its winner early, so a member count that reads low during scale-up does not cut collection short. The winner is still decided after the collection delay")
+	myFs.String("decision-csv", "", "Append one CSV row per pod whose CollectScore winner this scheduler decided. \"-\" for stdout")
+	myFs.Float64("log-sample-rate", util.DefaultLogSampleRate, "Fraction of pods, 0 to 1, whose progress is logged by default rather than only at higher verbosity. Pods are picked by a hash of their name, so every scheduler logs the same ones")
+	myFs.Float64("validation-sample-rate", 0, "Fraction of pods, 0 to 1, whose CollectScore winner is logged with every candidate score, to compare offline with what a single scheduler with a view of every node would choose. No scheduler holds every node, so the comparison is not made while running. 0 disables")
+	myFs.StringSlice("tenant-namespaces", nil, "Namespaces counted under their own name in per-namespace metrics. Pods in every other namespace are counted as \"other\", bounding the metrics' cardinality")
+	myFs.Int("max-score-evaluators", 0, "Maximum number of pods whose CollectScore winner is being decided at once. Scores for further pods are rejected and retried by the sender with backoff. 0 means unlimited")
 
 	nfs.FlagSets["Dist Scheduler"] = myFs
 
@@ -146,6 +198,19 @@ func Start(ctx context.Context, opts *options.Options, outOfTreeRegistryOptions
 	}
 
 	registerMetrics()
+	logSampleRate, err := dsFlags.GetFloat64("log-sample-rate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert log-sample-rate to float64: %v", err)
+	}
+	if logSampleRate < 0 || logSampleRate > 1 {
+		return nil, fmt.Errorf("--log-sample-rate must be between 0 and 1")
+	}
+	util.SetLogSampleRate(logSampleRate)
+	tenantNamespaces, err := dsFlags.GetStringSlice("tenant-namespaces")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert tenant-namespaces to string slice: %v", err)
+	}
+	distpermit.SetTenantNamespaces(util.NewNamespaceBuckets(tenantNamespaces))
 
 	// Start caching the endpoint slices for the dist-scheduler service
 	namespace := os.Getenv("POD_NAMESPACE")
@@ -157,47 +222,277 @@ func Start(ctx context.Context, opts *options.Options, outOfTreeRegistryOptions
 		return nil, fmt.Errorf("POD_NAME is not set")
 	}
 	allowSolo := os.Getenv("ALLOW_SOLO") == "true"
-	schedulerSet, err := schedulerset.NewSchedulerSet(ctx, c.Client, namespace, podName, 10, allowSolo)
+	informerResync, err := dsFlags.GetDuration("informer-resync")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert informer-resync to duration: %v", err)
+	}
+	relayFanOut, err := dsFlags.GetUint32("relay-fanout")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-fanout to uint32: %v", err)
+	}
+	if relayFanOut == 0 {
+		return nil, fmt.Errorf("--relay-fanout must be positive")
+	}
+	schedulerSet, err := schedulerset.NewSchedulerSet(ctx, c.Client, namespace, podName, relayFanOut, allowSolo, informerResync)
 	if err != nil {
 		return nil, err
 	}
 
-	nodeSelector := dsFlags.Lookup("node-selector").Value.String()
+	relayTopologySettle, err := dsFlags.GetDuration("relay-topology-settle")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-topology-settle to duration: %v", err)
+	}
+	relayTopologyMaxSettle, err := dsFlags.GetDuration("relay-topology-max-settle")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-topology-max-settle to duration: %v", err)
+	}
+	schedulerSet.SetTopologyDebounce(relayTopologySettle, relayTopologyMaxSettle)
+
+	includeTerminatingMembers, err := dsFlags.GetBool("include-terminating-members")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert include-terminating-members to bool: %v", err)
+	}
+	schedulerSet.SetIncludeTerminating(includeTerminatingMembers)
+
+	schedulerSet.AddDepartureHandler(func(departed []schedulerset.EndpointItem) {
+		distpermit.EvictClients(departed)
+		evictRelayStreams(departed)
+	})
+
+	allowDebugScoringTarget, err := dsFlags.GetBool("allow-debug-scoring-target")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert allow-debug-scoring-target to bool: %v", err)
+	}
+	if allowDebugScoringTarget {
+		schedulerSet.EnableDebugScoringTarget()
+	}
+
+	grpcKeepalive, err := dsFlags.GetDuration("grpc-keepalive")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert grpc-keepalive to duration: %v", err)
+	}
+	if grpcKeepalive != 0 && grpcKeepalive < 10*time.Second {
+		return nil, fmt.Errorf("--grpc-keepalive must be at least 10s or 0")
+	}
+	util.SetGRPCKeepalive(grpcKeepalive)
+
+	grpcTLSCert := dsFlags.Lookup("grpc-tls-cert").Value.String()
+	grpcTLSKey := dsFlags.Lookup("grpc-tls-key").Value.String()
+	grpcTLSCA := dsFlags.Lookup("grpc-tls-ca").Value.String()
+	if grpcTLSCert != "" || grpcTLSKey != "" || grpcTLSCA != "" {
+		if grpcTLSCert == "" || grpcTLSKey == "" || grpcTLSCA == "" {
+			return nil, fmt.Errorf("--grpc-tls-cert, --grpc-tls-key and --grpc-tls-ca must be set together")
+		}
+		if err := util.SetGRPCTLS(grpcTLSCert, grpcTLSKey, grpcTLSCA); err != nil {
+			return nil, err
+		}
+	}
 
 	grpcAddr := dsFlags.Lookup("grpc-addr").Value.String()
-	podQueue := make(chan *v1.Pod, PodQueueSize)
-	distScheduler, err := SetupScheduler(ctx, podName, podQueue, schedulerSet, opts, c, outOfTreeRegistryOptions...)
+	grpcPort, err := util.GRPCPort(grpcAddr)
 	if err != nil {
 		return nil, err
 	}
-	StartGrpcServer(ctx, grpcAddr, schedulerSet, distScheduler)
+	// The other members listen on the same port
+	schedulerSet.SetGRPCPort(grpcPort)
 
-	// Start the webhook server
-	webhookAddr := ":8443"
-	distScheduler.webhookServer = webhook.NewWebhookServer(webhookAddr, podQueue)
-	go func() {
-		if err := distScheduler.webhookServer.Start(); err != nil {
-			klog.Error(err, "Failed to start webhook server")
+	nodeSelector := dsFlags.Lookup("node-selector").Value.String()
+
+	selfTest, err := dsFlags.GetBool("self-test")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert self-test to bool: %v", err)
+	}
+	if selfTest {
+		selfTestRecorder = selftest.NewRecorder()
+	}
+
+	podQueueSize, err := dsFlags.GetInt("pod-queue-size")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert pod-queue-size to int: %v", err)
+	}
+	if podQueueSize <= 0 {
+		return nil, fmt.Errorf("--pod-queue-size must be positive")
+	}
+	urgentQueueSize, err := dsFlags.GetInt("urgent-queue-size")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert urgent-queue-size to int: %v", err)
+	}
+	if urgentQueueSize <= 0 {
+		return nil, fmt.Errorf("--urgent-queue-size must be positive")
+	}
+	podQueue := util.NewPodQueue(podQueueSize, urgentQueueSize)
+	podQueueCapacityGauge.Set(float64(podQueueSize + urgentQueueSize))
+	distScheduler, err := SetupScheduler(ctx, podName, podQueue, schedulerSet, opts, c, outOfTreeRegistryOptions...)
+	if err != nil {
+		return nil, err
+	}
+	maxScoreEvaluators, err := dsFlags.GetInt("max-score-evaluators")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert max-score-evaluators to int: %v", err)
+	}
+	minScoreLimit, err := dsFlags.GetInt("min-score-limit")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert min-score-limit to int: %v", err)
+	}
+	scoreWindowPerTier, err := dsFlags.GetDuration("score-window-per-tier")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert score-window-per-tier to duration: %v", err)
+	}
+	if scoreWindowPerTier <= 0 {
+		return nil, fmt.Errorf("--score-window-per-tier must be positive")
+	}
+	scoreCollectionTimeout, err := dsFlags.GetDuration("score-collection-timeout")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert score-collection-timeout to duration: %v", err)
+	}
+	if scoreCollectionTimeout < 0 {
+		return nil, fmt.Errorf("--score-collection-timeout must not be negative")
+	}
+	var decisionLog *scoreevaluator.DecisionLog
+	if decisionCSV := dsFlags.Lookup("decision-csv").Value.String(); decisionCSV != "" {
+		decisionLog, err = scoreevaluator.NewDecisionLog(decisionCSV)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open decision-csv: %v", err)
 		}
-	}()
+		go func() {
+			<-ctx.Done()
+			decisionLog.Close()
+		}()
+	}
+	validationSampleRate, err := dsFlags.GetFloat64("validation-sample-rate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert validation-sample-rate to float64: %v", err)
+	}
+	if validationSampleRate < 0 || validationSampleRate > 1 {
+		return nil, fmt.Errorf("--validation-sample-rate must be between 0 and 1")
+	}
+	validator := scoreevaluator.NewValidator(validationSampleRate)
+	// Only now that SetupScheduler has synced the informer caches can relayed pods be scheduled
+	StartGrpcServer(ctx, grpcAddr, schedulerSet, distScheduler, scoreWindowPerTier, scoreCollectionTimeout, maxScoreEvaluators, minScoreLimit, decisionLog, validator)
 
 	leaderEligible, err := dsFlags.GetBool("leader-eligible")
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert leader-eligible to bool: %v", err)
 	}
+
+	// Start the webhook server, if this scheduler can become the leader the hook is pointed at
+	webhookPodSelectorStr := dsFlags.Lookup("webhook-pod-selector").Value.String()
+	webhookPodSelector, err := labels.Parse(webhookPodSelectorStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook-pod-selector: %v", err)
+	}
+	webhookClientCAFile := dsFlags.Lookup("webhook-client-ca-file").Value.String()
+	var dropWhenFull bool
+	switch queueFullPolicy := dsFlags.Lookup("queue-full-policy").Value.String(); queueFullPolicy {
+	case "block":
+	case "drop":
+		dropWhenFull = true
+	default:
+		return nil, fmt.Errorf("--queue-full-policy must be block or drop, not %q", queueFullPolicy)
+	}
+	webhookAddr := dsFlags.Lookup("webhook-addr").Value.String()
+	// The server and the endpoints the leader writes must agree on the port
+	webhookPort, err := webhook.AddrPort(webhookAddr)
+	if err != nil {
+		return nil, err
+	}
+	if ws := newWebhookServer(leaderEligible, webhookAddr, podQueue, webhookPodSelector, webhookClientCAFile, dropWhenFull); ws != nil {
+		distScheduler.webhookServer = ws
+		go func() {
+			if err := ws.Start(); err != nil {
+				klog.Error(err, "Failed to start webhook server")
+			}
+		}()
+	} else {
+		klog.Info("Not leader eligible, not starting the webhook server")
+	}
+
 	if leaderEligible {
+		electionID := dsFlags.Lookup("election-id").Value.String()
+		if err := validateElectionID(electionID); err != nil {
+			return nil, err
+		}
 		watchPods, err := dsFlags.GetBool("watch-pods")
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert watch-pods to bool: %v", err)
 		}
-		StartLeaderActivities(ctx, podName, namespace, podQueue, c.Client, schedulerSet, watchPods, nodeSelector)
+		nodePatchQPS, err := dsFlags.GetFloat32("node-patch-qps")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert node-patch-qps to float32: %v", err)
+		}
+		nodePatchBurst, err := dsFlags.GetInt("node-patch-burst")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert node-patch-burst to int: %v", err)
+		}
+		nodeLabelParallelism, err := dsFlags.GetInt("node-label-parallelism")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert node-label-parallelism to int: %v", err)
+		}
+		if nodeLabelParallelism <= 0 {
+			return nil, fmt.Errorf("--node-label-parallelism must be positive")
+		}
+		manageWebhookConfig, err := dsFlags.GetBool("manage-webhook-config")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert manage-webhook-config to bool: %v", err)
+		}
+		var webhookConfig *admissionregistrationv1.ValidatingWebhookConfiguration
+		if manageWebhookConfig {
+			caBundle, err := webhook.ReadCABundle()
+			if err != nil {
+				return nil, err
+			}
+			var objectSelector *metav1.LabelSelector
+			if webhookPodSelectorStr != "" {
+				if objectSelector, err = metav1.ParseToLabelSelector(webhookPodSelectorStr); err != nil {
+					return nil, fmt.Errorf("failed to parse webhook-pod-selector: %v", err)
+				}
+			}
+			webhookConfig = webhook.NewValidatingWebhookConfiguration(namespace, caBundle, objectSelector)
+		}
+		minMembers, err := dsFlags.GetInt("min-members-before-relay")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert min-members-before-relay to int: %v", err)
+		}
+		minMembersTimeout, err := dsFlags.GetDuration("min-members-timeout")
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert min-members-timeout to duration: %v", err)
+		}
+		nodePatchLimiter := flowcontrol.NewFakeAlwaysRateLimiter()
+		if nodePatchQPS > 0 {
+			nodePatchLimiter = flowcontrol.NewTokenBucketRateLimiter(nodePatchQPS, nodePatchBurst)
+		}
+		StartLeaderActivities(ctx, podName, namespace, electionID, podQueue, c.Client, schedulerSet, watchPods, nodeSelector, nodePatchLimiter, nodeLabelParallelism, informerResync, webhookConfig, webhookPort, minMembers, minMembersTimeout)
 	}
 
 	return distScheduler, nil
 }
 
-func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod, schedulerSet *schedulerset.SchedulerSet, opts *options.Options, c *schedulerserverconfig.Config, outOfTreeRegistryOptions ...app.Option) (*DistScheduler, error) {
-	c.InformerFactory = informers.NewSharedInformerFactory(c.Client, 0)
+// newWebhookServer returns the admission hook server for this scheduler, or nil if it can never be the hook's backend.
+// Only the leader points the webhook Service endpoints at itself, so a scheduler that is not leader eligible would
+// serve a hook nobody calls. Relay-only is not the deciding role: a separate relay Deployment is usually the
+// leader-eligible one, with the schedulers under it not eligible.
+func newWebhookServer(leaderEligible bool, addr string, podQueue *util.PodQueue, podSelector labels.Selector, clientCAFile string, dropWhenFull bool) *webhook.WebhookServer {
+	if !leaderEligible {
+		return nil
+	}
+	ws := webhook.NewWebhookServer(addr, podQueue, podSelector)
+	if clientCAFile != "" {
+		ws.RequireClientCert(clientCAFile)
+	}
+	if dropWhenFull {
+		ws.DropWhenFull()
+	}
+	return ws
+}
+
+func SetupScheduler(ctx context.Context, podName string, podQueue *util.PodQueue, schedulerSet *schedulerset.SchedulerSet, opts *options.Options, c *schedulerserverconfig.Config, outOfTreeRegistryOptions ...app.Option) (*DistScheduler, error) {
+	dsFlags := opts.Flags.FlagSet("Dist Scheduler")
+	informerResync, err := dsFlags.GetDuration("informer-resync")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert informer-resync to duration: %v", err)
+	}
+	// The factory passes informerResync as resyncPeriod to the node informer below
+	c.InformerFactory = informers.NewSharedInformerFactory(c.Client, informerResync)
 	c.InformerFactory.InformerFor(&v1.Node{}, func(cs kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
 		labelSelector := fmt.Sprintf("%s=%s", SchedulerGroupLabelKey, podName)
 		tweakListOptions := func(options *metav1.ListOptions) {
@@ -228,7 +523,7 @@ func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod,
 	})
 
 	cc := c.Complete()
-	dsFlags := opts.Flags.FlagSet("Dist Scheduler")
+	workerPool := util.NewWorkerPool()
 
 	// Start up the healthz server.
 	if cc.SecureServing != nil {
@@ -236,7 +531,7 @@ func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod,
 			return true
 		}
 		noChecks := []healthz.HealthChecker{}
-		handler := buildHandlerChain(newHealthEndpointsAndMetricsHandler(&cc.ComponentConfig, cc.InformerFactory, isLeader, noChecks, noChecks), cc.Authentication.Authenticator, cc.Authorization.Authorizer)
+		handler := buildHandlerChain(newHealthEndpointsAndMetricsHandler(&cc.ComponentConfig, cc.InformerFactory, schedulerSet, podQueue, workerPool, isLeader, noChecks, noChecks), cc.Authentication.Authenticator, cc.Authorization.Authorizer)
 		// TODO: handle stoppedCh and listenerStoppedCh returned by c.SecureServing.Serve
 		if _, _, err := cc.SecureServing.Serve(handler, 0, ctx.Done()); err != nil {
 			// fail early for secure handlers, removing the old error loop from above
@@ -249,17 +544,47 @@ func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod,
 		return nil, fmt.Errorf("failed to convert permit-always-deny to bool: %v", err)
 	}
 
+	scoreWeight, err := dsFlags.GetFloat32("score-weight")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert score-weight to float32: %v", err)
+	}
+	if scoreWeight <= 0 {
+		return nil, fmt.Errorf("--score-weight must be positive")
+	}
+
 	numConcurrentSchedulers, err := dsFlags.GetInt("num-concurrent-schedulers")
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert num-concurrent-schedulers to int: %v", err)
 	}
+	numInternalSchedulers, err := dsFlags.GetInt("num-internal-schedulers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert num-internal-schedulers to int: %v", err)
+	}
+	if numInternalSchedulers <= 0 {
+		return nil, fmt.Errorf("--num-internal-schedulers must be positive")
+	}
 	relayOnly, err := dsFlags.GetBool("relay-only")
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert relay-only to bool: %v", err)
 	}
+	relayOnlyHold, err := dsFlags.GetDuration("relay-only-hold")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-only-hold to duration: %v", err)
+	}
+	bindFailureRetries, err := dsFlags.GetInt("bind-failure-retries")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert bind-failure-retries to int: %v", err)
+	}
+	bindRetry := &bindRetrier{
+		client:       cc.Client,
+		schedulerSet: schedulerSet,
+		podQueue:     podQueue,
+		podName:      podName,
+		maxRetries:   bindFailureRetries,
+	}
 	outOfTreeRegistryOptions = append(outOfTreeRegistryOptions, func(registry frameworkruntime.Registry) error {
 		registry["DistPermit"] = func(ctx context.Context, obj runtime.Object, handle framework.Handle) (framework.Plugin, error) {
-			return distpermit.New(ctx, obj, handle, schedulerSet, alwaysDeny)
+			return distpermit.New(ctx, obj, handle, schedulerSet, alwaysDeny, scoreWeight, bindRetry.rescore)
 		}
 		return nil
 	})
@@ -278,7 +603,7 @@ func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod,
 	if relayOnly {
 		kube_scheds = []*scheduler.Scheduler{}
 	} else {
-		kube_scheds, err = scheduler.NewN(NumSchedulers, ctx,
+		kube_scheds, err = scheduler.NewN(numInternalSchedulers, ctx,
 			cc.Client,
 			cc.InformerFactory,
 			cc.DynInformerFactory,
@@ -302,10 +627,15 @@ func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod,
 			return nil, err
 		}
 		cc.InformerFactory.Start(ctx.Done())
-		cc.InformerFactory.WaitForCacheSync(ctx.Done())
+		// Relayed pods are scored against the node cache, so the gRPC server must not start before it is synced
+		for informerType, synced := range cc.InformerFactory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return nil, fmt.Errorf("failed to sync the %v informer cache", informerType)
+			}
+		}
 		go runNodeCountMetric(ctx, kube_scheds[0])
 		kube_scheds[0].FailureHandler = func(ctx context.Context, fwk framework.Framework, podInfo *framework.QueuedPodInfo, status *framework.Status, nominatingInfo *framework.NominatingInfo, start time.Time) {
-			podScheduleFailure(ctx, podInfo, status, schedulerSet)
+			podScheduleFailure(ctx, podInfo, status, schedulerSet, bindRetry)
 		}
 	}
 
@@ -322,24 +652,65 @@ func SetupScheduler(ctx context.Context, podName string, podQueue chan *v1.Pod,
 	if err := options.LogOrWriteConfig(klog.FromContext(ctx), opts.WriteConfigTo, &cc.ComponentConfig, completedProfiles); err != nil {
 		return nil, err
 	}
+	setEffectiveConfig(&cc.ComponentConfig, completedProfiles, dsFlags)
 
 	waitForSubSchedulers, err := dsFlags.GetFloat64("wait-for-subschedulers")
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert wait-for-subschedulers to float64: %v", err)
 	}
+	subSchedulerStragglers, err := dsFlags.GetInt("subscheduler-stragglers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert subscheduler-stragglers to int: %v", err)
+	}
+	depthSampleInterval, err := dsFlags.GetDuration("depth-sample-interval")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert depth-sample-interval to duration: %v", err)
+	}
+	maxPendingAge, err := dsFlags.GetDuration("max-pending-age")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert max-pending-age to duration: %v", err)
+	}
+	relayMaxReconnectFailures, err := dsFlags.GetInt("relay-max-reconnect-failures")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-max-reconnect-failures to int: %v", err)
+	}
+	relayReconnectWindow, err := dsFlags.GetDuration("relay-reconnect-window")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-reconnect-window to duration: %v", err)
+	}
+	relayDeadCooldown, err := dsFlags.GetDuration("relay-dead-cooldown")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-dead-cooldown to duration: %v", err)
+	}
+	relayStreamsPerDestination, err := dsFlags.GetInt("relay-streams-per-destination")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert relay-streams-per-destination to int: %v", err)
+	}
+	if relayStreamsPerDestination < 0 {
+		return nil, fmt.Errorf("--relay-streams-per-destination must not be negative")
+	}
 
 	parallelismGauge.Set(float64(cc.ComponentConfig.Parallelism))
 	numSchedulersGauge.Set(float64(numConcurrentSchedulers))
 	flightRecorder := traceexp.NewFlightRecorder()
 
 	return &DistScheduler{
+		podName:                 podName,
 		schedulerStack:          util.NewStack(scheds),
 		schedulers:              scheds,
 		podQueue:                podQueue,
 		schedulerSet:            schedulerSet,
 		numConcurrentSchedulers: numConcurrentSchedulers,
+		numInternalSchedulers:   numInternalSchedulers,
+		workerPool:              workerPool,
 		waitForSubSchedulers:    waitForSubSchedulers,
+		subSchedulerStragglers:  subSchedulerStragglers,
+		relayBackoff:            NewRelayBackoff(relayMaxReconnectFailures, relayReconnectWindow, relayDeadCooldown),
+		relayStreams:            newRelayStreams(relayStreamsPerDestination),
+		maxPendingAge:           maxPendingAge,
+		depthSampleInterval:     depthSampleInterval,
 		relayOnly:               relayOnly,
+		relayOnlyHold:           relayOnlyHold,
 		flightRecorder:          flightRecorder,
 		webhookServer:           nil,
 	}, nil
@@ -369,15 +740,21 @@ func getRecorderFactory(cc *schedulerserverconfig.CompletedConfig) profile.Recor
 	}
 }
 
-func podScheduleFailure(ctx context.Context, podInfo *framework.QueuedPodInfo, status *framework.Status, schedulerSet *schedulerset.SchedulerSet) {
+func podScheduleFailure(ctx context.Context, podInfo *framework.QueuedPodInfo, status *framework.Status, schedulerSet *schedulerset.SchedulerSet, bindRetry *bindRetrier) {
 	logger := klog.FromContext(ctx)
 	v4 := logger.V(4)
 	v4.Info("podScheduleFailure", "namespace", podInfo.Pod.Namespace, "pod", podInfo.Pod.Name, "status_plugin", status.Plugin())
 
-	schedulerDoneChan := ctx.Value(util.SchedulerDoneChannelKey).(chan struct{})
-	schedulerDoneChan <- struct{}{}
+	if schedulerDoneChan, ok := ctx.Value(util.SchedulerDoneChannelKey).(chan struct{}); ok {
+		schedulerDoneChan <- struct{}{}
+	} else {
+		logger.Error(nil, "podScheduleFailure called without a schedulerDoneChan in the context", "namespace", podInfo.Pod.Namespace, "pod", podInfo.Pod.Name)
+	}
 
 	if status.Plugin() == "DefaultBinder" {
+		// Only the consensus winner gets as far as binding
+		distpermit.CountNamespacePod(podInfo.Pod.Namespace, distpermit.OutcomeFailed)
+		bindRetry.handleBindFailure(podInfo.Pod)
 		return
 	}
 	err := status.AsError()
@@ -395,9 +772,12 @@ func podScheduleFailure(ctx context.Context, podInfo *framework.QueuedPodInfo, s
 	}
 
 	// If we failed prior to DistPermit, then we should send a score of 0
-	target := schedulerSet.GetTargetForScoring(fmt.Sprintf("%s/%s", podInfo.Pod.Namespace, podInfo.Pod.Name))
+	distpermit.CountNamespacePod(podInfo.Pod.Namespace, distpermit.OutcomeFailed)
+	target := schedulerSet.GetTargetForPod(podInfo.Pod)
 	v4.Info("Failed prior to DistPermit, so sending score of 0", "namespace", podInfo.Pod.Namespace, "pod", podInfo.Pod.Name, "destination_pod", target.PodName)
-	distpermit.SendScore(ctx, target, podInfo.Pod.Name, podInfo.Pod.Namespace, "", 0)
+	if _, err := distpermit.SendScore(ctx, target, podInfo.Pod.Name, podInfo.Pod.Namespace, "", 0, 0, util.ScoringRound(podInfo.Pod), ds.podName); err != nil {
+		logger.Error(err, "Failed to send score of 0", "namespace", podInfo.Pod.Namespace, "pod", podInfo.Pod.Name, "destination_pod", target.PodName)
+	}
 }
 
 type Scheduler struct {
@@ -419,15 +799,27 @@ func (s *Scheduler) NextPod(_ klog.Logger) (*framework.QueuedPodInfo, error) {
 }
 
 type DistScheduler struct {
+	podName                 string
 	schedulerStack          *util.Stack[*Scheduler]
 	schedulers              []*Scheduler
-	podQueue                chan *v1.Pod
+	podQueue                *util.PodQueue
 	schedulerSet            *schedulerset.SchedulerSet
 	numConcurrentSchedulers int
+	numInternalSchedulers   int
+	workerPool              *util.WorkerPool
 	waitForSubSchedulers    float64
-	relayOnly               bool
-	flightRecorder          *traceexp.FlightRecorder
-	webhookServer           *webhook.WebhookServer
+	subSchedulerStragglers  int
+	relayBackoff            *util.ReconnectBackoff
+	relayStreams            *relayStreams
+	// maxPendingAge is the age past which a dequeued pod is scheduled locally without consensus. 0 disables
+	maxPendingAge time.Duration
+	relayOnly     bool
+	// relayOnlyHold is how long a relay-only scheduler keeps requeuing a pod it could not relay. 0 drops it
+	relayOnlyHold time.Duration
+	// undeliveredSince maps namespace/name of each held pod to when it was first not relayed
+	undeliveredSince sync.Map
+	flightRecorder   *traceexp.FlightRecorder
+	webhookServer    *webhook.WebhookServer
 }
 
 func (ds *DistScheduler) Run(ctx context.Context) {
@@ -449,24 +841,30 @@ func (ds *DistScheduler) Run(ctx context.Context) {
 		defer ds.flightRecorder.Stop()
 	}
 
-	for i := 0; i < ds.numConcurrentSchedulers; i++ {
-		go func() {
-			for {
-				select {
-				case <-ctx.Done():
-					logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("scheduler", i)
-					logger.Info("Context done")
-					return
-				case pod := <-ds.podQueue:
-					err := ds.ProcessOne(ctx, i, pod, marshalPod(pod))
-					if err != nil {
-						logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("scheduler", i)
-						logger.Error(err, "failed to process pod", "pod", pod.Name)
-					}
-				}
-			}
-		}()
+	if ds.depthSampleInterval > 0 {
+		go ds.sampleDepths(ctx)
+	}
+
+	// Workers can be added and removed at runtime via /admin/workers, up to the number of schedulers
+	maxWorkers := len(ds.schedulers)
+	if ds.relayOnly {
+		maxWorkers = ds.numInternalSchedulers
 	}
+	ds.workerPool.Start(ctx, maxWorkers, ds.numConcurrentSchedulers, func(workerCtx context.Context, i int) {
+		// workerCtx is only for waiting on the queue. Once dequeued, the pod is processed to completion
+		pod, ok := ds.podQueue.Dequeue(workerCtx)
+		if !ok {
+			logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("scheduler", i)
+			logger.Info("Worker done")
+			return
+		}
+		err := ds.ProcessOne(ctx, i, pod, marshalPod(pod))
+		if err != nil {
+			logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("scheduler", i)
+			logger.Error(err, "failed to process pod", "pod", pod.Name)
+		}
+	})
+	numSchedulersGauge.Set(float64(ds.workerPool.Size()))
 
 	// Wait for context cancellation
 	<-ctx.Done()
@@ -479,6 +877,68 @@ func (ds *DistScheduler) Run(ctx context.Context) {
 	}
 }
 
+// sampleDepths periodically records the ingress backlog and scheduler availability until ctx is done
+func (ds *DistScheduler) sampleDepths(ctx context.Context) {
+	ticker := time.NewTicker(ds.depthSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			podQueueDepthGauge.Set(float64(ds.podQueue.Len()))
+			schedulerStackAvailableGauge.Set(float64(ds.schedulerStack.Len()))
+		}
+	}
+}
+
+// pendingTooLong reports whether the pod has exceeded maxPendingAge
+func (ds *DistScheduler) pendingTooLong(pod *v1.Pod) bool {
+	if ds.maxPendingAge <= 0 || pod.CreationTimestamp.IsZero() {
+		return false
+	}
+	return time.Since(pod.CreationTimestamp.Time) > ds.maxPendingAge
+}
+
+// forceLocal reports whether a pod that is pending too long is this scheduler's to schedule alone. Every
+// scheduler sees the pod, so exactly one of them must: its scoring target, which all of them agree on. The
+// others must not score it either, as the target runs no consensus for it to join.
+func (ds *DistScheduler) forceLocal(pod *v1.Pod) (force bool, skip bool) {
+	if !ds.pendingTooLong(pod) {
+		return false, false
+	}
+	if ds.schedulerSet.GetTargetForPod(pod).PodName != ds.podName {
+		return false, true
+	}
+	return true, false
+}
+
+// relayOnlyRetryInterval is how long a held pod waits before it is requeued
+const relayOnlyRetryInterval = time.Second
+
+// holdUndelivered requeues a pod that a relay-only scheduler could not relay to any sub-scheduler, e.g. while
+// every sub-scheduler is restarting. It can't schedule the pod itself, so the pod is dropped once it has been
+// held for relayOnlyHold.
+func (ds *DistScheduler) holdUndelivered(ctx context.Context, pod *v1.Pod) error {
+	key := pod.Namespace + "/" + pod.Name
+	first, _ := ds.undeliveredSince.LoadOrStore(key, time.Now())
+	if held := time.Since(first.(time.Time)); held >= ds.relayOnlyHold {
+		ds.undeliveredSince.Delete(key)
+		relayOnlyUndeliveredCounter.WithLabelValues("dropped").Inc()
+		return fmt.Errorf("no sub-scheduler could be sent pod %s after %v, dropping it", key, held.Round(time.Millisecond))
+	}
+	relayOnlyUndeliveredCounter.WithLabelValues("held").Inc()
+	klog.FromContext(ctx).WithName("DistScheduler").V(2).Info("No sub-scheduler could be sent pod, holding it", "namespace", pod.Namespace, "pod", pod.Name, "retry_in", relayOnlyRetryInterval)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-time.After(relayOnlyRetryInterval):
+			ds.podQueue.Enqueue(pod)
+		}
+	}()
+	return nil
+}
+
 func (ds *DistScheduler) ProcessOne(ctx context.Context, schedulerIndex int, pod *v1.Pod, getRawPod func() ([]byte, error)) error {
 	// schedulerIndex cannot be the same for two separate concurrent goroutines
 
@@ -490,11 +950,11 @@ func (ds *DistScheduler) ProcessOne(ctx context.Context, schedulerIndex int, pod
 	logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("pod", pod.Name, "scheduler", schedulerIndex)
 	v2 := logger.V(2)
 
-	doLog := pod.Name[len(pod.Name)-1] == '0' && pod.Name[len(pod.Name)-2] == '0'
+	doLog := util.ShouldSampleLog(pod.Name)
 	if doLog {
-		logger.Info("Processing pod", "queue_len", len(ds.podQueue), "available_schedulers", ds.schedulerStack.Len())
+		logger.Info("Processing pod", "queue_len", ds.podQueue.Len(), "available_schedulers", ds.schedulerStack.Len())
 	} else {
-		v2.Info("Processing pod", "queue_len", len(ds.podQueue), "available_schedulers", ds.schedulerStack.Len())
+		v2.Info("Processing pod", "queue_len", ds.podQueue.Len(), "available_schedulers", ds.schedulerStack.Len())
 	}
 
 	var wgForRelay util.CountDownLatch
@@ -503,18 +963,47 @@ func (ds *DistScheduler) ProcessOne(ctx context.Context, schedulerIndex int, pod
 		rgn := trace.StartRegion(ctx, "RelayPod")
 		timeStart := time.Now()
 		var err error
-		wgForRelay, err = RelayPod(ctx, getRawPod, ds.schedulerSet, ds.waitForSubSchedulers, schedulerIndex)
-		if err != nil {
+		wgForRelay, err = RelayPod(ctx, getRawPod, ds.schedulerSet, ds.waitForSubSchedulers, ds.subSchedulerStragglers, schedulerIndex, ds.relayStreams, ds.relayBackoff)
+		if ds.relayOnly && ((wgForRelay == nil && err == nil) || errors.Is(err, ErrNoRelayDestination)) {
+			// Nobody else will schedule the pod
+			rgn.End()
+			return ds.holdUndelivered(ctx, pod)
+		}
+		if err != nil && !errors.Is(err, ErrNoRelayDestination) {
 			return err
 		}
+		if ds.relayOnly {
+			ds.undeliveredSince.Delete(pod.Namespace + "/" + pod.Name)
+		}
 		duration := time.Since(timeStart).Seconds()
-		scheduleOneRelayCounter.Inc()
-		scheduleOneRelayTime.Add(duration)
+		if err == nil {
+			// Otherwise this scheduler is scheduling the pod alone
+			scheduleOneRelayCounter.Inc()
+			scheduleOneRelayTime.Add(duration)
+			distpermit.CountNamespacePod(pod.Namespace, distpermit.OutcomeRelayed)
+		}
 		logger.V(4).Info("RelayPod took", "time_ms", duration*1000)
 		rgn.End()
 	}
 
-	if !ds.relayOnly {
+	isMarker := selftest.IsMarker(pod)
+	if isMarker && selfTestRecorder != nil {
+		ds.reportMarker(ctx, pod)
+	}
+
+	force, skip := false, false
+	if !ds.relayOnly && !isMarker {
+		force, skip = ds.forceLocal(pod)
+		if force {
+			logger.Info("Pod pending too long, scheduling locally", "namespace", pod.Namespace, "age", time.Since(pod.CreationTimestamp.Time))
+			ctx = context.WithValue(ctx, util.ForceLocalPermitKey, true)
+		} else if skip {
+			v2.Info("Pod pending too long, leaving it to its scoring target", "namespace", pod.Namespace)
+		}
+	}
+
+	// Self-test markers are only relayed, never scheduled
+	if !ds.relayOnly && !isMarker && !skip {
 		scheduler := ds.schedulerStack.Pop()
 
 		// Now schedule the pod ourselves
@@ -7,6 +7,11 @@ import (
 	goruntime "runtime"
 	"sync"
 
+	"bchess.org/dist-scheduler/pkg/distpermit"
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/scoreevaluator"
+	"bchess.org/dist-scheduler/pkg/util"
+	"bchess.org/dist-scheduler/pkg/webhook"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	genericapifilters "k8s.io/apiserver/pkg/endpoints/filters"
@@ -57,13 +62,16 @@ func installMetricHandler(pathRecorderMux *mux.PathRecorderMux, informers inform
 // newHealthEndpointsAndMetricsHandler creates an API health server from the config, and will also
 // embed the metrics handler.
 // TODO: healthz check is deprecated, please use livez and readyz instead. Will be removed in the future.
-func newHealthEndpointsAndMetricsHandler(config *kubeschedulerconfig.KubeSchedulerConfiguration, informers informers.SharedInformerFactory, isLeader func() bool, healthzChecks, readyzChecks []healthz.HealthChecker) http.Handler {
+func newHealthEndpointsAndMetricsHandler(config *kubeschedulerconfig.KubeSchedulerConfiguration, informers informers.SharedInformerFactory, schedulerSet *schedulerset.SchedulerSet, podQueue *util.PodQueue, workerPool *util.WorkerPool, isLeader func() bool, healthzChecks, readyzChecks []healthz.HealthChecker) http.Handler {
 	pathRecorderMux := mux.NewPathRecorderMux("kube-scheduler")
 	healthz.InstallHandler(pathRecorderMux, healthzChecks...)
 	healthz.InstallLivezHandler(pathRecorderMux)
 	healthz.InstallReadyzHandler(pathRecorderMux, readyzChecks...)
 	installMetricHandler(pathRecorderMux, informers, isLeader)
 	slis.SLIMetricsWithReset{}.Install(pathRecorderMux)
+	installDebugHandlers(pathRecorderMux, schedulerSet)
+	installAdminHandlers(pathRecorderMux, podQueue, workerPool)
+	installSelfTestHandler(pathRecorderMux, podQueue, schedulerSet)
 
 	if config.EnableProfiling {
 		routes.Profiling{}.Install(pathRecorderMux)
@@ -111,6 +119,13 @@ var (
 		},
 		[]string{"destination_pod"},
 	)
+	relayDeadDestinationGauge = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_relay_dead_destination",
+			Help: "1 while a sub-scheduler is skipped for relays after repeated reconnection failures",
+		},
+		[]string{"destination_pod"},
+	)
 	scheduleOneRelayCounter = metrics.NewCounter(
 		&metrics.CounterOpts{
 			Name:           "distscheduler_schedule_one_relay_count",
@@ -152,6 +167,75 @@ var (
 			Help: "Number of nodes in the cache",
 		},
 	)
+	podQueueDepthGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_pod_queue_depth",
+			Help: "Number of pods waiting in the ingress queue",
+		},
+	)
+	podQueueCapacityGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_pod_queue_capacity",
+			Help: "Number of pods the ingress queue holds before enqueueing blocks, for the utilization of distscheduler_pod_queue_depth",
+		},
+	)
+	schedulerStackAvailableGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_scheduler_stack_available",
+			Help: "Number of schedulers available to take a pod",
+		},
+	)
+	bindFailureCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_bind_failure_count",
+			Help: "Number of binds that failed after this scheduler won the CollectScore consensus",
+		},
+	)
+	bindRetryCounter = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "distscheduler_bind_retry_count",
+			Help: "Outcomes of verifying a pod after a failed bind: retried, bound, deleted, exhausted or error",
+		},
+		[]string{"outcome"},
+	)
+	timeToQuorumGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_leader_time_to_quorum_seconds",
+			Help: "How long the leader last waited for --min-members-before-relay members before relaying pods",
+		},
+	)
+	relayOnlyUndeliveredCounter = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "distscheduler_relay_only_undelivered_count",
+			Help: "Number of times a relay-only scheduler could not relay a pod to any sub-scheduler, by whether the pod was held for --relay-only-hold or dropped",
+		},
+		[]string{"outcome"},
+	)
+	nodeLabelerWatchErrorCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_node_labeler_watch_error_count",
+			Help: "Number of failed lists and watches of nodes by the leader's node labeler. Each is retried with backoff",
+		},
+	)
+	nodeRebalanceMovesCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_node_rebalance_moves_count",
+			Help: "Number of nodes the leader's node labeler has moved to another scheduler",
+		},
+	)
+	nodeRebalanceLastMovedGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_node_rebalance_last_moved",
+			Help: "Number of nodes moved to another scheduler by the last rebalance",
+		},
+	)
+	nodeRebalanceDuration = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:    "distscheduler_node_rebalance_duration_seconds",
+			Help:    "How long each rebalance of the nodes over the schedulers took, including the label patches",
+			Buckets: metrics.ExponentialBuckets(0.1, 2, 16),
+		},
+	)
 	podRelayRecvMsgTime = metrics.NewCounterVec(
 		&metrics.CounterOpts{
 			Name:           "distscheduler_pod_relay_recv_msg_time_seconds",
@@ -178,13 +262,29 @@ func registerMetrics() {
 		legacyregistry.MustRegister(podObservedCounter)
 		legacyregistry.MustRegister(podRelayCounter)
 		legacyregistry.MustRegister(podRelayTime)
+		legacyregistry.MustRegister(relayDeadDestinationGauge)
 		legacyregistry.MustRegister(scheduleOneRelayCounter)
 		legacyregistry.MustRegister(scheduleOneRelayTime)
 		legacyregistry.MustRegister(scheduleOneCounter)
 		legacyregistry.MustRegister(scheduleOneTime)
 		legacyregistry.MustRegister(waitForSubschedulerTime)
 		legacyregistry.MustRegister(nodeCountGauge)
+		legacyregistry.MustRegister(podQueueDepthGauge)
+		legacyregistry.MustRegister(podQueueCapacityGauge)
+		legacyregistry.MustRegister(schedulerStackAvailableGauge)
+		legacyregistry.MustRegister(bindFailureCounter)
+		legacyregistry.MustRegister(bindRetryCounter)
+		legacyregistry.MustRegister(timeToQuorumGauge)
+		legacyregistry.MustRegister(nodeLabelerWatchErrorCounter)
+		legacyregistry.MustRegister(nodeRebalanceMovesCounter)
+		legacyregistry.MustRegister(nodeRebalanceLastMovedGauge)
+		legacyregistry.MustRegister(nodeRebalanceDuration)
+		legacyregistry.MustRegister(relayOnlyUndeliveredCounter)
 		legacyregistry.MustRegister(podRelayRecvMsgTime)
 		legacyregistry.MustRegister(podRelayRecvMsgInnerTime)
+		distpermit.RegisterMetrics()
+		scoreevaluator.RegisterMetrics()
+		schedulerset.RegisterMetrics()
+		webhook.RegisterMetrics()
 	})
 }
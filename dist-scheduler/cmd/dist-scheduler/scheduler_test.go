@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"testing"
+
+	"bchess.org/dist-scheduler/pkg/util"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestNewWebhookServer(t *testing.T) {
+	tests := []struct {
+		name           string
+		leaderEligible bool
+		want           bool
+	}{
+		// e.g. relay-only with --leader-eligible=false, or a scheduler under a separate relay Deployment
+		{name: "not leader eligible", leaderEligible: false, want: false},
+		// e.g. the relay Deployment, which holds the leader and so the webhook endpoints
+		{name: "leader eligible", leaderEligible: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newWebhookServer(tt.leaderEligible, ":0", util.NewPodQueue(1, 1), labels.Everything(), "", false)
+			if got := ws != nil; got != tt.want {
+				t.Errorf("newWebhookServer() started = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
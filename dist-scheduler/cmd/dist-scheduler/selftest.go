@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/distpermit"
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/selftest"
+	"bchess.org/dist-scheduler/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apiserver/pkg/server/mux"
+	"k8s.io/klog/v2"
+)
+
+// selfTestRecorder collects marker deliveries reported to this scheduler when it is the leader.
+// It is nil unless --self-test is set, and is not modified after startup.
+var selfTestRecorder *selftest.Recorder
+
+// reportMarker tells the leader that this scheduler received the marker pod
+func (ds *DistScheduler) reportMarker(ctx context.Context, pod *v1.Pod) {
+	logger := klog.FromContext(ctx).WithName("SelfTest").WithValues("pod", pod.Name)
+	leader, ok := ds.schedulerSet.GetLeaderMember()
+	if !ok {
+		logger.Error(nil, "No leader to report self-test marker to")
+		return
+	}
+	// Don't hold up relaying to sub-schedulers
+	go func() {
+		if err := distpermit.ReportMarker(context.Background(), leader, pod.Name, ds.podName); err != nil {
+			logger.Error(err, "Failed to report self-test marker", "leader", leader.PodName)
+		}
+	}()
+}
+
+// installSelfTestHandler adds an endpoint on the leader that relays count marker pods through the tree
+// and reports which schedulers did not receive each marker exactly once.
+func installSelfTestHandler(pathRecorderMux *mux.PathRecorderMux, podQueue *util.PodQueue, schedulerSet *schedulerset.SchedulerSet) {
+	pathRecorderMux.HandleFunc("/admin/selftest", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if selfTestRecorder == nil {
+			http.Error(w, "--self-test is not enabled", http.StatusServiceUnavailable)
+			return
+		}
+		if snapshot := schedulerSet.Snapshot(); snapshot.Leader != snapshot.PodName {
+			http.Error(w, "not the leader", http.StatusServiceUnavailable)
+			return
+		}
+		count := 100
+		if c := req.URL.Query().Get("count"); c != "" {
+			var err error
+			if count, err = strconv.Atoi(c); err != nil || count <= 0 {
+				http.Error(w, "invalid count", http.StatusBadRequest)
+				return
+			}
+		}
+		timeout := 10 * time.Second
+		if t := req.URL.Query().Get("timeout"); t != "" {
+			var err error
+			if timeout, err = time.ParseDuration(t); err != nil {
+				http.Error(w, "invalid timeout", http.StatusBadRequest)
+				return
+			}
+		}
+
+		members := schedulerSet.GetMembers()
+		expected := make([]string, len(members))
+		for i, m := range members {
+			expected[i] = m.PodName
+		}
+		runID := strconv.FormatInt(time.Now().UnixNano(), 36)
+		markers := selftest.NewMarkers(runID, count)
+		markerNames := make([]string, len(markers))
+		want := selfTestRecorder.Total() + len(markers)*len(expected)
+
+		klog.Infof("Self-test %s: relaying %d markers to %d schedulers", runID, count, len(expected))
+		for i, pod := range markers {
+			markerNames[i] = pod.Name
+			podQueue.Enqueue(pod)
+		}
+
+		deadline := time.Now().Add(timeout)
+		for selfTestRecorder.Total() < want && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		report := selfTestRecorder.Verify(markerNames, expected)
+		klog.Infof("Self-test %s: ok=%v missing=%d duplicated=%d unexpected=%d", runID, report.OK(), len(report.Missing), len(report.Duplicated), len(report.Unexpected))
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.OK() {
+			w.WriteHeader(http.StatusExpectationFailed)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	})
+}
@@ -4,35 +4,54 @@ package distpermit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"bchess.org/dist-scheduler/pkg/schedulerset"
 	"bchess.org/dist-scheduler/pkg/util"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
 
 	"bchess.org/dist-scheduler/pkg/podservice"
 )
 
-func New(ctx context.Context, obj runtime.Object, handle framework.Handle, schedulerSet *schedulerset.SchedulerSet, alwaysDeny bool) (framework.Plugin, error) {
+// New returns the DistPermit plugin. rescore is called with a pod whose winning node was gone by the time it was
+// permitted, to send it back for another round of scoring. It returns false if the pod was not sent back
+func New(ctx context.Context, obj runtime.Object, handle framework.Handle, schedulerSet *schedulerset.SchedulerSet, alwaysDeny bool, scoreWeight float32, rescore func(pod *v1.Pod) bool) (framework.Plugin, error) {
 	return &distPermit{
 		handle:       handle,
 		schedulerSet: schedulerSet,
 		alwaysDeny:   alwaysDeny,
+		scoreWeight:  scoreWeight,
+		nodeLister:   handle.SharedInformerFactory().Core().V1().Nodes().Lister(),
+		rescore:      rescore,
 	}, nil
 }
 
+// DefaultScore is the score sent for a node when no score plugins produced one
+const DefaultScore = 1
+
 type distPermit struct {
 	handle       framework.Handle
 	schedulerSet *schedulerset.SchedulerSet
 	alwaysDeny   bool
+	// scoreWeight is sent with every score so the CollectScore target can favor this scheduler's picks
+	scoreWeight float32
+	// sendScore is SendScore unless overridden by tests
+	sendScore func(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error)
+	// nodeLister finds this scheduler's nodes, to check a winning node is still there. nil skips the check
+	nodeLister corelisters.NodeLister
+	// rescore sends a pod back for another round of scoring, returning false if it did not
+	rescore func(pod *v1.Pod) bool
 }
 
 var _ framework.PermitPlugin = &distPermit{}
@@ -48,26 +67,88 @@ func (p *distPermit) Permit(ctx context.Context, state *framework.CycleState, po
 	logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("pod", pod.Name, "namespace", pod.Namespace, "node", nodeName)
 	v4 := logger.V(4)
 	v4.Info("Permit")
+
+	schedulerDoneChan, ok := ctx.Value(util.SchedulerDoneChannelKey).(chan struct{})
+	if !ok {
+		logger.Error(nil, "Permit called without a schedulerDoneChan in the context. Denying permit")
+		return framework.NewStatus(framework.Unschedulable, "Missing schedulerDoneChan").WithPlugin("DistPermit"), 0
+	}
+
+	if force, _ := ctx.Value(util.ForceLocalPermitKey).(bool); force {
+		// Pending too long for the distributed consensus, take the best node we found ourselves
+		schedulerDoneChan <- struct{}{}
+		forceLocalPermitCounter.Inc()
+		CountNamespacePod(pod.Namespace, OutcomeScheduled)
+		logger.Info("Permit forced locally")
+		return framework.NewStatus(framework.Success, "DistPermit"), 0
+	}
+
+	nodeScore, found := int64(0), false
 	nodePluginScores, err := state.Read(framework.NodePluginScoresStateKey)
 	if err != nil {
-		logger.Error(err, "Failed to read node plugin scores")
-		return framework.NewStatus(framework.Error, "Failed to read node plugin scores"), 0
+		// No score plugins ran, e.g. the profile has none enabled. The node passed filtering, so give it
+		// a constant score and still take part in consensus.
+		v4.Info("No node plugin scores, using default score", "score", DefaultScore)
+		nodeScore, found = DefaultScore, true
 	}
-	nodePluginScoresState := nodePluginScores.(*framework.NodePluginScoresState)
 
-	target := p.schedulerSet.GetTargetForScoring(fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+	target := p.schedulerSet.GetTargetForPod(pod)
 
-	schedulerDoneChan := ctx.Value(util.SchedulerDoneChannelKey).(chan struct{})
 	schedulerDoneChan <- struct{}{}
 
-	for _, nodePluginScore := range nodePluginScoresState.NodePluginScores {
-		if nodePluginScore.Name == nodeName {
-			permit := SendScore(ctx, target, pod.Name, pod.Namespace, nodeName, nodePluginScore.TotalScore)
-			if permit {
-				v4.Info("Permit approved")
-				return framework.NewStatus(framework.Success, "DistPermit"), 0
+	if err == nil {
+		for _, nodePluginScore := range nodePluginScores.(*framework.NodePluginScoresState).NodePluginScores {
+			nodeScoreDistribution.Observe(float64(nodePluginScore.TotalScore))
+			if nodePluginScore.Name == nodeName {
+				nodeScore, found = nodePluginScore.TotalScore, true
 			}
-			break
+		}
+	}
+
+	if found {
+		sendScore := p.sendScore
+		if sendScore == nil {
+			sendScore = SendScore
+		}
+		response, err := sendScore(ctx, target, pod.Name, pod.Namespace, nodeName, nodeScore, p.scoreWeight, util.ScoringRound(pod), p.schedulerSet.PodName())
+		if errors.Is(err, ErrTargetUnreachable) {
+			collectScoreUnreachableCounter.Inc()
+			// Only re-target once the target has left the membership, which every scheduler sees alike. Whether
+			// it is reachable can differ between schedulers, and scores split over two targets pick two winners.
+			if !p.schedulerSet.IsMember(target.PodName) {
+				if retarget := p.schedulerSet.GetTargetForPod(pod); retarget.PodName != target.PodName {
+					logger.Info("Score target left, retrying on the new target", "destination_pod", target.PodName, "new_destination_pod", retarget.PodName)
+					response, err = sendScore(ctx, retarget, pod.Name, pod.Namespace, nodeName, nodeScore, p.scoreWeight, util.ScoringRound(pod), p.schedulerSet.PodName())
+					if errors.Is(err, ErrTargetUnreachable) {
+						collectScoreUnreachableCounter.Inc()
+					}
+				}
+			}
+			if errors.Is(err, ErrTargetUnreachable) {
+				v4.Info("Permit rejected, score target unreachable", "destination_pod", target.PodName)
+				return framework.NewStatus(framework.Unschedulable, "CollectScore target unreachable").WithPlugin("DistPermit"), 0
+			}
+		}
+		if response.GetPermit() && !p.nodeUsable(nodeName) {
+			// Deleted or gone NotReady while the scores were being collected
+			return p.nodeGone(logger, pod, nodeName, response.GetRunnerUpNodes()), 0
+		}
+		if response.GetPermit() {
+			v4.Info("Permit approved")
+			CountNamespacePod(pod.Namespace, OutcomeScheduled)
+			if p.schedulerSet.Solo() {
+				soloScheduleCounter.Inc()
+			}
+			return framework.NewStatus(framework.Success, "DistPermit"), 0
+		}
+		if err == nil {
+			collectScoreRejectedCounter.Inc()
+		}
+		if winner := response.GetWinningNode(); winner != "" {
+			// Targets older than the winner fields leave them empty
+			v4.Info("Permit rejected", "winner", winner, "winning_score", response.GetWinningScore())
+			msg := fmt.Sprintf("Rejected by CollectScore: lost to node %s with score %d", winner, response.GetWinningScore())
+			return framework.NewStatus(framework.Unschedulable, msg).WithPlugin("DistPermit"), 0
 		}
 	}
 
@@ -75,47 +156,209 @@ func (p *distPermit) Permit(ctx context.Context, state *framework.CycleState, po
 	return framework.NewStatus(framework.Unschedulable, "Rejected by CollectScore").WithPlugin("DistPermit"), 0 // reject
 }
 
+// nodeUsable reports whether nodeName, one of this scheduler's nodes, still exists and is not NotReady
+func (p *distPermit) nodeUsable(nodeName string) bool {
+	if p.nodeLister == nil {
+		return true
+	}
+	node, err := p.nodeLister.Get(nodeName)
+	return err == nil && nodeReady(node)
+}
+
+// nodeReady reports whether node can take pods: not being deleted, and not NotReady. A node that has not
+// reported a Ready condition yet counts as ready.
+func nodeReady(node *v1.Node) bool {
+	if node.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return true
+}
+
+// nodeGone handles the winning nodeName turning out to be gone. The runner-ups belong to other schedulers, and
+// binding to one from here would skip its owner's Filter, Reserve and PreBind. So if there is a runner-up the pod
+// is sent back for another round of scoring instead, which the gone node takes no part in.
+func (p *distPermit) nodeGone(logger klog.Logger, pod *v1.Pod, nodeName string, runnerUps []string) *framework.Status {
+	CountNamespacePod(pod.Namespace, OutcomeFailed)
+	if len(runnerUps) == 0 {
+		logger.Info("Winning node is gone and no other node was feasible")
+		runnerUpFallbackCounter.WithLabelValues("none").Inc()
+		return framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Node %s is gone and no other node was feasible", nodeName)).WithPlugin("DistPermit")
+	}
+	if !p.rescore(pod) {
+		logger.Info("Winning node is gone and the pod can't be sent back for scoring", "runner_ups", runnerUps)
+		runnerUpFallbackCounter.WithLabelValues("failed").Inc()
+		return framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Node %s is gone and the pod was not sent back for scoring", nodeName)).WithPlugin("DistPermit")
+	}
+	logger.Info("Winning node is gone, sending pod back for scoring", "runner_ups", runnerUps)
+	runnerUpFallbackCounter.WithLabelValues("rescored").Inc()
+	return framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Node %s is gone, sent back for scoring", nodeName)).WithPlugin("DistPermit")
+}
+
+// cachedClient is a connection to a member, dialed on addr
+type cachedClient struct {
+	addr string
+	conn *grpc.ClientConn
+	// lock guards scores and unary
+	lock sync.Mutex
+	// scores is the CollectScoreStream to the member, dialed on first use and again after it ends
+	scores *scoreStream
+	// unary is set once the member turns out not to implement CollectScoreStream, so each score is a CollectScore call
+	unary bool
+}
+
+// collectScore sends score to the member over its CollectScoreStream, or with CollectScore if it predates the
+// stream. Without wait the response is nil. A score sent without wait before an old member is known to be one is lost
+func (c *cachedClient) collectScore(ctx context.Context, score *podservice.SchedulingScore, wait bool) (*podservice.ScheduleResponse, error) {
+	c.lock.Lock()
+	if !c.unary && (c.scores == nil || c.scores.ended()) {
+		scores, err := newScoreStream(c.conn)
+		if err != nil {
+			c.lock.Unlock()
+			return nil, err
+		}
+		c.scores = scores
+	}
+	scores, unary := c.scores, c.unary
+	c.lock.Unlock()
+
+	if unary {
+		client := podservice.NewPodServiceClient(c.conn)
+		if !wait {
+			go client.CollectScore(ctx, score)
+			return nil, nil
+		}
+		return client.CollectScore(ctx, score)
+	}
+	response, err := scores.collectScore(ctx, score, wait)
+	if err != nil && scores.ended() && status.Code(scores.err) == codes.Unimplemented {
+		klog.V(2).Infof("Member at %s does not implement CollectScoreStream, falling back to CollectScore", c.addr)
+		c.lock.Lock()
+		c.unary = true
+		c.lock.Unlock()
+		return c.collectScore(ctx, score, wait)
+	}
+	return response, err
+}
+
 var clientCacheLock sync.Mutex
-var clientCache = make(map[string]*grpc.ClientConn)
 
-func SendScore(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64) bool {
-	logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("destination_pod", target.PodName, "destination_addresses", target.Addresses, "pod", podName, "namespace", namespace, "node", nodeName, "score", score)
-	addr := util.GRPCAddress(target.Addresses[0], "50051") // TODO: do not hard-code port
+// clientCache is keyed by the member's pod name, as a new pod can take over the address of one that's gone
+var clientCache = make(map[string]*cachedClient)
 
+// EvictClients closes and forgets the cached connections to departed members
+func EvictClients(departed []schedulerset.EndpointItem) {
 	clientCacheLock.Lock()
-	conn, ok := clientCache[addr]
+	defer clientCacheLock.Unlock()
+	for _, member := range departed {
+		if cached, ok := clientCache[member.PodName]; ok {
+			klog.V(2).Infof("Closing score connection to departed member %s at %s", member.PodName, cached.addr)
+			cached.conn.Close()
+			delete(clientCache, member.PodName)
+		}
+	}
+}
+
+const (
+	// shedRetries is how many times SendScore retries a score the target shed because it was evaluating
+	// too many pods already. Only new pods are shed, so a retry joins the evaluation once another
+	// scheduler's score for the pod has been admitted
+	shedRetries = 3
+	// shedRetryBackoff is the wait before the first retry of a shed score, doubling on each retry
+	shedRetryBackoff = 100 * time.Millisecond
+)
+
+// getClient returns the cached connection to target, dialing it if there is none
+func getClient(target schedulerset.EndpointItem) (*cachedClient, error) {
+	addr := target.GRPCAddress()
+	clientCacheLock.Lock()
+	defer clientCacheLock.Unlock()
+	cached, ok := clientCache[target.PodName]
+	if ok && cached.addr != addr {
+		// The member moved before its departure was seen
+		cached.conn.Close()
+		ok = false
+	}
 	if !ok {
-		var err error
-		conn, err = grpc.NewClient(
-			addr,
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
-		)
+		conn, err := grpc.NewClient(addr, util.GRPCDialOptions()...)
 		if err != nil {
-			logger.Error(err, "SendScore: did not connect. Denying permit")
-			return false
+			delete(clientCache, target.PodName)
+			return nil, err
 		}
-		clientCache[addr] = conn
+		cached = &cachedClient{addr: addr, conn: conn}
+		clientCache[target.PodName] = cached
+	}
+	return cached, nil
+}
+
+// ReportMarker tells target, the leader, that scheduler received the self-test marker pod
+func ReportMarker(ctx context.Context, target schedulerset.EndpointItem, marker string, scheduler string) error {
+	cached, err := getClient(target)
+	if err != nil {
+		return err
+	}
+	_, err = podservice.NewPodServiceClient(cached.conn).ReportMarker(ctx, &podservice.MarkerReport{Marker: marker, Scheduler: scheduler})
+	return err
+}
+
+// ErrTargetUnreachable is returned by SendScore when the score could not be delivered to the target,
+// as opposed to the target rejecting it.
+var ErrTargetUnreachable = errors.New("score target unreachable")
+
+// SendScore sends score for nodeName to target's CollectScore. A weight of 0 is treated as 1 by the target.
+// round is the pod's util.ScoringRound, and from the pod name of this scheduler.
+// The response is nil without a nodeName, whose rejection is known without waiting for the target.
+func SendScore(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error) {
+	logger := klog.FromContext(ctx).WithName("DistScheduler").WithValues("destination_pod", target.PodName, "destination_addresses", target.Addresses, "pod", podName, "namespace", namespace, "node", nodeName, "score", score)
+	cached, err := getClient(target)
+	if err != nil {
+		logger.Error(err, "SendScore: did not connect")
+		return nil, fmt.Errorf("%w: %w", ErrTargetUnreachable, err)
 	}
-	clientCacheLock.Unlock()
 
-	client := podservice.NewPodServiceClient(conn)
 	request := &podservice.SchedulingScore{
 		PodName:   podName,
 		Namespace: namespace,
 		NodeName:  nodeName,
 		Score:     int32(score),
+		Weight:    weight,
+		Round:     round,
+		Scheduler: from,
 	}
 	logger.V(4).Info("Sending to CollectScore")
-	if score == 0 {
-		// If score is 0 we don't need the response, we know it's a rejection
-		go client.CollectScore(ctx, request)
-		return false
+	if nodeName == "" {
+		// Without a node we don't need the response, we know it's a rejection
+		cached.collectScore(ctx, request, false)
+		return nil, nil
+	}
+	response, err := cached.collectScore(ctx, request, true)
+	backoff := shedRetryBackoff
+	for attempt := 0; attempt < shedRetries && status.Code(err) == codes.ResourceExhausted; attempt++ {
+		logger.V(4).Info("Score shed by target, retrying", "attempt", attempt+1, "backoff", backoff)
+		collectScoreShedRetryCounter.Inc()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		response, err = cached.collectScore(ctx, request, true)
 	}
-	response, err := client.CollectScore(ctx, request)
 	if err != nil {
-		logger.Error(err, "could not send score. Denying permit")
-		return false
+		logger.Error(err, "could not send score")
+		if status.Code(err) == codes.Unavailable {
+			return nil, fmt.Errorf("%w: %w", ErrTargetUnreachable, err)
+		}
+		return nil, err
+	}
+	v := logger.V(4)
+	if util.ShouldSampleLog(podName) {
+		v = logger.V(0)
 	}
-	logger.V(4).Info("CollectScore response", "permit", response.Permit)
-	return response.Permit
+	v.Info("CollectScore response", "permit", response.Permit, "winner", response.WinningNode, "winning_score", response.WinningScore)
+	return response, nil
 }
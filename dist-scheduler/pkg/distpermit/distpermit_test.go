@@ -0,0 +1,493 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package distpermit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/podservice"
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"bchess.org/dist-scheduler/pkg/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func TestPermitWithoutSchedulerDoneChan(t *testing.T) {
+	p := &distPermit{}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+
+	status, _ := p.Permit(context.Background(), framework.NewCycleState(), pod, "node-1")
+	if status.Code() != framework.Unschedulable {
+		t.Errorf("Permit() code = %v, want %v", status.Code(), framework.Unschedulable)
+	}
+	if status.Plugin() != "DistPermit" {
+		t.Errorf("Permit() plugin = %q, want DistPermit", status.Plugin())
+	}
+}
+
+func TestPermitWrongSchedulerDoneChanType(t *testing.T) {
+	p := &distPermit{}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, "not a channel")
+
+	status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+	if status.Code() != framework.Unschedulable {
+		t.Errorf("Permit() code = %v, want %v", status.Code(), framework.Unschedulable)
+	}
+}
+
+func TestPermitForceLocal(t *testing.T) {
+	p := &distPermit{}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	schedulerDoneChan := make(chan struct{}, 1)
+	ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, schedulerDoneChan)
+	ctx = context.WithValue(ctx, util.ForceLocalPermitKey, true)
+
+	// No node plugin scores and no schedulerSet: forced Permits must not need either
+	status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+	if !status.IsSuccess() {
+		t.Errorf("Permit() code = %v, want %v", status.Code(), framework.Success)
+	}
+	if len(schedulerDoneChan) != 1 {
+		t.Errorf("Permit() did not signal schedulerDoneChan")
+	}
+}
+
+func TestPermitWithoutNodePluginScores(t *testing.T) {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-1", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.1"}}})
+
+	var sentScore int64 = -1
+	var sentWeight float32
+	p := &distPermit{
+		schedulerSet: ss,
+		scoreWeight:  2,
+		sendScore: func(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error) {
+			sentScore, sentWeight = score, weight
+			return &podservice.ScheduleResponse{Permit: true, WinningNode: nodeName, WinningScore: int32(score)}, nil
+		},
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, make(chan struct{}, 1))
+
+	// A profile without score plugins never writes NodePluginScoresStateKey
+	status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+	if !status.IsSuccess() {
+		t.Errorf("Permit() code = %v, want %v", status.Code(), framework.Success)
+	}
+	if sentScore != DefaultScore {
+		t.Errorf("sent score = %d, want %d", sentScore, DefaultScore)
+	}
+	if sentWeight != 2 {
+		t.Errorf("sent weight = %v, want 2", sentWeight)
+	}
+}
+
+// soloSchedules reads distscheduler_solo_schedule_count from the registry
+func soloSchedules(t *testing.T) float64 {
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "distscheduler_solo_schedule_count" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestPermitCountsSolo(t *testing.T) {
+	RegisterMetrics()
+	permit := func(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error) {
+		return &podservice.ScheduleResponse{Permit: true, WinningNode: nodeName, WinningScore: int32(score)}, nil
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+
+	tests := []struct {
+		name    string
+		members []schedulerset.EndpointItem
+		want    float64
+	}{
+		{
+			name: "solo",
+			want: 1,
+		},
+		{
+			name: "with members",
+			members: []schedulerset.EndpointItem{
+				{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.1"}},
+				{PodName: "dist-scheduler-2", Addresses: []string{"10.0.0.2"}},
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-1", 10, true, 0)
+			if err != nil {
+				t.Fatalf("NewSchedulerSet() error = %v", err)
+			}
+			if tt.members != nil {
+				ss.SetMembersForTest(tt.members)
+			}
+			p := &distPermit{schedulerSet: ss, sendScore: permit}
+			ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, make(chan struct{}, 1))
+
+			before := soloSchedules(t)
+			status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+			if !status.IsSuccess() {
+				t.Fatalf("Permit() code = %v, want %v", status.Code(), framework.Success)
+			}
+			if got := soloSchedules(t) - before; got != tt.want {
+				t.Errorf("solo schedules counted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermitLostReportsWinner(t *testing.T) {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-1", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.1"}}})
+
+	tests := []struct {
+		name     string
+		response *podservice.ScheduleResponse
+		want     string
+	}{
+		{
+			name:     "winner reported",
+			response: &podservice.ScheduleResponse{WinningNode: "node-2", WinningScore: 80},
+			want:     "Rejected by CollectScore: lost to node node-2 with score 80",
+		},
+		{
+			name:     "target without winner fields",
+			response: &podservice.ScheduleResponse{},
+			want:     "Rejected by CollectScore",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &distPermit{
+				schedulerSet: ss,
+				sendScore: func(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error) {
+					return tt.response, nil
+				},
+			}
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+			ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, make(chan struct{}, 1))
+
+			status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+			if status.Code() != framework.Unschedulable {
+				t.Errorf("Permit() code = %v, want %v", status.Code(), framework.Unschedulable)
+			}
+			if status.Message() != tt.want {
+				t.Errorf("Permit() message = %q, want %q", status.Message(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPermitRescoresWhenNodeGone(t *testing.T) {
+	RegisterMetrics()
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-1", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest([]schedulerset.EndpointItem{{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.1"}}})
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	// node-1 won, but was deleted before the scores came back, so the lister no longer has it
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	var runnerUps []string
+	var rescored []*v1.Pod
+	canRescore := true
+
+	p := &distPermit{
+		schedulerSet: ss,
+		nodeLister:   corelisters.NewNodeLister(nodes),
+		rescore: func(pod *v1.Pod) bool {
+			if !canRescore {
+				return false
+			}
+			rescored = append(rescored, pod)
+			return true
+		},
+		sendScore: func(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error) {
+			return &podservice.ScheduleResponse{Permit: true, WinningNode: nodeName, WinningScore: int32(score), RunnerUpNodes: runnerUps}, nil
+		},
+	}
+	ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, make(chan struct{}, 1))
+
+	// Without another feasible node there is nothing to score again for
+	status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+	if status.Code() != framework.Unschedulable || status.Plugin() != "DistPermit" {
+		t.Errorf("Permit() = %v from %q, want Unschedulable from DistPermit so the framework does not bind to node-1", status.Code(), status.Plugin())
+	}
+	if len(rescored) != 0 {
+		t.Errorf("rescored %d pods without runner-ups, want 0", len(rescored))
+	}
+
+	// The runner-ups belong to other schedulers, so the pod is scored again rather than bound to one from here
+	runnerUps = []string{"node-2", "node-3"}
+	status, _ = p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+	if status.Code() != framework.Unschedulable || status.Plugin() != "DistPermit" {
+		t.Errorf("Permit() = %v from %q, want Unschedulable from DistPermit so the framework does not bind to node-1", status.Code(), status.Plugin())
+	}
+	if len(rescored) != 1 || rescored[0].Name != "pod-1" {
+		t.Errorf("rescored %v, want pod-1", rescored)
+	}
+	if want := "Node node-1 is gone, sent back for scoring"; status.Message() != want {
+		t.Errorf("Permit() message = %q, want %q", status.Message(), want)
+	}
+
+	// With rescoring disabled the pod is failed, and not reported as sent back
+	canRescore = false
+	status, _ = p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+	if want := "Node node-1 is gone and the pod was not sent back for scoring"; status.Code() != framework.Unschedulable || status.Message() != want {
+		t.Errorf("Permit() = %v %q, want Unschedulable %q", status.Code(), status.Message(), want)
+	}
+	canRescore = true
+
+	// Once the winning node is back, Permit lets the framework bind as usual
+	if err := nodes.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1"); !status.IsSuccess() {
+		t.Errorf("Permit() code = %v, want %v", status.Code(), framework.Success)
+	}
+	if len(rescored) != 1 {
+		t.Errorf("rescored %d pods, want still 1", len(rescored))
+	}
+}
+
+func TestPermitUnreachableTarget(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"}}
+	members := []schedulerset.EndpointItem{
+		{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.1"}},
+		{PodName: "dist-scheduler-2", Addresses: []string{"10.0.0.2"}},
+	}
+
+	tests := []struct {
+		name string
+		// left is whether the unreachable target has also left the membership
+		left        bool
+		wantSuccess bool
+		wantSends   int
+	}{
+		{
+			name:      "target still a member",
+			wantSends: 1,
+		},
+		{
+			name:        "target left",
+			left:        true,
+			wantSuccess: true,
+			wantSends:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-1", 10, false, 0)
+			if err != nil {
+				t.Fatalf("NewSchedulerSet() error = %v", err)
+			}
+			ss.SetMembersForTest(members)
+
+			var sentTo []string
+			p := &distPermit{
+				schedulerSet: ss,
+				sendScore: func(ctx context.Context, target schedulerset.EndpointItem, podName string, namespace string, nodeName string, score int64, weight float32, round uint32, from string) (*podservice.ScheduleResponse, error) {
+					sentTo = append(sentTo, target.PodName)
+					if len(sentTo) > 1 {
+						return &podservice.ScheduleResponse{Permit: true, WinningNode: nodeName, WinningScore: int32(score)}, nil
+					}
+					if tt.left {
+						for _, m := range members {
+							if m.PodName != target.PodName {
+								ss.SetMembersForTest([]schedulerset.EndpointItem{m})
+							}
+						}
+					}
+					return nil, fmt.Errorf("%w: connection refused", ErrTargetUnreachable)
+				},
+			}
+			ctx := context.WithValue(context.Background(), util.SchedulerDoneChannelKey, make(chan struct{}, 1))
+
+			status, _ := p.Permit(ctx, framework.NewCycleState(), pod, "node-1")
+			if status.IsSuccess() != tt.wantSuccess {
+				t.Errorf("Permit() code = %v, want success %v", status.Code(), tt.wantSuccess)
+			}
+			if len(sentTo) != tt.wantSends {
+				t.Fatalf("scores sent to %v, want %d sends", sentTo, tt.wantSends)
+			}
+			if tt.left && sentTo[1] == sentTo[0] {
+				t.Errorf("score resent to %s, which left", sentTo[1])
+			}
+		})
+	}
+}
+
+// shedOnceServer sheds the first shed scores it receives, then permits
+type shedOnceServer struct {
+	podservice.UnimplementedPodServiceServer
+	shed  int
+	calls int
+}
+
+func (s *shedOnceServer) CollectScore(ctx context.Context, score *podservice.SchedulingScore) (*podservice.ScheduleResponse, error) {
+	s.calls++
+	if s.calls <= s.shed {
+		return nil, status.Error(codes.ResourceExhausted, "too many in-flight score evaluators")
+	}
+	return &podservice.ScheduleResponse{Permit: true, WinningNode: score.NodeName, WinningScore: score.Score}, nil
+}
+
+func TestSendScoreRetriesShed(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	server := &shedOnceServer{shed: 2}
+	s := grpc.NewServer()
+	podservice.RegisterPodServiceServer(s, server)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	target := schedulerset.EndpointItem{PodName: "dist-scheduler-1", Addresses: []string{"127.0.0.1"}, Port: port}
+	response, err := SendScore(context.Background(), target, "pod-1", "default", "node-1", 50, 1, 0, "dist-scheduler-1")
+	if err != nil {
+		t.Fatalf("SendScore() error = %v", err)
+	}
+	if !response.GetPermit() {
+		t.Errorf("SendScore() permit = false, want true after the shed scores were retried")
+	}
+	if server.calls != 3 {
+		t.Errorf("CollectScore calls = %d, want 3", server.calls)
+	}
+
+	// A target that keeps shedding is given up on
+	server.calls, server.shed = 0, 100
+	if _, err := SendScore(context.Background(), target, "pod-2", "default", "node-1", 50, 1, 0, "dist-scheduler-1"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("SendScore() error = %v, want ResourceExhausted", err)
+	}
+	if server.calls != shedRetries+1 {
+		t.Errorf("CollectScore calls = %d, want %d", server.calls, shedRetries+1)
+	}
+}
+
+// streamServer answers CollectScoreStream, permitting every score, and counts the streams opened
+type streamServer struct {
+	podservice.UnimplementedPodServiceServer
+	streams atomic.Int32
+	scores  atomic.Int32
+}
+
+func (s *streamServer) CollectScoreStream(stream grpc.BidiStreamingServer[podservice.CollectScoreRequest, podservice.CollectScoreResponse]) error {
+	s.streams.Add(1)
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		s.scores.Add(1)
+		if req.Score.NodeName == "" {
+			// A rejection fails, which its sender doesn't wait to see
+			err = stream.Send(&podservice.CollectScoreResponse{RequestId: req.RequestId, ErrorCode: uint32(codes.Internal), ErrorMessage: "rejected"})
+		} else {
+			err = stream.Send(&podservice.CollectScoreResponse{RequestId: req.RequestId, Response: &podservice.ScheduleResponse{
+				Permit:       true,
+				WinningNode:  req.Score.NodeName,
+				WinningScore: req.Score.Score,
+			}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestSendScoreStream(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	server := &streamServer{}
+	s := grpc.NewServer()
+	podservice.RegisterPodServiceServer(s, server)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	target := schedulerset.EndpointItem{PodName: "dist-scheduler-stream", Addresses: []string{"127.0.0.1"}, Port: port}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			node := fmt.Sprintf("node-%d", i)
+			response, err := SendScore(context.Background(), target, fmt.Sprintf("pod-%d", i), "default", node, 50, 1, 0, "dist-scheduler-1")
+			if err != nil {
+				t.Errorf("SendScore() error = %v", err)
+				return
+			}
+			// Each answer must reach the call it belongs to
+			if response.GetWinningNode() != node {
+				t.Errorf("SendScore() winner = %q, want %q", response.GetWinningNode(), node)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if response, err := SendScore(context.Background(), target, "pod-0", "default", "", 0, 1, 0, "dist-scheduler-1"); response != nil || err != nil {
+		t.Errorf("SendScore() without a node = %v, %v, want nil, nil", response, err)
+	}
+	if got := server.streams.Load(); got != 1 {
+		t.Errorf("CollectScoreStream streams = %d, want 1", got)
+	}
+
+	// A stream that ends is redialed
+	s.Stop()
+	lis, err = net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	s = grpc.NewServer()
+	podservice.RegisterPodServiceServer(s, server)
+	go s.Serve(lis)
+	defer s.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		// The first score after the restart may go to the ended stream
+		if _, err := SendScore(ctx, target, "pod-1", "default", "node-1", 50, 1, 0, "dist-scheduler-1"); err == nil {
+			break
+		} else if ctx.Err() != nil {
+			t.Fatalf("SendScore() error = %v after the target restarted", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := server.streams.Load(); got != 2 {
+		t.Errorf("CollectScoreStream streams = %d, want 2", got)
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package distpermit
+
+import (
+	"sync"
+
+	"bchess.org/dist-scheduler/pkg/util"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	nodeScoreDistribution = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:    "distscheduler_node_score_distribution",
+			Help:    "TotalScore of every scored node seen by Permit. A narrow distribution means placement is near-random",
+			Buckets: metrics.LinearBuckets(0, 25, 41),
+		},
+	)
+	collectScoreRejectedCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_collect_score_rejected_count",
+			Help: "Number of Permits rejected because another node won the score consensus",
+		},
+	)
+	collectScoreUnreachableCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_collect_score_unreachable_count",
+			Help: "Number of times a score could not be delivered to its CollectScore target",
+		},
+	)
+	forceLocalPermitCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_force_local_permit_count",
+			Help: "Number of pods permitted without CollectScore because they exceeded --max-pending-age",
+		},
+	)
+	collectScoreShedRetryCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_collect_score_shed_retry_count",
+			Help: "Number of times a score was resent because the CollectScore target was at --max-score-evaluators",
+		},
+	)
+	soloScheduleCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_solo_schedule_count",
+			Help: "Number of Permits approved while this scheduler had no other members and decided alone (ALLOW_SOLO)",
+		},
+	)
+	runnerUpFallbackCounter = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "distscheduler_runner_up_fallback_count",
+			Help: "Number of Permits whose winning node was gone, by result: rescored, failed when the pod could not be sent back for scoring, e.g. with --bind-failure-retries=0, or none when no other node was feasible",
+		},
+		[]string{"result"},
+	)
+	namespacePodCounter = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "distscheduler_namespace_pod_count",
+			Help: "Number of pods scheduled, failed or relayed by this scheduler, by namespace. Namespaces not in --tenant-namespaces are counted as \"other\"",
+		},
+		[]string{"namespace", "outcome"},
+	)
+	once sync.Once
+
+	// tenantNamespaces buckets the namespace label of namespacePodCounter
+	tenantNamespaces *util.NamespaceBuckets
+)
+
+// Outcomes counted by CountNamespacePod
+const (
+	OutcomeScheduled = "scheduled"
+	OutcomeFailed    = "failed"
+	OutcomeRelayed   = "relayed"
+)
+
+func RegisterMetrics() {
+	once.Do(func() {
+		legacyregistry.MustRegister(nodeScoreDistribution)
+		legacyregistry.MustRegister(collectScoreRejectedCounter)
+		legacyregistry.MustRegister(collectScoreUnreachableCounter)
+		legacyregistry.MustRegister(forceLocalPermitCounter)
+		legacyregistry.MustRegister(collectScoreShedRetryCounter)
+		legacyregistry.MustRegister(namespacePodCounter)
+		legacyregistry.MustRegister(soloScheduleCounter)
+		legacyregistry.MustRegister(runnerUpFallbackCounter)
+	})
+}
+
+// SetTenantNamespaces sets the namespaces CountNamespacePod labels by name. Call before scheduling starts.
+func SetTenantNamespaces(namespaces *util.NamespaceBuckets) {
+	tenantNamespaces = namespaces
+}
+
+// CountNamespacePod counts a pod in namespace with outcome
+func CountNamespacePod(namespace string, outcome string) {
+	namespacePodCounter.WithLabelValues(tenantNamespaces.Bucket(namespace), outcome).Inc()
+}
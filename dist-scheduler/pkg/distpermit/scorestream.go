@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package distpermit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"bchess.org/dist-scheduler/pkg/podservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scoreStream multiplexes the CollectScore calls to one member over a CollectScoreStream, matching each answer to
+// its call by request id like the relay's NewPod stream
+type scoreStream struct {
+	stream grpc.BidiStreamingClient[podservice.CollectScoreRequest, podservice.CollectScoreResponse]
+	// sendLock serializes Send, which is not safe to call concurrently
+	sendLock sync.Mutex
+	// pending maps a request id to the chan *podservice.CollectScoreResponse its caller waits on
+	pending       sync.Map
+	nextRequestId atomic.Uint32
+	// done is closed when the stream has ended, after err is set
+	done chan struct{}
+	err  error
+}
+
+func newScoreStream(conn *grpc.ClientConn) (*scoreStream, error) {
+	stream, err := podservice.NewPodServiceClient(conn).CollectScoreStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s := &scoreStream{
+		stream: stream,
+		done:   make(chan struct{}),
+	}
+	go s.receiverLoop()
+	return s, nil
+}
+
+func (s *scoreStream) receiverLoop() {
+	for {
+		msg, err := s.stream.Recv()
+		if err != nil {
+			s.err = err
+			close(s.done)
+			return
+		}
+		if answer, ok := s.pending.LoadAndDelete(msg.RequestId); ok {
+			answer.(chan *podservice.CollectScoreResponse) <- msg
+		}
+	}
+}
+
+// ended reports whether the stream has ended, so it must not be reused
+func (s *scoreStream) ended() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// collectScore is CollectScore over the stream. Without wait, the score is sent without waiting for the answer
+// and the response is nil
+func (s *scoreStream) collectScore(ctx context.Context, score *podservice.SchedulingScore, wait bool) (*podservice.ScheduleResponse, error) {
+	requestId := s.nextRequestId.Add(1)
+	var answer chan *podservice.CollectScoreResponse
+	if wait {
+		answer = make(chan *podservice.CollectScoreResponse, 1)
+		s.pending.Store(requestId, answer)
+		defer s.pending.Delete(requestId)
+	}
+	s.sendLock.Lock()
+	err := s.stream.Send(&podservice.CollectScoreRequest{RequestId: requestId, Score: score})
+	s.sendLock.Unlock()
+	if err != nil {
+		// Send fails with io.EOF once the stream has ended, the reason comes from Recv
+		select {
+		case <-s.done:
+			return nil, s.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if !wait {
+		return nil, nil
+	}
+	select {
+	case msg := <-answer:
+		if msg.ErrorCode != uint32(codes.OK) {
+			return nil, status.Error(codes.Code(msg.ErrorCode), msg.ErrorMessage)
+		}
+		return msg.Response, nil
+	case <-s.done:
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
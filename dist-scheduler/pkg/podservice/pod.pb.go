@@ -127,7 +127,12 @@ type ScheduleResponse struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Permit bool `protobuf:"varint,1,opt,name=permit,proto3" json:"permit,omitempty"`
+	Permit       bool   `protobuf:"varint,1,opt,name=permit,proto3" json:"permit,omitempty"`
+	WinningNode  string `protobuf:"bytes,2,opt,name=winning_node,json=winningNode,proto3" json:"winning_node,omitempty"`
+	WinningScore int32  `protobuf:"varint,3,opt,name=winning_score,json=winningScore,proto3" json:"winning_score,omitempty"`
+	// The next best nodes after winning_node, best first, for the winner to fall back to if its node is gone.
+	// Only sent to the winner. Empty for old targets
+	RunnerUpNodes []string `protobuf:"bytes,4,rep,name=runner_up_nodes,json=runnerUpNodes,proto3" json:"runner_up_nodes,omitempty"`
 }
 
 func (x *ScheduleResponse) Reset() {
@@ -167,15 +172,42 @@ func (x *ScheduleResponse) GetPermit() bool {
 	return false
 }
 
+func (x *ScheduleResponse) GetWinningNode() string {
+	if x != nil {
+		return x.WinningNode
+	}
+	return ""
+}
+
+func (x *ScheduleResponse) GetWinningScore() int32 {
+	if x != nil {
+		return x.WinningScore
+	}
+	return 0
+}
+
+func (x *ScheduleResponse) GetRunnerUpNodes() []string {
+	if x != nil {
+		return x.RunnerUpNodes
+	}
+	return nil
+}
+
 type SchedulingScore struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	PodName   string `protobuf:"bytes,1,opt,name=podName,proto3" json:"podName,omitempty"`
-	Namespace string `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
-	NodeName  string `protobuf:"bytes,3,opt,name=nodeName,proto3" json:"nodeName,omitempty"`
-	Score     int32  `protobuf:"varint,4,opt,name=score,proto3" json:"score,omitempty"`
+	PodName   string  `protobuf:"bytes,1,opt,name=podName,proto3" json:"podName,omitempty"`
+	Namespace string  `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	NodeName  string  `protobuf:"bytes,3,opt,name=nodeName,proto3" json:"nodeName,omitempty"`
+	Score     int32   `protobuf:"varint,4,opt,name=score,proto3" json:"score,omitempty"`
+	Weight    float32 `protobuf:"fixed32,5,opt,name=weight,proto3" json:"weight,omitempty"`
+	// The pod's round of scoring, one more each time it is sent back to be scored again. Scores of a later
+	// round than the one a winner was decided in start a new round rather than arriving late
+	Round uint32 `protobuf:"varint,6,opt,name=round,proto3" json:"round,omitempty"`
+	// The pod name of the scheduler that sent the score. Empty for old schedulers
+	Scheduler string `protobuf:"bytes,7,opt,name=scheduler,proto3" json:"scheduler,omitempty"`
 }
 
 func (x *SchedulingScore) Reset() {
@@ -236,6 +268,244 @@ func (x *SchedulingScore) GetScore() int32 {
 	return 0
 }
 
+func (x *SchedulingScore) GetWeight() float32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *SchedulingScore) GetRound() uint32 {
+	if x != nil {
+		return x.Round
+	}
+	return 0
+}
+
+func (x *SchedulingScore) GetScheduler() string {
+	if x != nil {
+		return x.Scheduler
+	}
+	return ""
+}
+
+// One CollectScore call on a CollectScoreStream
+type CollectScoreRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RequestId uint32           `protobuf:"fixed32,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Score     *SchedulingScore `protobuf:"bytes,2,opt,name=score,proto3" json:"score,omitempty"`
+}
+
+func (x *CollectScoreRequest) Reset() {
+	*x = CollectScoreRequest{}
+	mi := &file_pod_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CollectScoreRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollectScoreRequest) ProtoMessage() {}
+
+func (x *CollectScoreRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pod_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollectScoreRequest.ProtoReflect.Descriptor instead.
+func (*CollectScoreRequest) Descriptor() ([]byte, []int) {
+	return file_pod_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CollectScoreRequest) GetRequestId() uint32 {
+	if x != nil {
+		return x.RequestId
+	}
+	return 0
+}
+
+func (x *CollectScoreRequest) GetScore() *SchedulingScore {
+	if x != nil {
+		return x.Score
+	}
+	return nil
+}
+
+// The answer to the CollectScoreRequest with the same request_id
+type CollectScoreResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RequestId uint32            `protobuf:"fixed32,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Response  *ScheduleResponse `protobuf:"bytes,2,opt,name=response,proto3" json:"response,omitempty"`
+	// The gRPC status code and message CollectScore failed with. 0 (OK) if response is set
+	ErrorCode    uint32 `protobuf:"varint,3,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	ErrorMessage string `protobuf:"bytes,4,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+}
+
+func (x *CollectScoreResponse) Reset() {
+	*x = CollectScoreResponse{}
+	mi := &file_pod_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CollectScoreResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollectScoreResponse) ProtoMessage() {}
+
+func (x *CollectScoreResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pod_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollectScoreResponse.ProtoReflect.Descriptor instead.
+func (*CollectScoreResponse) Descriptor() ([]byte, []int) {
+	return file_pod_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CollectScoreResponse) GetRequestId() uint32 {
+	if x != nil {
+		return x.RequestId
+	}
+	return 0
+}
+
+func (x *CollectScoreResponse) GetResponse() *ScheduleResponse {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *CollectScoreResponse) GetErrorCode() uint32 {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return 0
+}
+
+func (x *CollectScoreResponse) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+// A scheduler reporting to the leader that it received a self-test marker pod
+type MarkerReport struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The marker pod's name
+	Marker string `protobuf:"bytes,1,opt,name=marker,proto3" json:"marker,omitempty"`
+	// The pod name of the scheduler that received it
+	Scheduler string `protobuf:"bytes,2,opt,name=scheduler,proto3" json:"scheduler,omitempty"`
+}
+
+func (x *MarkerReport) Reset() {
+	*x = MarkerReport{}
+	mi := &file_pod_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarkerReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarkerReport) ProtoMessage() {}
+
+func (x *MarkerReport) ProtoReflect() protoreflect.Message {
+	mi := &file_pod_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarkerReport.ProtoReflect.Descriptor instead.
+func (*MarkerReport) Descriptor() ([]byte, []int) {
+	return file_pod_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *MarkerReport) GetMarker() string {
+	if x != nil {
+		return x.Marker
+	}
+	return ""
+}
+
+func (x *MarkerReport) GetScheduler() string {
+	if x != nil {
+		return x.Scheduler
+	}
+	return ""
+}
+
+type MarkerReportResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *MarkerReportResponse) Reset() {
+	*x = MarkerReportResponse{}
+	mi := &file_pod_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarkerReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarkerReportResponse) ProtoMessage() {}
+
+func (x *MarkerReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pod_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarkerReportResponse.ProtoReflect.Descriptor instead.
+func (*MarkerReportResponse) Descriptor() ([]byte, []int) {
+	return file_pod_proto_rawDescGZIP(), []int{7}
+}
+
 var File_pod_proto protoreflect.FileDescriptor
 
 var file_pod_proto_rawDesc = []byte{
@@ -251,29 +521,75 @@ var file_pod_proto_rawDesc = []byte{
 	0x64, 0x52, 0x03, 0x70, 0x6f, 0x64, 0x22, 0x2f, 0x0a, 0x0e, 0x4e, 0x65, 0x77, 0x50, 0x6f, 0x64,
 	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75,
 	0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x07, 0x52, 0x09, 0x72, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x22, 0x2a, 0x0a, 0x10, 0x53, 0x63, 0x68, 0x65, 0x64,
-	0x75, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x70,
-	0x65, 0x72, 0x6d, 0x69, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x70, 0x65, 0x72,
-	0x6d, 0x69, 0x74, 0x22, 0x7b, 0x0a, 0x0f, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x69, 0x6e,
-	0x67, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x6f, 0x64, 0x4e, 0x61, 0x6d,
-	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x6f, 0x64, 0x4e, 0x61, 0x6d, 0x65,
-	0x12, 0x1c, 0x0a, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x1a,
-	0x0a, 0x08, 0x6e, 0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x08, 0x6e, 0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63,
-	0x6f, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65,
-	0x32, 0x9c, 0x01, 0x0a, 0x0a, 0x50, 0x6f, 0x64, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12,
-	0x43, 0x0a, 0x06, 0x4e, 0x65, 0x77, 0x50, 0x6f, 0x64, 0x12, 0x19, 0x2e, 0x70, 0x6f, 0x64, 0x73,
-	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x4e, 0x65, 0x77, 0x50, 0x6f, 0x64, 0x52, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x2e, 0x4e, 0x65, 0x77, 0x50, 0x6f, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x28, 0x01, 0x30, 0x01, 0x12, 0x49, 0x0a, 0x0c, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x53,
-	0x63, 0x6f, 0x72, 0x65, 0x12, 0x1b, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x2e, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x69, 0x6e, 0x67, 0x53, 0x63, 0x6f, 0x72,
-	0x65, 0x1a, 0x1c, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53,
-	0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42,
-	0x10, 0x5a, 0x0e, 0x70, 0x6b, 0x67, 0x2f, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x22, 0x9a, 0x01, 0x0a, 0x10, 0x53, 0x63, 0x68, 0x65,
+	0x64, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06,
+	0x70, 0x65, 0x72, 0x6d, 0x69, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x70, 0x65,
+	0x72, 0x6d, 0x69, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x77, 0x69, 0x6e, 0x6e, 0x69, 0x6e, 0x67, 0x5f,
+	0x6e, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x77, 0x69, 0x6e, 0x6e,
+	0x69, 0x6e, 0x67, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x77, 0x69, 0x6e, 0x6e, 0x69,
+	0x6e, 0x67, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c,
+	0x77, 0x69, 0x6e, 0x6e, 0x69, 0x6e, 0x67, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x26, 0x0a, 0x0f,
+	0x72, 0x75, 0x6e, 0x6e, 0x65, 0x72, 0x5f, 0x75, 0x70, 0x5f, 0x6e, 0x6f, 0x64, 0x65, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x72, 0x75, 0x6e, 0x6e, 0x65, 0x72, 0x55, 0x70, 0x4e,
+	0x6f, 0x64, 0x65, 0x73, 0x22, 0xc7, 0x01, 0x0a, 0x0f, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
+	0x69, 0x6e, 0x67, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x6f, 0x64, 0x4e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x6f, 0x64, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x6e, 0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x6e, 0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x73, 0x63, 0x6f,
+	0x72, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x02, 0x52, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f,
+	0x75, 0x6e, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64,
+	0x12, 0x1c, 0x0a, 0x09, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x22, 0x67,
+	0x0a, 0x13, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x07, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x49, 0x64, 0x12, 0x31, 0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
+	0x2e, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x69, 0x6e, 0x67, 0x53, 0x63, 0x6f, 0x72, 0x65,
+	0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x22, 0xb3, 0x01, 0x0a, 0x14, 0x43, 0x6f, 0x6c, 0x6c,
+	0x65, 0x63, 0x74, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x07, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12,
+	0x38, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1c, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53,
+	0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52,
+	0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x65,
+	0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x65, 0x72, 0x72, 0x6f,
+	0x72, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0c, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x44, 0x0a,
+	0x0c, 0x4d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x16, 0x0a,
+	0x06, 0x6d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6d,
+	0x61, 0x72, 0x6b, 0x65, 0x72, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
+	0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75,
+	0x6c, 0x65, 0x72, 0x22, 0x16, 0x0a, 0x14, 0x4d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x52, 0x65, 0x70,
+	0x6f, 0x72, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0xc5, 0x02, 0x0a, 0x0a,
+	0x50, 0x6f, 0x64, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x43, 0x0a, 0x06, 0x4e, 0x65,
+	0x77, 0x50, 0x6f, 0x64, 0x12, 0x19, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x2e, 0x4e, 0x65, 0x77, 0x50, 0x6f, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1a, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x4e, 0x65, 0x77,
+	0x50, 0x6f, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01, 0x12,
+	0x49, 0x0a, 0x0c, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x12,
+	0x1b, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x63, 0x68,
+	0x65, 0x64, 0x75, 0x6c, 0x69, 0x6e, 0x67, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x1a, 0x1c, 0x2e, 0x70,
+	0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75,
+	0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x5b, 0x0a, 0x12, 0x43, 0x6f,
+	0x6c, 0x6c, 0x65, 0x63, 0x74, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x12, 0x1f, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x43, 0x6f,
+	0x6c, 0x6c, 0x65, 0x63, 0x74, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x20, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x43,
+	0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01, 0x12, 0x4a, 0x0a, 0x0c, 0x52, 0x65, 0x70, 0x6f, 0x72,
+	0x74, 0x4d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x12, 0x18, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x2e, 0x4d, 0x61, 0x72, 0x6b, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6f, 0x72,
+	0x74, 0x1a, 0x20, 0x2e, 0x70, 0x6f, 0x64, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x4d,
+	0x61, 0x72, 0x6b, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x42, 0x10, 0x5a, 0x0e, 0x70, 0x6b, 0x67, 0x2f, 0x70, 0x6f, 0x64, 0x73, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -288,25 +604,35 @@ func file_pod_proto_rawDescGZIP() []byte {
 	return file_pod_proto_rawDescData
 }
 
-var file_pod_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_pod_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_pod_proto_goTypes = []any{
-	(*NewPodRequest)(nil),    // 0: podservice.NewPodRequest
-	(*NewPodResponse)(nil),   // 1: podservice.NewPodResponse
-	(*ScheduleResponse)(nil), // 2: podservice.ScheduleResponse
-	(*SchedulingScore)(nil),  // 3: podservice.SchedulingScore
-	(*v1.Pod)(nil),           // 4: k8s.io.api.core.v1.Pod
+	(*NewPodRequest)(nil),        // 0: podservice.NewPodRequest
+	(*NewPodResponse)(nil),       // 1: podservice.NewPodResponse
+	(*ScheduleResponse)(nil),     // 2: podservice.ScheduleResponse
+	(*SchedulingScore)(nil),      // 3: podservice.SchedulingScore
+	(*CollectScoreRequest)(nil),  // 4: podservice.CollectScoreRequest
+	(*CollectScoreResponse)(nil), // 5: podservice.CollectScoreResponse
+	(*MarkerReport)(nil),         // 6: podservice.MarkerReport
+	(*MarkerReportResponse)(nil), // 7: podservice.MarkerReportResponse
+	(*v1.Pod)(nil),               // 8: k8s.io.api.core.v1.Pod
 }
 var file_pod_proto_depIdxs = []int32{
-	4, // 0: podservice.NewPodRequest.pod:type_name -> k8s.io.api.core.v1.Pod
-	0, // 1: podservice.PodService.NewPod:input_type -> podservice.NewPodRequest
-	3, // 2: podservice.PodService.CollectScore:input_type -> podservice.SchedulingScore
-	1, // 3: podservice.PodService.NewPod:output_type -> podservice.NewPodResponse
-	2, // 4: podservice.PodService.CollectScore:output_type -> podservice.ScheduleResponse
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	8, // 0: podservice.NewPodRequest.pod:type_name -> k8s.io.api.core.v1.Pod
+	3, // 1: podservice.CollectScoreRequest.score:type_name -> podservice.SchedulingScore
+	2, // 2: podservice.CollectScoreResponse.response:type_name -> podservice.ScheduleResponse
+	0, // 3: podservice.PodService.NewPod:input_type -> podservice.NewPodRequest
+	3, // 4: podservice.PodService.CollectScore:input_type -> podservice.SchedulingScore
+	4, // 5: podservice.PodService.CollectScoreStream:input_type -> podservice.CollectScoreRequest
+	6, // 6: podservice.PodService.ReportMarker:input_type -> podservice.MarkerReport
+	1, // 7: podservice.PodService.NewPod:output_type -> podservice.NewPodResponse
+	2, // 8: podservice.PodService.CollectScore:output_type -> podservice.ScheduleResponse
+	5, // 9: podservice.PodService.CollectScoreStream:output_type -> podservice.CollectScoreResponse
+	7, // 10: podservice.PodService.ReportMarker:output_type -> podservice.MarkerReportResponse
+	7, // [7:11] is the sub-list for method output_type
+	3, // [3:7] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_pod_proto_init() }
@@ -320,7 +646,7 @@ func file_pod_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_pod_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -22,8 +22,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	PodService_NewPod_FullMethodName       = "/podservice.PodService/NewPod"
-	PodService_CollectScore_FullMethodName = "/podservice.PodService/CollectScore"
+	PodService_NewPod_FullMethodName             = "/podservice.PodService/NewPod"
+	PodService_CollectScore_FullMethodName       = "/podservice.PodService/CollectScore"
+	PodService_CollectScoreStream_FullMethodName = "/podservice.PodService/CollectScoreStream"
+	PodService_ReportMarker_FullMethodName       = "/podservice.PodService/ReportMarker"
 )
 
 // PodServiceClient is the client API for PodService service.
@@ -32,6 +34,9 @@ const (
 type PodServiceClient interface {
 	NewPod(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[NewPodRequest, NewPodResponse], error)
 	CollectScore(ctx context.Context, in *SchedulingScore, opts ...grpc.CallOption) (*ScheduleResponse, error)
+	// CollectScore for many pods multiplexed over one stream, answered in any order
+	CollectScoreStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CollectScoreRequest, CollectScoreResponse], error)
+	ReportMarker(ctx context.Context, in *MarkerReport, opts ...grpc.CallOption) (*MarkerReportResponse, error)
 }
 
 type podServiceClient struct {
@@ -65,12 +70,38 @@ func (c *podServiceClient) CollectScore(ctx context.Context, in *SchedulingScore
 	return out, nil
 }
 
+func (c *podServiceClient) CollectScoreStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CollectScoreRequest, CollectScoreResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PodService_ServiceDesc.Streams[1], PodService_CollectScoreStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CollectScoreRequest, CollectScoreResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PodService_CollectScoreStreamClient = grpc.BidiStreamingClient[CollectScoreRequest, CollectScoreResponse]
+
+func (c *podServiceClient) ReportMarker(ctx context.Context, in *MarkerReport, opts ...grpc.CallOption) (*MarkerReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MarkerReportResponse)
+	err := c.cc.Invoke(ctx, PodService_ReportMarker_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PodServiceServer is the server API for PodService service.
 // All implementations must embed UnimplementedPodServiceServer
 // for forward compatibility.
 type PodServiceServer interface {
 	NewPod(grpc.BidiStreamingServer[NewPodRequest, NewPodResponse]) error
 	CollectScore(context.Context, *SchedulingScore) (*ScheduleResponse, error)
+	// CollectScore for many pods multiplexed over one stream, answered in any order
+	CollectScoreStream(grpc.BidiStreamingServer[CollectScoreRequest, CollectScoreResponse]) error
+	ReportMarker(context.Context, *MarkerReport) (*MarkerReportResponse, error)
 	mustEmbedUnimplementedPodServiceServer()
 }
 
@@ -87,6 +118,12 @@ func (UnimplementedPodServiceServer) NewPod(grpc.BidiStreamingServer[NewPodReque
 func (UnimplementedPodServiceServer) CollectScore(context.Context, *SchedulingScore) (*ScheduleResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CollectScore not implemented")
 }
+func (UnimplementedPodServiceServer) CollectScoreStream(grpc.BidiStreamingServer[CollectScoreRequest, CollectScoreResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CollectScoreStream not implemented")
+}
+func (UnimplementedPodServiceServer) ReportMarker(context.Context, *MarkerReport) (*MarkerReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportMarker not implemented")
+}
 func (UnimplementedPodServiceServer) mustEmbedUnimplementedPodServiceServer() {}
 func (UnimplementedPodServiceServer) testEmbeddedByValue()                    {}
 
@@ -133,6 +170,31 @@ func _PodService_CollectScore_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PodService_CollectScoreStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PodServiceServer).CollectScoreStream(&grpc.GenericServerStream[CollectScoreRequest, CollectScoreResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PodService_CollectScoreStreamServer = grpc.BidiStreamingServer[CollectScoreRequest, CollectScoreResponse]
+
+func _PodService_ReportMarker_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MarkerReport)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PodServiceServer).ReportMarker(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PodService_ReportMarker_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PodServiceServer).ReportMarker(ctx, req.(*MarkerReport))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PodService_ServiceDesc is the grpc.ServiceDesc for PodService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -144,6 +206,10 @@ var PodService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CollectScore",
 			Handler:    _PodService_CollectScore_Handler,
 		},
+		{
+			MethodName: "ReportMarker",
+			Handler:    _PodService_ReportMarker_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -152,6 +218,12 @@ var PodService_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "CollectScoreStream",
+			Handler:       _PodService_CollectScoreStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "pod.proto",
 }
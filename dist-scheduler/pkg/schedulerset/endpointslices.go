@@ -5,8 +5,14 @@ package schedulerset
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"bchess.org/dist-scheduler/pkg/util"
+	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
@@ -19,11 +25,43 @@ import (
 type EndpointSliceCache struct {
 	sync.RWMutex
 	slices map[string]*discoveryv1.EndpointSlice
+	// includeTerminating counts terminating endpoints that are still serving as members
+	includeTerminating bool
+	// port is stamped on every member
+	port string
+	// members is every member across the slices, sorted by pod name. Rebuilt on every change, and never modified
+	members []EndpointItem
+	// version identifies this build of members, so that orderings derived from them can be cached
+	version uint64
+	// departureHandlers are called by rebuild with the members that departed
+	departureHandlers []func(departed []EndpointItem)
 }
 
+// memberVersions numbers every build of members across all caches, so that a replaced cache isn't mistaken for
+// the one it replaced
+var memberVersions atomic.Uint64
+
 type EndpointItem struct {
-	PodName   string
-	Addresses []string
+	PodName   string   `json:"podName"`
+	Addresses []string `json:"addresses"`
+	// Port is the gRPC port of the member. Empty is util.DefaultGRPCPort
+	Port string `json:"port,omitempty"`
+}
+
+// GRPCAddress is the address to dial the member's gRPC server on
+func (e EndpointItem) GRPCAddress() string {
+	port := e.Port
+	if port == "" {
+		port = util.DefaultGRPCPort
+	}
+	return util.GRPCAddress(e.Addresses[0], port)
+}
+
+// EndpointSliceSnapshot is a copy of one cached EndpointSlice, for debugging.
+type EndpointSliceSnapshot struct {
+	Name       string                 `json:"name"`
+	Generation int64                  `json:"generation"`
+	Endpoints  []discoveryv1.Endpoint `json:"endpoints"`
 }
 
 func (e EndpointItem) String() string {
@@ -37,11 +75,53 @@ func NewEndpointSliceCache() *EndpointSliceCache {
 	}
 }
 
+// NewEndpointSliceCacheFromMembers creates an EndpointSliceCache holding a single EndpointSlice
+// with one ready endpoint per member. Intended for tests and benchmarks.
+func NewEndpointSliceCacheFromMembers(members []EndpointItem) *EndpointSliceCache {
+	endpoints := make([]discoveryv1.Endpoint, len(members))
+	for i, member := range members {
+		endpoints[i] = discoveryv1.Endpoint{
+			Addresses: member.Addresses,
+			Conditions: discoveryv1.EndpointConditions{
+				Ready: &[]bool{true}[0],
+			},
+			TargetRef: &corev1.ObjectReference{
+				Kind: "Pod",
+				Name: member.PodName,
+			},
+		}
+	}
+	esc := NewEndpointSliceCache()
+	esc.Update(&discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "members"},
+		Endpoints:  endpoints,
+	})
+	return esc
+}
+
 // Update inserts or updates an EndpointSlice in the cache.
 func (esc *EndpointSliceCache) Update(ess *discoveryv1.EndpointSlice) {
 	esc.Lock()
 	key := ess.Name // Assumes EndpointSlice names are unique within the namespace.
 	esc.slices[key] = ess.DeepCopy()
+	esc.rebuild()
+	esc.Unlock()
+}
+
+// SetIncludeTerminating sets whether endpoints that are terminating, but still serving, are members.
+// Otherwise they stop being relayed pods and expected to score as soon as they start terminating.
+func (esc *EndpointSliceCache) SetIncludeTerminating(include bool) {
+	esc.Lock()
+	esc.includeTerminating = include
+	esc.rebuild()
+	esc.Unlock()
+}
+
+// SetPort sets the gRPC port stamped on every member
+func (esc *EndpointSliceCache) SetPort(port string) {
+	esc.Lock()
+	esc.port = port
+	esc.rebuild()
 	esc.Unlock()
 }
 
@@ -50,52 +130,151 @@ func (esc *EndpointSliceCache) Delete(ess *discoveryv1.EndpointSlice) {
 	esc.Lock()
 	key := ess.Name
 	delete(esc.slices, key)
+	esc.rebuild()
 	esc.Unlock()
 }
 
+// AddDepartureHandler calls handler with the members that left, or that came back on a different address, each
+// time the members are rebuilt. It is called with the cache locked, before anything can read the new members, so it
+// must not call back into the cache
+func (esc *EndpointSliceCache) AddDepartureHandler(handler func(departed []EndpointItem)) {
+	esc.Lock()
+	defer esc.Unlock()
+	esc.departureHandlers = append(esc.departureHandlers, handler)
+}
+
 func (esc *EndpointSliceCache) GetMemberCount() int {
 	esc.RLock()
 	defer esc.RUnlock()
-	count := 0
-	for _, slice := range esc.slices {
-		count += len(slice.Endpoints)
-	}
-	return count
+	return len(esc.members)
 }
 
-// GetMembers returns a slice of all IP addresses across the cached EndpointSlices.
-func (esc *EndpointSliceCache) GetMembers() []EndpointItem {
-	esc.RLock()
-	defer esc.RUnlock()
+// rebuild recomputes members from the slices. A pod listed in more than one slice, as can happen while the
+// EndpointSlice controller moves it between them, is a member once. Must be called with the lock held
+func (esc *EndpointSliceCache) rebuild() {
+	names := make([]string, 0, len(esc.slices))
+	for name := range esc.slices {
+		names = append(names, name)
+	}
+	// Which slice a duplicate is taken from doesn't change between calls
+	slices.Sort(names)
 
 	var members []EndpointItem
-	for _, slice := range esc.slices {
-		for _, endpoint := range slice.Endpoints {
+	for _, name := range names {
+		for _, endpoint := range esc.slices[name].Endpoints {
+			if !esc.isMember(endpoint) {
+				continue
+			}
 			// Each endpoint may have multiple IP addresses.
 			members = append(members, EndpointItem{
 				PodName:   endpoint.TargetRef.Name,
 				Addresses: endpoint.Addresses,
+				Port:      esc.port,
 			})
 		}
 	}
+	slices.SortStableFunc(members, func(a, b EndpointItem) int {
+		return strings.Compare(a.PodName, b.PodName)
+	})
+	previous := esc.members
+	esc.members = slices.CompactFunc(members, func(a, b EndpointItem) bool {
+		return a.PodName == b.PodName
+	})
+	esc.version = memberVersions.Add(1)
+	if departed := departedMembers(previous, esc.members); len(departed) > 0 {
+		for _, handler := range esc.departureHandlers {
+			handler(departed)
+		}
+	}
+}
+
+// departedMembers returns the members of previous that are not in current with the same addresses and port
+func departedMembers(previous []EndpointItem, current []EndpointItem) []EndpointItem {
+	byPodName := make(map[string]EndpointItem, len(current))
+	for _, member := range current {
+		byPodName[member.PodName] = member
+	}
+	var departed []EndpointItem
+	for _, member := range previous {
+		now, ok := byPodName[member.PodName]
+		if !ok || now.Port != member.Port || !slices.Equal(now.Addresses, member.Addresses) {
+			departed = append(departed, member)
+		}
+	}
+	return departed
+}
+
+// isMember reports whether endpoint is a scheduler pod that will take part. Members are known by pod name, so an
+// endpoint without a TargetRef, e.g. one added by hand, is left out. So is one that is not ready, as it won't send
+// the scores the others wait for. A terminating pod is not ready, but is kept with includeTerminating while it is
+// still serving. Must be called with the lock held
+func (esc *EndpointSliceCache) isMember(endpoint discoveryv1.Endpoint) bool {
+	if endpoint.TargetRef == nil {
+		return false
+	}
+	conditions := endpoint.Conditions
+	if conditions.Terminating != nil && *conditions.Terminating {
+		// Ready is false once terminating, unless the Service publishes not-ready addresses
+		return esc.includeTerminating && (conditions.Serving == nil || *conditions.Serving)
+	}
+	// Unset means ready
+	return conditions.Ready == nil || *conditions.Ready
+}
+
+// Snapshot returns a copy of every cached EndpointSlice, sorted by name.
+func (esc *EndpointSliceCache) Snapshot() []EndpointSliceSnapshot {
+	esc.RLock()
+	defer esc.RUnlock()
+
+	snapshot := make([]EndpointSliceSnapshot, 0, len(esc.slices))
+	for _, slice := range esc.slices {
+		endpoints := make([]discoveryv1.Endpoint, len(slice.Endpoints))
+		for i := range slice.Endpoints {
+			slice.Endpoints[i].DeepCopyInto(&endpoints[i])
+		}
+		snapshot = append(snapshot, EndpointSliceSnapshot{
+			Name:       slice.Name,
+			Generation: slice.Generation,
+			Endpoints:  endpoints,
+		})
+	}
+	slices.SortFunc(snapshot, func(a, b EndpointSliceSnapshot) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return snapshot
+}
+
+// GetMembers returns every member across the cached EndpointSlices, sorted by pod name.
+// The slice is shared and must not be modified.
+func (esc *EndpointSliceCache) GetMembers() []EndpointItem {
+	members, _ := esc.getMembers()
 	return members
 }
 
+// getMembers is GetMembers and the version of the members, which changes whenever they do
+func (esc *EndpointSliceCache) getMembers() ([]EndpointItem, uint64) {
+	esc.RLock()
+	defer esc.RUnlock()
+	return esc.members, esc.version
+}
+
 // RunEndpointSliceWatcher sets up an informer that watches for EndpointSlice objects
 // associated with the "dist-scheduler" Service in the given namespace.
 // It updates the global endpointSliceCache with adds, updates and deletes.
+// A non-zero resync re-applies every cached EndpointSlice on that period.
 func RunEndpointSliceWatcher(
 	ctx context.Context,
 	cs kubernetes.Interface,
 	namespace string,
 	serviceName string,
+	resync time.Duration,
 ) (*EndpointSliceCache, cache.SharedIndexInformer) {
 	tweakListOptions := func(options *metav1.ListOptions) {
 		options.LabelSelector = fmt.Sprintf("kubernetes.io/service-name=%s", serviceName)
 	}
 
 	endpointSliceCache := NewEndpointSliceCache()
-	informer := discoveryinformers.NewFilteredEndpointSliceInformer(cs, namespace, 0, cache.Indexers{}, tweakListOptions)
+	informer := discoveryinformers.NewFilteredEndpointSliceInformer(cs, namespace, resync, cache.Indexers{}, tweakListOptions)
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -106,12 +285,15 @@ func RunEndpointSliceWatcher(
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			var generation int64
+			var resourceVersion string
 			if oldEss, ok := oldObj.(*discoveryv1.EndpointSlice); ok {
 				generation = oldEss.Generation
+				resourceVersion = oldEss.ResourceVersion
 			}
 			if newEss, ok := newObj.(*discoveryv1.EndpointSlice); ok {
 				// Why do we get updates on the same generation?
-				if generation != newEss.Generation {
+				// An unchanged ResourceVersion is a periodic resync, which is applied to correct any drift
+				if generation != newEss.Generation || resourceVersion == newEss.ResourceVersion {
 					klog.Infof("EndpointSlice updated: %s/%s", newEss.Namespace, newEss.Name)
 					endpointSliceCache.Update(newEss)
 				}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package schedulerset
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	topologyRecomputeCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_relay_topology_recompute_count",
+			Help: "Number of times this scheduler recomputed its relay sub-members after a membership or leader change",
+		},
+	)
+	once sync.Once
+)
+
+func RegisterMetrics() {
+	once.Do(func() {
+		legacyregistry.MustRegister(topologyRecomputeCounter)
+	})
+}
@@ -11,7 +11,9 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -19,7 +21,8 @@ import (
 )
 
 type SchedulerSet struct {
-	endpointSliceCache *EndpointSliceCache
+	// endpointSliceCache is swapped by SetMembersForTest while the set is in use
+	endpointSliceCache atomic.Pointer[EndpointSliceCache]
 	informer           cache.SharedIndexInformer
 	podName            string
 	fanOut             uint32
@@ -28,37 +31,123 @@ type SchedulerSet struct {
 	leader             string
 	dirty              atomic.Bool
 	allowSolo          bool
+	// solo is the last result of Solo(), to log when it changes
+	solo atomic.Bool
+	// debugScoringTarget enables honoring DebugScoringTargetAnnotation
+	debugScoringTarget bool
+	// grpcPort is stamped on every member. Empty leaves them on util.DefaultGRPCPort
+	grpcPort string
+	// topologySettle is how long membership must be unchanged before the relay sub-members are recomputed.
+	// 0 recomputes on the next GetSubMembers after any change
+	topologySettle time.Duration
+	// topologyMaxSettle bounds how long a stream of changes can hold back the recompute
+	topologyMaxSettle time.Duration
+	// firstChange and lastChange are the times of the membership changes since the last recompute.
+	// firstChange is zero if there have been none. Guarded by cacheLock
+	firstChange time.Time
+	lastChange  time.Time
+	now         func() time.Time
+	// sortedCache is the members in podNameSort order, for sortedVersion of the members and sortedLeader.
+	// scoringCache is the same without relays. Guarded by cacheLock
+	sortedCache   []EndpointItem
+	scoringCache  []EndpointItem
+	sortedVersion uint64
+	sortedLeader  string
 }
 
 const (
 	RelayPrefix     = "dist-scheduler-relay"
 	SchedulerPrefix = "dist-scheduler"
+
+	// DebugScoringTargetAnnotation on a pod names the scheduler pod that should gather its scores,
+	// bypassing the hash-based targeting. Only honored after EnableDebugScoringTarget().
+	DebugScoringTargetAnnotation = "dist-scheduler.dev/debug-scoring-target"
 )
 
-func NewSchedulerSet(ctx context.Context, cs kubernetes.Interface, namespace string, podName string, fanOut uint32, allowSolo bool) (*SchedulerSet, error) {
-	endpointSliceCache, informer := RunEndpointSliceWatcher(ctx, cs, namespace, SchedulerPrefix)
+func NewSchedulerSet(ctx context.Context, cs kubernetes.Interface, namespace string, podName string, fanOut uint32, allowSolo bool, resync time.Duration) (*SchedulerSet, error) {
+	endpointSliceCache, informer := RunEndpointSliceWatcher(ctx, cs, namespace, SchedulerPrefix, resync)
 	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
 		klog.Infof("Timed out waiting for the EndpointSlice informer cache to sync")
 		return nil, fmt.Errorf("timed out waiting for the EndpointSlice informer cache to sync")
 	}
 
 	ss := &SchedulerSet{
-		endpointSliceCache: endpointSliceCache,
-		informer:           informer,
-		podName:            podName,
-		fanOut:             fanOut,
-		subMembersCache:    nil,
-		cacheLock:          sync.RWMutex{},
-		dirty:              atomic.Bool{},
-		allowSolo:          allowSolo,
+		informer:        informer,
+		podName:         podName,
+		fanOut:          fanOut,
+		subMembersCache: nil,
+		cacheLock:       sync.RWMutex{},
+		dirty:           atomic.Bool{},
+		allowSolo:       allowSolo,
+		now:             time.Now,
 	}
+	ss.endpointSliceCache.Store(endpointSliceCache)
 	ss.dirty.Store(true)
 
-	ss.AddUpdateHandler(func() { ss.dirty.Store(true) })
+	ss.AddUpdateHandler(ss.membershipChanged)
+	ss.Solo()
 
 	return ss, nil
 }
 
+// SetMembersForTest replaces the membership with a fixed list, bypassing the EndpointSlice informer.
+// For tests and benchmarks only.
+func (s *SchedulerSet) SetMembersForTest(members []EndpointItem) {
+	esc := NewEndpointSliceCacheFromMembers(members)
+	esc.SetPort(s.grpcPort)
+	if previous := s.endpointSliceCache.Load(); previous != nil {
+		esc.departureHandlers = previous.departureHandlers
+	}
+	s.endpointSliceCache.Store(esc)
+	s.dirty.Store(true)
+}
+
+// SetTopologyDebounce holds back recomputing the relay sub-members until membership has been unchanged
+// for settle, so that a rolling deploy doesn't rebuild the relay tree on every add and remove.
+// The previous sub-members are kept for at most maxSettle after the first change. A settle of 0 disables.
+func (s *SchedulerSet) SetTopologyDebounce(settle time.Duration, maxSettle time.Duration) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+	s.topologySettle = settle
+	s.topologyMaxSettle = max(maxSettle, settle)
+}
+
+func (s *SchedulerSet) membershipChanged() {
+	s.cacheLock.Lock()
+	now := s.now()
+	if s.firstChange.IsZero() {
+		s.firstChange = now
+	}
+	s.lastChange = now
+	s.cacheLock.Unlock()
+	s.dirty.Store(true)
+	s.Solo()
+}
+
+// Solo reports whether this scheduler is scheduling alone: allowSolo is set and there are no members,
+// so GetMembers returns just this scheduler. Changes are logged.
+func (s *SchedulerSet) Solo() bool {
+	solo := s.allowSolo && s.endpointSliceCache.Load().GetMemberCount() == 0
+	if s.solo.Swap(solo) != solo {
+		if solo {
+			klog.Infof("No scheduler members, %s is scheduling solo", s.podName)
+		} else {
+			klog.Infof("Scheduler members joined, %s is no longer scheduling solo", s.podName)
+		}
+	}
+	return solo
+}
+
+// settling reports whether the membership changes since the last recompute are still within the debounce window,
+// so the previous sub-members should be kept. Must be called with cacheLock held.
+func (s *SchedulerSet) settling() bool {
+	if s.topologySettle <= 0 || s.subMembersCache == nil || s.firstChange.IsZero() {
+		return false
+	}
+	now := s.now()
+	return now.Sub(s.lastChange) < s.topologySettle && now.Sub(s.firstChange) < s.topologyMaxSettle
+}
+
 func (s *SchedulerSet) AddUpdateHandler(handler func()) {
 	// Handlers are called when the informer detects a change
 	s.informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
@@ -77,8 +166,15 @@ func (s *SchedulerSet) AddUpdateHandler(handler func()) {
 	})
 }
 
+// AddDepartureHandler calls handler with the members that left, or that came back on a different address,
+// whenever the members change. Anything cached for a member, like a connection, should be dropped so that it
+// isn't reused for whatever takes the member's address next. See EndpointSliceCache.AddDepartureHandler
+func (s *SchedulerSet) AddDepartureHandler(handler func(departed []EndpointItem)) {
+	s.endpointSliceCache.Load().AddDepartureHandler(handler)
+}
+
 func (s *SchedulerSet) GetMemberCount() uint32 {
-	memberCount := uint32(s.endpointSliceCache.GetMemberCount())
+	memberCount := uint32(s.endpointSliceCache.Load().GetMemberCount())
 	if memberCount == 0 && s.allowSolo {
 		return 1
 	}
@@ -86,7 +182,7 @@ func (s *SchedulerSet) GetMemberCount() uint32 {
 }
 
 func (s *SchedulerSet) GetMemberCountNoRelays() uint32 {
-	members := s.endpointSliceCache.GetMembers()
+	members := s.endpointSliceCache.Load().GetMembers()
 	count := 0
 	for _, member := range members {
 		if !strings.HasPrefix(member.PodName, RelayPrefix) {
@@ -96,10 +192,48 @@ func (s *SchedulerSet) GetMemberCountNoRelays() uint32 {
 	return uint32(count)
 }
 
+// RelayDepth is the number of relay tiers below the leader needed to reach every member, as laid out by GetSubMembers
+func (s *SchedulerSet) RelayDepth() int {
+	return relayDepth(int(s.GetMemberCount()), int(s.fanOut))
+}
+
+// relayDepth is the number of tiers of fanOut children below the leader needed to hold members in total
+func relayDepth(members int, fanOut int) int {
+	if fanOut < 1 {
+		return 0
+	}
+	depth, covered, width := 0, 1, 1
+	for covered < members {
+		width *= fanOut
+		covered += width
+		depth++
+	}
+	return depth
+}
+
+// Hops is the number of relays a pod passes through from the leader to reach the member podName, as laid out by
+// GetSubMembers. ok is false if podName is not a member
+func (s *SchedulerSet) Hops(podName string) (hops int, ok bool) {
+	index := slices.IndexFunc(s.sortedMembers(), func(m EndpointItem) bool {
+		return m.PodName == podName
+	})
+	if index < 0 {
+		return 0, false
+	}
+	// The member at index is in the tier that first holds index+1 members
+	return relayDepth(index+1, int(s.fanOut)), true
+}
+
+// PodName is the name of this scheduler's own pod
+func (s *SchedulerSet) PodName() string {
+	return s.podName
+}
+
+// GetMembers returns every member, sorted by pod name. The slice is shared and must not be modified.
 func (s *SchedulerSet) GetMembers() []EndpointItem {
-	members := s.endpointSliceCache.GetMembers()
+	members := s.members()
 	if len(members) == 0 && s.allowSolo {
-		return []EndpointItem{{PodName: s.podName, Addresses: []string{"127.0.0.1"}}}
+		return []EndpointItem{{PodName: s.podName, Addresses: []string{"127.0.0.1"}, Port: s.grpcPort}}
 	}
 	return members
 }
@@ -121,20 +255,59 @@ func (s *SchedulerSet) podNameSort(a, b string) int {
 	return strings.Compare(a, b)
 }
 
-func (s *SchedulerSet) sortMembers(members []EndpointItem) {
-	slices.SortFunc(members, func(a, b EndpointItem) int {
-		return s.podNameSort(a.PodName, b.PodName)
-	})
+// sortedMembers returns the members in podNameSort order, which every scheduler agrees on. The slice is shared
+// and must not be modified.
+func (s *SchedulerSet) sortedMembers() []EndpointItem {
+	sorted, _ := s.sortedAndScoringMembers()
+	return sorted
+}
+
+// scoringMembers is sortedMembers without relays, which don't run the scheduler and so can't score pods
+func (s *SchedulerSet) scoringMembers() []EndpointItem {
+	_, scoring := s.sortedAndScoringMembers()
+	return scoring
+}
+
+func (s *SchedulerSet) sortedAndScoringMembers() ([]EndpointItem, []EndpointItem) {
+	members, version := s.endpointSliceCache.Load().getMembers()
+	s.cacheLock.RLock()
+	if s.sortedCache != nil && s.sortedVersion == version && s.sortedLeader == s.leader {
+		defer s.cacheLock.RUnlock()
+		return s.sortedCache, s.scoringCache
+	}
+	s.cacheLock.RUnlock()
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+	sorted := s.sortedMembersLocked(members, version)
+	return sorted, s.scoringCache
+}
+
+// sortedMembersLocked is sortedMembers for members at version. Must be called with cacheLock held for writing
+func (s *SchedulerSet) sortedMembersLocked(members []EndpointItem, version uint64) []EndpointItem {
+	if s.sortedCache == nil || s.sortedVersion != version || s.sortedLeader != s.leader {
+		sorted := slices.Clone(members)
+		slices.SortFunc(sorted, func(a, b EndpointItem) int {
+			return s.podNameSort(a.PodName, b.PodName)
+		})
+		s.sortedCache, s.sortedVersion, s.sortedLeader = sorted, version, s.leader
+		s.scoringCache = slices.DeleteFunc(slices.Clone(sorted), func(m EndpointItem) bool {
+			return strings.HasPrefix(m.PodName, RelayPrefix)
+		})
+	}
+	return s.sortedCache
 }
 
 func (s *SchedulerSet) GetTargetForScoring(key string) EndpointItem {
-	members := s.GetMembers()
+	// The sorted members are only rebuilt when the members or leader change, not per pod
+	members := s.scoringMembers()
+	if len(members) == 0 {
+		// Solo, or no schedulers besides relays yet
+		members = s.GetMembers()
+	}
 	if len(members) == 1 {
 		return members[0]
 	}
 
-	// TODO: cache the sort, or push it into the endpointSliceCache
-	s.sortMembers(members)
 	hash := fnv.New32()
 	hash.Write([]byte(key))
 	hashValue := hash.Sum32() % uint32(len(members))
@@ -142,22 +315,87 @@ func (s *SchedulerSet) GetTargetForScoring(key string) EndpointItem {
 	return members[hashValue]
 }
 
+// IsMember reports whether podName is one of the members
+func (s *SchedulerSet) IsMember(podName string) bool {
+	return slices.ContainsFunc(s.GetMembers(), func(m EndpointItem) bool {
+		return m.PodName == podName
+	})
+}
+
+// EnableDebugScoringTarget makes GetTargetForPod honor DebugScoringTargetAnnotation. This is a debugging
+// aid: every scheduler must have it enabled, otherwise they will disagree on the target.
+func (s *SchedulerSet) EnableDebugScoringTarget() {
+	klog.Warningf("DEBUG: %s annotation is enabled. Annotated pods bypass hash-based score targeting", DebugScoringTargetAnnotation)
+	s.debugScoringTarget = true
+}
+
+// SetIncludeTerminating sets whether scheduler pods that are terminating, but still serving, are members.
+// Must be called before the SchedulerSet is used.
+func (s *SchedulerSet) SetIncludeTerminating(include bool) {
+	s.endpointSliceCache.Load().SetIncludeTerminating(include)
+	s.dirty.Store(true)
+}
+
+// SetGRPCPort sets the port the members are dialed on. Every member runs with the same --grpc-addr, so this is
+// the port of this scheduler's own. Must be called before the SchedulerSet is used.
+func (s *SchedulerSet) SetGRPCPort(port string) {
+	s.grpcPort = port
+	s.endpointSliceCache.Load().SetPort(port)
+	s.dirty.Store(true)
+}
+
+// members is every member in the EndpointSlices, with the gRPC port
+func (s *SchedulerSet) members() []EndpointItem {
+	return s.endpointSliceCache.Load().GetMembers()
+}
+
+// GetTargetForPod is GetTargetForScoring for a pod, honoring DebugScoringTargetAnnotation if enabled.
+func (s *SchedulerSet) GetTargetForPod(pod *v1.Pod) EndpointItem {
+	key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	if s.debugScoringTarget {
+		if targetName, ok := pod.Annotations[DebugScoringTargetAnnotation]; ok {
+			for _, member := range s.GetMembers() {
+				if member.PodName == targetName {
+					klog.V(2).Infof("DEBUG: pinning score target of %s to %s", key, targetName)
+					return member
+				}
+			}
+			klog.Warningf("DEBUG: score target %s of %s is not a member, using hash-based target", targetName, key)
+		}
+	}
+	return s.GetTargetForScoring(key)
+}
+
 func (s *SchedulerSet) GetSubMembers() []EndpointItem {
 	if !s.dirty.Load() {
 		s.cacheLock.RLock()
 		defer s.cacheLock.RUnlock()
 		return s.subMembersCache
 	}
+	s.cacheLock.RLock()
+	if s.settling() {
+		defer s.cacheLock.RUnlock()
+		return s.subMembersCache
+	}
+	s.cacheLock.RUnlock()
+
 	s.cacheLock.Lock()
 	defer s.cacheLock.Unlock()
+	if !s.dirty.Load() || s.settling() {
+		// Another caller got here first, or a change arrived in between
+		return s.subMembersCache
+	}
 
 	s.dirty.Store(false)
+	s.firstChange = time.Time{}
+	topologyRecomputeCounter.Inc()
 
-	members := s.endpointSliceCache.GetMembers()
+	members := s.sortedMembersLocked(s.endpointSliceCache.Load().getMembers())
 	if len(members) <= 1 {
 		// No other schedulers
 		s.subMembersCache = []EndpointItem{}
 	} else {
+		// With the default fanOut of 10:
 		// When there are 11 or less members, then 0 is the leader and 1-10 are submembers of 0
 		// When there are 12-111 members:
 		//    0 goes to 1-10
@@ -168,7 +406,6 @@ func (s *SchedulerSet) GetSubMembers() []EndpointItem {
 		//    112 and beyond are keys on a consistent hash ring with the 100 members 11-111
 		// numLevels := int(math.Log(float64(len(members)-1))/math.Log(float64(s.fanOut))) + 1
 
-		s.sortMembers(members)
 		var index int
 		if s.leader == s.podName {
 			index = 0
@@ -178,7 +415,7 @@ func (s *SchedulerSet) GetSubMembers() []EndpointItem {
 			}) + 1
 		}
 
-		start := index*10 + 1
+		start := index*int(s.fanOut) + 1
 		if start >= len(members) {
 			s.subMembersCache = []EndpointItem{}
 		} else {
@@ -193,6 +430,53 @@ func (s *SchedulerSet) GetSubMembers() []EndpointItem {
 	return s.subMembersCache
 }
 
+// Snapshot is the full membership state of a SchedulerSet, for debugging.
+type Snapshot struct {
+	PodName string `json:"podName"`
+	Leader  string `json:"leader"`
+	// Index of this pod within Members, or -1 if it is not a member
+	Index      int                     `json:"index"`
+	Members    []EndpointItem          `json:"members"`
+	SubMembers []EndpointItem          `json:"subMembers"`
+	Slices     []EndpointSliceSnapshot `json:"slices"`
+}
+
+func (s *SchedulerSet) Snapshot() Snapshot {
+	subMembers := s.GetSubMembers()
+	members := s.GetMembers()
+	if len(members) > 1 {
+		members = s.sortedMembers()
+	}
+
+	s.cacheLock.RLock()
+	defer s.cacheLock.RUnlock()
+	index := slices.IndexFunc(members, func(m EndpointItem) bool {
+		return m.PodName == s.podName
+	})
+
+	return Snapshot{
+		PodName:    s.podName,
+		Leader:     s.leader,
+		Index:      index,
+		Members:    members,
+		SubMembers: subMembers,
+		Slices:     s.endpointSliceCache.Load().Snapshot(),
+	}
+}
+
+// GetLeaderMember returns the member that is the current leader, if it is known and a member
+func (s *SchedulerSet) GetLeaderMember() (EndpointItem, bool) {
+	s.cacheLock.RLock()
+	leader := s.leader
+	s.cacheLock.RUnlock()
+	for _, member := range s.GetMembers() {
+		if member.PodName == leader {
+			return member, true
+		}
+	}
+	return EndpointItem{}, false
+}
+
 func (s *SchedulerSet) SetLeader(leader string) {
 	// The pod watcher is chosen via leader election. And then the pod watcher starts
 	// relaying pods to the rest of the schedulers. So right now the top of the tree needs to be the
@@ -200,5 +484,7 @@ func (s *SchedulerSet) SetLeader(leader string) {
 	s.cacheLock.Lock()
 	defer s.cacheLock.Unlock()
 	s.leader = leader
+	// A new leader changes the root of the tree, which can't wait for membership to settle
+	s.firstChange = time.Time{}
 	s.dirty.Store(true)
 }
@@ -4,35 +4,28 @@ package schedulerset
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
 	"k8s.io/client-go/kubernetes/fake"
 )
 
-func mockEndpointCache(podNames []string) *EndpointSliceCache {
-	endpoints := make([]discoveryv1.Endpoint, len(podNames))
+func mockMembers(podNames []string) []EndpointItem {
+	members := make([]EndpointItem, len(podNames))
 	for i, podName := range podNames {
-		endpoints[i] = discoveryv1.Endpoint{
+		members[i] = EndpointItem{
+			PodName:   podName,
 			Addresses: []string{podName},
-			TargetRef: &corev1.ObjectReference{
-				Kind: "Pod",
-				Name: podName,
-			},
 		}
 	}
-	endpointSlice := &discoveryv1.EndpointSlice{
-		ObjectMeta: metav1.ObjectMeta{Name: "test-pod"},
-		Endpoints:  endpoints,
-	}
-	return &EndpointSliceCache{
-		slices: map[string]*discoveryv1.EndpointSlice{
-			"test-pod": endpointSlice,
-		},
-	}
+	return members
 }
 
 func TestGetMemberCount(t *testing.T) {
@@ -65,13 +58,12 @@ func TestGetMemberCount(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := fake.NewSimpleClientset()
-			ss, err := NewSchedulerSet(context.Background(), cs, "default", "test-pod", 10, tt.allowSolo)
+			ss, err := NewSchedulerSet(context.Background(), cs, "default", "test-pod", 10, tt.allowSolo, 0)
 			if err != nil {
 				t.Fatalf("NewSchedulerSet() error = %v", err)
 			}
 
-			// Inject test members directly into the cache
-			ss.endpointSliceCache = mockEndpointCache(tt.members)
+			ss.SetMembersForTest(mockMembers(tt.members))
 
 			got := ss.GetMemberCount()
 			if got != tt.want {
@@ -81,6 +73,170 @@ func TestGetMemberCount(t *testing.T) {
 	}
 }
 
+func TestGetMembersWithoutTargetRef(t *testing.T) {
+	esc := NewEndpointSliceCacheFromMembers(mockMembers([]string{"scheduler-1", "scheduler-2"}))
+	// An endpoint added by hand, which has no pod
+	esc.Update(&discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "manual"},
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{"10.0.0.9"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &[]bool{true}[0]},
+		}},
+	})
+
+	var got []string
+	for _, member := range esc.GetMembers() {
+		got = append(got, member.PodName)
+	}
+	if fmt.Sprint(got) != "[scheduler-1 scheduler-2]" {
+		t.Errorf("GetMembers() = %v, want [scheduler-1 scheduler-2]", got)
+	}
+	if count := esc.GetMemberCount(); count != 2 {
+		t.Errorf("GetMemberCount() = %d, want 2", count)
+	}
+}
+
+func TestGetMembersSorted(t *testing.T) {
+	esc := NewEndpointSliceCache()
+	esc.Update(&discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "b"},
+		Endpoints:  NewEndpointSliceCacheFromMembers(mockMembers([]string{"scheduler-3", "scheduler-1"})).slices["members"].Endpoints,
+	})
+	// scheduler-1 moving from slice b to slice a, listed in both
+	esc.Update(&discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "a"},
+		Endpoints:  NewEndpointSliceCacheFromMembers(mockMembers([]string{"scheduler-2", "scheduler-1"})).slices["members"].Endpoints,
+	})
+	esc.SetPort("6000")
+
+	members := esc.GetMembers()
+	var got []string
+	for _, member := range members {
+		got = append(got, member.PodName)
+		if member.Port != "6000" {
+			t.Errorf("GetMembers() %s port = %q, want 6000", member.PodName, member.Port)
+		}
+	}
+	if fmt.Sprint(got) != "[scheduler-1 scheduler-2 scheduler-3]" {
+		t.Errorf("GetMembers() = %v, want [scheduler-1 scheduler-2 scheduler-3]", got)
+	}
+	if count := esc.GetMemberCount(); count != 3 {
+		t.Errorf("GetMemberCount() = %d, want 3", count)
+	}
+	// Unchanged, the same members are returned without being rebuilt
+	if again := esc.GetMembers(); &again[0] != &members[0] {
+		t.Errorf("GetMembers() rebuilt the members without a change")
+	}
+}
+
+func TestGetMembersReadiness(t *testing.T) {
+	yes, no := &[]bool{true}[0], &[]bool{false}[0]
+	endpoint := func(name string, conditions discoveryv1.EndpointConditions) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			Addresses:  []string{name},
+			Conditions: conditions,
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: name},
+		}
+	}
+	endpoints := []discoveryv1.Endpoint{
+		endpoint("ready", discoveryv1.EndpointConditions{Ready: yes}),
+		endpoint("unknown", discoveryv1.EndpointConditions{}),
+		endpoint("not-ready", discoveryv1.EndpointConditions{Ready: no}),
+		endpoint("terminating", discoveryv1.EndpointConditions{Ready: no, Serving: yes, Terminating: yes}),
+		endpoint("terminating-not-serving", discoveryv1.EndpointConditions{Ready: no, Serving: no, Terminating: yes}),
+	}
+	tests := []struct {
+		includeTerminating bool
+		want               string
+	}{
+		{includeTerminating: false, want: "[ready unknown]"},
+		{includeTerminating: true, want: "[ready terminating unknown]"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("includeTerminating=%v", tt.includeTerminating), func(t *testing.T) {
+			esc := NewEndpointSliceCache()
+			esc.SetIncludeTerminating(tt.includeTerminating)
+			esc.Update(&discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Name: "members"}, Endpoints: endpoints})
+
+			var got []string
+			for _, member := range esc.GetMembers() {
+				got = append(got, member.PodName)
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("GetMembers() = %v, want %v", got, tt.want)
+			}
+			if count := esc.GetMemberCount(); count != len(got) {
+				t.Errorf("GetMemberCount() = %d, want %d", count, len(got))
+			}
+		})
+	}
+}
+
+func TestRelayDepth(t *testing.T) {
+	tests := []struct {
+		members int
+		want    int
+	}{
+		{members: 0, want: 0},
+		{members: 1, want: 0},
+		{members: 2, want: 1},
+		{members: 11, want: 1},
+		{members: 12, want: 2},
+		{members: 111, want: 2},
+		{members: 112, want: 3},
+		{members: 1111, want: 3},
+		{members: 1112, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d members", tt.members), func(t *testing.T) {
+			if got := relayDepth(tt.members, 10); got != tt.want {
+				t.Errorf("relayDepth(%d, 10) = %d, want %d", tt.members, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHops(t *testing.T) {
+	ss, err := NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-0", 2, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2", "dist-scheduler-3", "dist-scheduler-4"}))
+	ss.SetLeader("dist-scheduler-2")
+
+	// With a fanOut of 2 the leader relays to the next two members, and they to the rest
+	for name, want := range map[string]int{"dist-scheduler-2": 0, "dist-scheduler-0": 1, "dist-scheduler-1": 1, "dist-scheduler-3": 2, "dist-scheduler-4": 2} {
+		if got, ok := ss.Hops(name); !ok || got != want {
+			t.Errorf("Hops(%s) = %d, %v, want %d, true", name, got, ok, want)
+		}
+	}
+	if _, ok := ss.Hops("dist-scheduler-5"); ok {
+		t.Errorf("Hops() of a non-member ok = true, want false")
+	}
+}
+
+func TestSolo(t *testing.T) {
+	ss, err := NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "test-pod", 10, true, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	if !ss.Solo() {
+		t.Errorf("Solo() = false with no members and allowSolo")
+	}
+	ss.SetMembersForTest(mockMembers([]string{"test-pod", "scheduler-2"}))
+	if ss.Solo() {
+		t.Errorf("Solo() = true with members")
+	}
+
+	ss, err = NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "test-pod", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	if ss.Solo() {
+		t.Errorf("Solo() = true without allowSolo")
+	}
+}
+
 func TestGetMemberCountNoRelays(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -112,12 +268,12 @@ func TestGetMemberCountNoRelays(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := fake.NewSimpleClientset()
-			ss, err := NewSchedulerSet(context.Background(), cs, "default", "test-pod", 10, false)
+			ss, err := NewSchedulerSet(context.Background(), cs, "default", "test-pod", 10, false, 0)
 			if err != nil {
 				t.Fatalf("NewSchedulerSet() error = %v", err)
 			}
 
-			ss.endpointSliceCache = mockEndpointCache(tt.members)
+			ss.SetMembersForTest(mockMembers(tt.members))
 
 			got := ss.GetMemberCountNoRelays()
 			if got != tt.want {
@@ -127,86 +283,90 @@ func TestGetMemberCountNoRelays(t *testing.T) {
 	}
 }
 
+// bigPodNameList mixes scheduler and relay pod names
+var bigPodNameList = []string{
+	"dist-scheduler-855b885c5d-24nmt",
+	"dist-scheduler-855b885c5d-28r24",
+	"dist-scheduler-855b885c5d-49ntc",
+	"dist-scheduler-855b885c5d-4cfqz",
+	"dist-scheduler-855b885c5d-5lt9t",
+	"dist-scheduler-855b885c5d-5nt7m",
+	"dist-scheduler-855b885c5d-64dfc",
+	"dist-scheduler-855b885c5d-6ld8m",
+	"dist-scheduler-855b885c5d-6nh2k",
+	"dist-scheduler-855b885c5d-6p5cd",
+	"dist-scheduler-855b885c5d-6sl2r",
+	"dist-scheduler-855b885c5d-72lpj",
+	"dist-scheduler-855b885c5d-7lppz",
+	"dist-scheduler-855b885c5d-8jz5m",
+	"dist-scheduler-855b885c5d-8s96b",
+	"dist-scheduler-855b885c5d-8wkmk",
+	"dist-scheduler-855b885c5d-9r6lp",
+	"dist-scheduler-855b885c5d-9vfnb",
+	"dist-scheduler-855b885c5d-bq8t6",
+	"dist-scheduler-855b885c5d-bs7sc",
+	"dist-scheduler-855b885c5d-c2m2z",
+	"dist-scheduler-855b885c5d-clrpq",
+	"dist-scheduler-855b885c5d-cvdbv",
+	"dist-scheduler-855b885c5d-dp7vs",
+	"dist-scheduler-855b885c5d-dvjlk",
+	"dist-scheduler-855b885c5d-fdzll",
+	"dist-scheduler-855b885c5d-fzt8f",
+	"dist-scheduler-855b885c5d-gbsdl",
+	"dist-scheduler-855b885c5d-gmkw4",
+	"dist-scheduler-855b885c5d-gwbs2",
+	"dist-scheduler-855b885c5d-hmqsg",
+	"dist-scheduler-855b885c5d-j7nd4",
+	"dist-scheduler-855b885c5d-jw44t",
+	"dist-scheduler-855b885c5d-k742f",
+	"dist-scheduler-855b885c5d-kh47k",
+	"dist-scheduler-855b885c5d-lw8kf",
+	"dist-scheduler-855b885c5d-lzd7g",
+	"dist-scheduler-855b885c5d-m5ng4",
+	"dist-scheduler-855b885c5d-mfc7z",
+	"dist-scheduler-855b885c5d-mp5j6",
+	"dist-scheduler-855b885c5d-n5nm2",
+	"dist-scheduler-855b885c5d-nc4hk",
+	"dist-scheduler-855b885c5d-njvwr",
+	"dist-scheduler-855b885c5d-p4tv5",
+	"dist-scheduler-855b885c5d-pkdjl",
+	"dist-scheduler-855b885c5d-q6j7d",
+	"dist-scheduler-855b885c5d-qq4nt",
+	"dist-scheduler-855b885c5d-rjpnz",
+	"dist-scheduler-855b885c5d-rl7cg",
+	"dist-scheduler-855b885c5d-rpcvl",
+	"dist-scheduler-855b885c5d-snfzb",
+	"dist-scheduler-855b885c5d-sphxf",
+	"dist-scheduler-855b885c5d-tc89d",
+	"dist-scheduler-855b885c5d-tspqr",
+	"dist-scheduler-855b885c5d-vqpk9",
+	"dist-scheduler-855b885c5d-w69gp",
+	"dist-scheduler-855b885c5d-wmbft",
+	"dist-scheduler-855b885c5d-xfqcf",
+	"dist-scheduler-855b885c5d-xhgx8",
+	"dist-scheduler-855b885c5d-z5fw2",
+	"dist-scheduler-855b885c5d-zjdkk",
+	"dist-scheduler-855b885c5d-znx8s",
+	"dist-scheduler-855b885c5d-zpp8z",
+	"dist-scheduler-855b885c5d-zzd5n",
+	"dist-scheduler-relay-7b8847c594-4pzl9",
+	"dist-scheduler-relay-7b8847c594-5965t",
+	"dist-scheduler-relay-7b8847c594-596z8",
+	"dist-scheduler-relay-7b8847c594-8tqd2",
+	"dist-scheduler-relay-7b8847c594-9ssqq",
+	"dist-scheduler-relay-7b8847c594-jhr44",
+	"dist-scheduler-relay-7b8847c594-rch8w",
+}
+
 func TestGetSubMembers(t *testing.T) {
-	bigPodNameList := []string{
-		"dist-scheduler-855b885c5d-24nmt",
-		"dist-scheduler-855b885c5d-28r24",
-		"dist-scheduler-855b885c5d-49ntc",
-		"dist-scheduler-855b885c5d-4cfqz",
-		"dist-scheduler-855b885c5d-5lt9t",
-		"dist-scheduler-855b885c5d-5nt7m",
-		"dist-scheduler-855b885c5d-64dfc",
-		"dist-scheduler-855b885c5d-6ld8m",
-		"dist-scheduler-855b885c5d-6nh2k",
-		"dist-scheduler-855b885c5d-6p5cd",
-		"dist-scheduler-855b885c5d-6sl2r",
-		"dist-scheduler-855b885c5d-72lpj",
-		"dist-scheduler-855b885c5d-7lppz",
-		"dist-scheduler-855b885c5d-8jz5m",
-		"dist-scheduler-855b885c5d-8s96b",
-		"dist-scheduler-855b885c5d-8wkmk",
-		"dist-scheduler-855b885c5d-9r6lp",
-		"dist-scheduler-855b885c5d-9vfnb",
-		"dist-scheduler-855b885c5d-bq8t6",
-		"dist-scheduler-855b885c5d-bs7sc",
-		"dist-scheduler-855b885c5d-c2m2z",
-		"dist-scheduler-855b885c5d-clrpq",
-		"dist-scheduler-855b885c5d-cvdbv",
-		"dist-scheduler-855b885c5d-dp7vs",
-		"dist-scheduler-855b885c5d-dvjlk",
-		"dist-scheduler-855b885c5d-fdzll",
-		"dist-scheduler-855b885c5d-fzt8f",
-		"dist-scheduler-855b885c5d-gbsdl",
-		"dist-scheduler-855b885c5d-gmkw4",
-		"dist-scheduler-855b885c5d-gwbs2",
-		"dist-scheduler-855b885c5d-hmqsg",
-		"dist-scheduler-855b885c5d-j7nd4",
-		"dist-scheduler-855b885c5d-jw44t",
-		"dist-scheduler-855b885c5d-k742f",
-		"dist-scheduler-855b885c5d-kh47k",
-		"dist-scheduler-855b885c5d-lw8kf",
-		"dist-scheduler-855b885c5d-lzd7g",
-		"dist-scheduler-855b885c5d-m5ng4",
-		"dist-scheduler-855b885c5d-mfc7z",
-		"dist-scheduler-855b885c5d-mp5j6",
-		"dist-scheduler-855b885c5d-n5nm2",
-		"dist-scheduler-855b885c5d-nc4hk",
-		"dist-scheduler-855b885c5d-njvwr",
-		"dist-scheduler-855b885c5d-p4tv5",
-		"dist-scheduler-855b885c5d-pkdjl",
-		"dist-scheduler-855b885c5d-q6j7d",
-		"dist-scheduler-855b885c5d-qq4nt",
-		"dist-scheduler-855b885c5d-rjpnz",
-		"dist-scheduler-855b885c5d-rl7cg",
-		"dist-scheduler-855b885c5d-rpcvl",
-		"dist-scheduler-855b885c5d-snfzb",
-		"dist-scheduler-855b885c5d-sphxf",
-		"dist-scheduler-855b885c5d-tc89d",
-		"dist-scheduler-855b885c5d-tspqr",
-		"dist-scheduler-855b885c5d-vqpk9",
-		"dist-scheduler-855b885c5d-w69gp",
-		"dist-scheduler-855b885c5d-wmbft",
-		"dist-scheduler-855b885c5d-xfqcf",
-		"dist-scheduler-855b885c5d-xhgx8",
-		"dist-scheduler-855b885c5d-z5fw2",
-		"dist-scheduler-855b885c5d-zjdkk",
-		"dist-scheduler-855b885c5d-znx8s",
-		"dist-scheduler-855b885c5d-zpp8z",
-		"dist-scheduler-855b885c5d-zzd5n",
-		"dist-scheduler-relay-7b8847c594-4pzl9",
-		"dist-scheduler-relay-7b8847c594-5965t",
-		"dist-scheduler-relay-7b8847c594-596z8",
-		"dist-scheduler-relay-7b8847c594-8tqd2",
-		"dist-scheduler-relay-7b8847c594-9ssqq",
-		"dist-scheduler-relay-7b8847c594-jhr44",
-		"dist-scheduler-relay-7b8847c594-rch8w",
-	}
 	tests := []struct {
 		name    string
 		leader  string
 		podName string
 		members []string
-		want    []string
+		// fanOut is 10 if unset
+		fanOut uint32
+		want   []string
 	}{
 		{
 			name:    "empty set",
@@ -269,6 +429,111 @@ func TestGetSubMembers(t *testing.T) {
 				"dist-scheduler-855b885c5d-dp7vs",
 			},
 		},
+		{
+			name:    "leader fanOut 5",
+			leader:  "dist-scheduler-relay-7b8847c594-8tqd2",
+			members: bigPodNameList,
+			podName: "dist-scheduler-relay-7b8847c594-8tqd2",
+			fanOut:  5,
+			want: []string{
+				"dist-scheduler-relay-7b8847c594-4pzl9",
+				"dist-scheduler-relay-7b8847c594-5965t",
+				"dist-scheduler-relay-7b8847c594-596z8",
+				"dist-scheduler-relay-7b8847c594-9ssqq",
+				"dist-scheduler-relay-7b8847c594-jhr44",
+			},
+		},
+		{
+			name:    "relay1 fanOut 5",
+			leader:  "dist-scheduler-relay-7b8847c594-8tqd2",
+			members: bigPodNameList,
+			podName: "dist-scheduler-relay-7b8847c594-4pzl9",
+			fanOut:  5,
+			want: []string{
+				"dist-scheduler-relay-7b8847c594-rch8w",
+				"dist-scheduler-855b885c5d-24nmt",
+				"dist-scheduler-855b885c5d-28r24",
+				"dist-scheduler-855b885c5d-49ntc",
+				"dist-scheduler-855b885c5d-4cfqz",
+			},
+		},
+		{
+			name:    "leader fanOut 20",
+			leader:  "dist-scheduler-relay-7b8847c594-8tqd2",
+			members: bigPodNameList,
+			podName: "dist-scheduler-relay-7b8847c594-8tqd2",
+			fanOut:  20,
+			want: []string{
+				"dist-scheduler-relay-7b8847c594-4pzl9",
+				"dist-scheduler-relay-7b8847c594-5965t",
+				"dist-scheduler-relay-7b8847c594-596z8",
+				"dist-scheduler-relay-7b8847c594-9ssqq",
+				"dist-scheduler-relay-7b8847c594-jhr44",
+				"dist-scheduler-relay-7b8847c594-rch8w",
+				"dist-scheduler-855b885c5d-24nmt",
+				"dist-scheduler-855b885c5d-28r24",
+				"dist-scheduler-855b885c5d-49ntc",
+				"dist-scheduler-855b885c5d-4cfqz",
+				"dist-scheduler-855b885c5d-5lt9t",
+				"dist-scheduler-855b885c5d-5nt7m",
+				"dist-scheduler-855b885c5d-64dfc",
+				"dist-scheduler-855b885c5d-6ld8m",
+				"dist-scheduler-855b885c5d-6nh2k",
+				"dist-scheduler-855b885c5d-6p5cd",
+				"dist-scheduler-855b885c5d-6sl2r",
+				"dist-scheduler-855b885c5d-72lpj",
+				"dist-scheduler-855b885c5d-7lppz",
+				"dist-scheduler-855b885c5d-8jz5m",
+			},
+		},
+		{
+			name:    "relay2 fanOut 20",
+			leader:  "dist-scheduler-relay-7b8847c594-8tqd2",
+			members: bigPodNameList,
+			podName: "dist-scheduler-relay-7b8847c594-5965t",
+			fanOut:  20,
+			want: []string{
+				"dist-scheduler-855b885c5d-kh47k",
+				"dist-scheduler-855b885c5d-lw8kf",
+				"dist-scheduler-855b885c5d-lzd7g",
+				"dist-scheduler-855b885c5d-m5ng4",
+				"dist-scheduler-855b885c5d-mfc7z",
+				"dist-scheduler-855b885c5d-mp5j6",
+				"dist-scheduler-855b885c5d-n5nm2",
+				"dist-scheduler-855b885c5d-nc4hk",
+				"dist-scheduler-855b885c5d-njvwr",
+				"dist-scheduler-855b885c5d-p4tv5",
+				"dist-scheduler-855b885c5d-pkdjl",
+				"dist-scheduler-855b885c5d-q6j7d",
+				"dist-scheduler-855b885c5d-qq4nt",
+				"dist-scheduler-855b885c5d-rjpnz",
+				"dist-scheduler-855b885c5d-rl7cg",
+				"dist-scheduler-855b885c5d-rpcvl",
+				"dist-scheduler-855b885c5d-snfzb",
+				"dist-scheduler-855b885c5d-sphxf",
+				"dist-scheduler-855b885c5d-tc89d",
+				"dist-scheduler-855b885c5d-tspqr",
+			},
+		},
+		{
+			name:    "last relay fanOut 20",
+			leader:  "dist-scheduler-relay-7b8847c594-8tqd2",
+			members: bigPodNameList,
+			podName: "dist-scheduler-relay-7b8847c594-596z8",
+			fanOut:  20,
+			want: []string{
+				"dist-scheduler-855b885c5d-vqpk9",
+				"dist-scheduler-855b885c5d-w69gp",
+				"dist-scheduler-855b885c5d-wmbft",
+				"dist-scheduler-855b885c5d-xfqcf",
+				"dist-scheduler-855b885c5d-xhgx8",
+				"dist-scheduler-855b885c5d-z5fw2",
+				"dist-scheduler-855b885c5d-zjdkk",
+				"dist-scheduler-855b885c5d-znx8s",
+				"dist-scheduler-855b885c5d-zpp8z",
+				"dist-scheduler-855b885c5d-zzd5n",
+			},
+		},
 		{
 			name:    "dist-scheduler",
 			leader:  "dist-scheduler-relay-7b8847c594-8tqd2",
@@ -281,12 +546,16 @@ func TestGetSubMembers(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := fake.NewSimpleClientset()
-			ss, err := NewSchedulerSet(context.Background(), cs, "default", tt.podName, 10, false)
+			fanOut := tt.fanOut
+			if fanOut == 0 {
+				fanOut = 10
+			}
+			ss, err := NewSchedulerSet(context.Background(), cs, "default", tt.podName, fanOut, false, 0)
 			if err != nil {
 				t.Fatalf("NewSchedulerSet() error = %v", err)
 			}
 
-			ss.endpointSliceCache = mockEndpointCache(tt.members)
+			ss.SetMembersForTest(mockMembers(tt.members))
 			ss.SetLeader(tt.leader)
 			got := ss.GetSubMembers()
 			if len(got) != len(tt.want) {
@@ -300,3 +569,306 @@ func TestGetSubMembers(t *testing.T) {
 		})
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", "dist-scheduler-2", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-2", "dist-scheduler-1", "dist-scheduler-relay-1"}))
+	ss.SetLeader("dist-scheduler-1")
+
+	got := ss.Snapshot()
+	if got.Leader != "dist-scheduler-1" {
+		t.Errorf("Snapshot().Leader = %v, want dist-scheduler-1", got.Leader)
+	}
+	wantMembers := []string{"dist-scheduler-1", "dist-scheduler-relay-1", "dist-scheduler-2"}
+	if len(got.Members) != len(wantMembers) {
+		t.Fatalf("Snapshot().Members = %v, want %v", got.Members, wantMembers)
+	}
+	for i, member := range got.Members {
+		if member.PodName != wantMembers[i] {
+			t.Errorf("Snapshot().Members = %v, want %v", got.Members, wantMembers)
+		}
+	}
+	if got.Index != 2 {
+		t.Errorf("Snapshot().Index = %v, want 2", got.Index)
+	}
+	if len(got.Slices) != 1 || len(got.Slices[0].Endpoints) != 3 {
+		t.Errorf("Snapshot().Slices = %v, want 1 slice with 3 endpoints", got.Slices)
+	}
+}
+
+func BenchmarkGetTargetForScoring(b *testing.B) {
+	podNames := make([]string, 1000)
+	for i := range podNames {
+		podNames[i] = fmt.Sprintf("dist-scheduler-%d", i)
+	}
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", podNames[0], 10, false, 0)
+	if err != nil {
+		b.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers(podNames))
+	ss.SetLeader(podNames[0])
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ss.GetTargetForScoring(fmt.Sprintf("default/res-%d", i))
+		}
+	})
+	// What GetTargetForScoring cost when it sorted the members for every pod
+	b.Run("sorted per pod", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			members := slices.Clone(ss.GetMembers())
+			slices.SortFunc(members, func(a, b EndpointItem) int {
+				return ss.podNameSort(a.PodName, b.PodName)
+			})
+			hash := fnv.New32()
+			hash.Write([]byte(fmt.Sprintf("default/res-%d", i)))
+			_ = members[hash.Sum32()%uint32(len(members))]
+		}
+	})
+}
+
+func TestGetTargetForScoringExcludesRelays(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", bigPodNameList[0], 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers(bigPodNameList))
+
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("default/res-%d", i)
+		if got := ss.GetTargetForScoring(key); strings.HasPrefix(got.PodName, RelayPrefix) {
+			t.Fatalf("GetTargetForScoring(%q) = %v, want a non-relay member", key, got.PodName)
+		}
+	}
+}
+
+func TestGetTargetForPodDebugOverride(t *testing.T) {
+	podNames := []string{"dist-scheduler-1", "dist-scheduler-2", "dist-scheduler-3"}
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", "dist-scheduler-1", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers(podNames))
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "res-1"}}
+	hashTarget := ss.GetTargetForScoring("default/res-1")
+	var pinned string
+	for _, name := range podNames {
+		if name != hashTarget.PodName {
+			pinned = name
+			break
+		}
+	}
+	pod.Annotations = map[string]string{DebugScoringTargetAnnotation: pinned}
+
+	if got := ss.GetTargetForPod(pod); got.PodName != hashTarget.PodName {
+		t.Errorf("GetTargetForPod() without EnableDebugScoringTarget = %v, want %v", got, hashTarget)
+	}
+
+	ss.EnableDebugScoringTarget()
+	if got := ss.GetTargetForPod(pod); got.PodName != pinned {
+		t.Errorf("GetTargetForPod() = %v, want %v", got, pinned)
+	}
+
+	pod.Annotations[DebugScoringTargetAnnotation] = "not-a-member"
+	if got := ss.GetTargetForPod(pod); got.PodName != hashTarget.PodName {
+		t.Errorf("GetTargetForPod() with unknown target = %v, want %v", got, hashTarget)
+	}
+}
+
+func TestIsMember(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", "dist-scheduler-1", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-1", "dist-scheduler-2"}))
+
+	if !ss.IsMember("dist-scheduler-2") {
+		t.Errorf("IsMember(dist-scheduler-2) = false, want true")
+	}
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-1"}))
+	if ss.IsMember("dist-scheduler-2") {
+		t.Errorf("IsMember(dist-scheduler-2) after it left = true, want false")
+	}
+}
+
+func TestGetLeaderMember(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", "dist-scheduler-2", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-2", "dist-scheduler-1"}))
+
+	if _, ok := ss.GetLeaderMember(); ok {
+		t.Errorf("GetLeaderMember() with no leader ok = true, want false")
+	}
+	ss.SetLeader("dist-scheduler-1")
+	got, ok := ss.GetLeaderMember()
+	if !ok || got.PodName != "dist-scheduler-1" {
+		t.Errorf("GetLeaderMember() = %v, %v, want dist-scheduler-1, true", got.PodName, ok)
+	}
+	ss.SetLeader("dist-scheduler-9")
+	if _, ok := ss.GetLeaderMember(); ok {
+		t.Errorf("GetLeaderMember() with non-member leader ok = true, want false")
+	}
+}
+
+func TestSetGRPCPort(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	ss, err := NewSchedulerSet(context.Background(), cs, "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2"}))
+
+	// Unset, members are dialed on the default port
+	if got := ss.GetMembers()[0].GRPCAddress(); !strings.HasSuffix(got, ":50051") {
+		t.Errorf("GRPCAddress() = %q, want port 50051", got)
+	}
+	// Warm the sub-members cache, which must pick up the port too
+	ss.GetSubMembers()
+
+	ss.SetGRPCPort("6000")
+	for _, member := range ss.GetMembers() {
+		if got := member.GRPCAddress(); !strings.HasSuffix(got, ":6000") {
+			t.Errorf("GetMembers() %s GRPCAddress() = %q, want port 6000", member.PodName, got)
+		}
+	}
+	for _, member := range ss.GetSubMembers() {
+		if got := member.GRPCAddress(); !strings.HasSuffix(got, ":6000") {
+			t.Errorf("GetSubMembers() %s GRPCAddress() = %q, want port 6000", member.PodName, got)
+		}
+	}
+}
+
+func TestGetSubMembersDebounce(t *testing.T) {
+	ss, err := NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "dist-scheduler-0", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	now := time.Unix(1000, 0)
+	ss.now = func() time.Time { return now }
+	ss.SetTopologyDebounce(time.Second, 3*time.Second)
+	ss.SetLeader("dist-scheduler-0")
+	ss.SetMembersForTest(mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1"}))
+	if got := ss.GetSubMembers(); len(got) != 1 {
+		t.Fatalf("GetSubMembers() = %v, want 1 sub-member", got)
+	}
+
+	// What the informer does on a membership change
+	setMembers := func(n int) {
+		podNames := make([]string, n)
+		for i := range podNames {
+			podNames[i] = fmt.Sprintf("dist-scheduler-%d", i)
+		}
+		ss.endpointSliceCache.Store(NewEndpointSliceCacheFromMembers(mockMembers(podNames)))
+		ss.membershipChanged()
+	}
+
+	setMembers(3)
+	now = now.Add(500 * time.Millisecond)
+	if got := ss.GetSubMembers(); len(got) != 1 {
+		t.Errorf("GetSubMembers() while settling = %v, want the previous 1 sub-member", got)
+	}
+	now = now.Add(time.Second)
+	if got := ss.GetSubMembers(); len(got) != 2 {
+		t.Errorf("GetSubMembers() after settling = %v, want 2 sub-members", got)
+	}
+
+	// Changes every 500ms never settle, but are applied after maxSettle
+	for i := 4; i <= 9; i++ {
+		setMembers(i)
+		now = now.Add(500 * time.Millisecond)
+		got := ss.GetSubMembers()
+		if elapsed := time.Duration(i-3) * 500 * time.Millisecond; elapsed < 3*time.Second {
+			if len(got) != 2 {
+				t.Errorf("GetSubMembers() %v after the first change = %v, want the previous 2 sub-members", elapsed, got)
+			}
+		} else if len(got) != i-1 {
+			t.Errorf("GetSubMembers() %v after the first change = %v, want %d sub-members", elapsed, got, i-1)
+		}
+	}
+
+	// A leader change applies right away
+	setMembers(5)
+	ss.SetLeader("dist-scheduler-1")
+	if got := ss.GetSubMembers(); len(got) != 0 {
+		t.Errorf("GetSubMembers() after losing leadership = %v, want none", got)
+	}
+}
+
+func TestDepartedMembers(t *testing.T) {
+	previous := mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2"})
+	tests := []struct {
+		name    string
+		current []EndpointItem
+		want    []string
+	}{
+		{name: "unchanged", current: mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2"})},
+		{name: "joined", current: mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2", "dist-scheduler-3"})},
+		{name: "left", current: mockMembers([]string{"dist-scheduler-0", "dist-scheduler-2"}), want: []string{"dist-scheduler-1"}},
+		{
+			name: "new address",
+			current: []EndpointItem{
+				{PodName: "dist-scheduler-0", Addresses: []string{"dist-scheduler-0"}},
+				{PodName: "dist-scheduler-1", Addresses: []string{"10.0.0.1"}},
+				{PodName: "dist-scheduler-2", Addresses: []string{"dist-scheduler-2"}},
+			},
+			want: []string{"dist-scheduler-1"},
+		},
+		{
+			// A new pod took over the address of a departed one
+			name: "address reused",
+			current: []EndpointItem{
+				{PodName: "dist-scheduler-0", Addresses: []string{"dist-scheduler-0"}},
+				{PodName: "dist-scheduler-2", Addresses: []string{"dist-scheduler-2"}},
+				{PodName: "dist-scheduler-3", Addresses: []string{"dist-scheduler-1"}},
+			},
+			want: []string{"dist-scheduler-1"},
+		},
+		{name: "all left", want: []string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, member := range departedMembers(previous, tt.current) {
+				got = append(got, member.PodName)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("departedMembers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDepartureHandler(t *testing.T) {
+	esc := NewEndpointSliceCacheFromMembers(mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2"}))
+	var got [][]string
+	esc.AddDepartureHandler(func(departed []EndpointItem) {
+		// The new members are already in place, so nothing can pick a departed member after its handler ran
+		if slices.ContainsFunc(esc.members, func(m EndpointItem) bool { return m.PodName == departed[0].PodName }) {
+			t.Errorf("departure handler called before %s was removed from the members", departed[0].PodName)
+		}
+		var names []string
+		for _, member := range departed {
+			names = append(names, member.PodName)
+		}
+		got = append(got, names)
+	})
+
+	// Joining is not a departure
+	esc.Update(NewEndpointSliceCacheFromMembers(mockMembers([]string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2", "dist-scheduler-3"})).slices["members"])
+	esc.Update(NewEndpointSliceCacheFromMembers(mockMembers([]string{"dist-scheduler-0", "dist-scheduler-2", "dist-scheduler-3"})).slices["members"])
+	if want := [][]string{{"dist-scheduler-1"}}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("departed = %v, want %v", got, want)
+	}
+}
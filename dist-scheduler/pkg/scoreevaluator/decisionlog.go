@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package scoreevaluator
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var decisionLogHeader = []string{"pod", "namespace", "node", "score", "competitors", "latency_us", "hops"}
+
+// decisionLogQueueSize is how many rows can be pending before new rows are dropped
+const decisionLogQueueSize = 10000
+
+// DecisionLog appends one CSV row per decided pod. Rows are queued and written by a background
+// goroutine so that Record never blocks scheduling; if the queue is full the row is dropped.
+type DecisionLog struct {
+	rows chan []string
+	done chan struct{}
+	file *os.File
+	// closedLock guards closed so that Record never sends on a closed channel
+	closedLock sync.RWMutex
+	closed     bool
+}
+
+// NewDecisionLog opens path for appending, writing the header if the file is empty. A path of "-" writes to stdout.
+func NewDecisionLog(path string) (*DecisionLog, error) {
+	f := os.Stdout
+	if path != "-" {
+		var err error
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	writeHeader := true
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() && fi.Size() > 0 {
+		writeHeader = false
+	}
+
+	d := &DecisionLog{
+		rows: make(chan []string, decisionLogQueueSize),
+		done: make(chan struct{}),
+		file: f,
+	}
+	go d.writerLoop(f, writeHeader)
+	return d, nil
+}
+
+func (d *DecisionLog) writerLoop(w io.Writer, writeHeader bool) {
+	defer close(d.done)
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	flush := func() {
+		cw.Flush()
+		if err := bw.Flush(); err != nil {
+			klog.ErrorS(err, "Failed to flush decision log")
+		}
+	}
+	if writeHeader {
+		_ = cw.Write(decisionLogHeader)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case row, ok := <-d.rows:
+			if !ok {
+				flush()
+				return
+			}
+			if err := cw.Write(row); err != nil {
+				klog.ErrorS(err, "Failed to write decision log row")
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Record queues a row for the decided key (namespace/pod). It never blocks.
+// hops is the number of relay hops from the leader to the winning scheduler, or -1 if it is not known.
+func (d *DecisionLog) Record(key string, winner Score, competitors int, latency time.Duration, hops int) {
+	if d == nil {
+		return
+	}
+	namespace, pod, _ := strings.Cut(key, "/")
+	hopsColumn := ""
+	if hops >= 0 {
+		hopsColumn = strconv.Itoa(hops)
+	}
+	row := []string{
+		pod,
+		namespace,
+		winner.NodeName,
+		strconv.Itoa(winner.Score),
+		strconv.Itoa(competitors),
+		strconv.FormatInt(latency.Microseconds(), 10),
+		hopsColumn,
+	}
+	d.closedLock.RLock()
+	defer d.closedLock.RUnlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.rows <- row:
+	default:
+		decisionLogDroppedCounter.Inc()
+	}
+}
+
+// Close flushes pending rows and closes the file. Rows recorded after Close are discarded.
+func (d *DecisionLog) Close() error {
+	d.closedLock.Lock()
+	d.closed = true
+	close(d.rows)
+	d.closedLock.Unlock()
+	<-d.done
+	if d.file == os.Stdout {
+		return nil
+	}
+	return d.file.Close()
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package scoreevaluator
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecisionLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.csv")
+
+	// Two runs appending to the same file only write the header once. The second doesn't know the hops
+	for _, hops := range []int{2, -1} {
+		d, err := NewDecisionLog(path)
+		if err != nil {
+			t.Fatalf("NewDecisionLog() error = %v", err)
+		}
+		d.Record("ns/pod-1", Score{NodeName: "node-1", Score: 42}, 3, 1500*time.Microsecond, hops)
+		if err := d.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	want := [][]string{
+		decisionLogHeader,
+		{"pod-1", "ns", "node-1", "42", "3", "1500", "2"},
+		{"pod-1", "ns", "node-1", "42", "3", "1500", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+}
+
+func TestDecisionLogNil(t *testing.T) {
+	var d *DecisionLog
+	// Must not panic
+	d.Record("ns/pod-1", Score{NodeName: "node-1", Score: 42}, 1, time.Millisecond, -1)
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package scoreevaluator
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	blockedWaitersGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_score_evaluator_blocked_waiters",
+			Help: "Number of CollectScore calls blocked waiting for their key's winner",
+		},
+	)
+	activeEvaluatorsGauge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Name: "distscheduler_active_evaluators",
+			Help: "Number of keys whose scores are being collected",
+		},
+	)
+	shedScoresCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_score_evaluator_shed_count",
+			Help: "Number of scores rejected because too many keys were already being evaluated",
+		},
+	)
+	lateScoresCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_score_evaluator_late_count",
+			Help: "Number of scores that arrived after their key's winner was decided, and were turned away",
+		},
+	)
+	noWinnerCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_score_no_winner_count",
+			Help: "Number of keys decided with no winner because no scheduler had a feasible node for the pod",
+		},
+	)
+	decisionLogDroppedCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_decision_log_dropped_count",
+			Help: "Number of decision log rows dropped because the writer fell behind",
+		},
+	)
+	scoreCompletenessHistogram = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:    "distscheduler_score_completeness",
+			Help:    "Scores received / scores expected when a key's winner is decided. Below 1 means stragglers were cut off by the collection delay",
+			Buckets: metrics.LinearBuckets(0.1, 0.1, 10),
+		},
+	)
+	winningScoreHistogram = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:    "distscheduler_winning_score",
+			Help:    "Score of the winning node of each decided key, before weighting. Compare with distscheduler_node_score_distribution to see how close the schedulers' picks are",
+			Buckets: metrics.LinearBuckets(0, 25, 41),
+		},
+	)
+	scoresCollectedHistogram = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Name:    "distscheduler_scores_collected_per_pod",
+			Help:    "Number of scores a key had when its winner was decided",
+			Buckets: metrics.ExponentialBuckets(1, 2, 12),
+		},
+	)
+	validationSampleCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_validation_sample_count",
+			Help: "Number of decided pods sampled by --validation-sample-rate and logged with every candidate score for offline comparison",
+		},
+	)
+	once sync.Once
+)
+
+func RegisterMetrics() {
+	once.Do(func() {
+		legacyregistry.MustRegister(blockedWaitersGauge)
+		legacyregistry.MustRegister(activeEvaluatorsGauge)
+		legacyregistry.MustRegister(shedScoresCounter)
+		legacyregistry.MustRegister(lateScoresCounter)
+		legacyregistry.MustRegister(noWinnerCounter)
+		legacyregistry.MustRegister(decisionLogDroppedCounter)
+		legacyregistry.MustRegister(scoreCompletenessHistogram)
+		legacyregistry.MustRegister(winningScoreHistogram)
+		legacyregistry.MustRegister(scoresCollectedHistogram)
+		legacyregistry.MustRegister(validationSampleCounter)
+	})
+}
@@ -4,8 +4,11 @@ package scoreevaluator
 
 import (
 	"context"
+	"errors"
+	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bchess.org/dist-scheduler/pkg/schedulerset"
@@ -15,6 +18,26 @@ import (
 type Score struct {
 	NodeName string
 	Score    int
+	// Weight multiplies Score when picking the winner. <= 0 means 1
+	Weight float64
+	// Round is the pod's round of scoring, one more each time it is sent back to be scored again
+	Round uint32
+	// Scheduler is the pod name of the scheduler that sent the score, if known
+	Scheduler string
+}
+
+// viable reports whether sc can win. A scheduler with no feasible node sends no node. A node that scored 0 can
+// still win, e.g. every score plugin returns 0 for a full node under LeastAllocated
+func (sc Score) viable() bool {
+	return sc.NodeName != "" && sc.Score >= 0
+}
+
+// weighted returns the score used to pick the winner
+func (sc Score) weighted() float64 {
+	if sc.Weight <= 0 {
+		return float64(sc.Score)
+	}
+	return float64(sc.Score) * sc.Weight
 }
 
 type oneEvaluator struct {
@@ -23,45 +46,174 @@ type oneEvaluator struct {
 	scores       []Score
 	ticker       *time.Ticker
 	highestScore Score
-	start        time.Time
+	// runnerUps are the best scores after highestScore, best first
+	runnerUps []Score
+	start     time.Time
+	// round is the Round of the first score
+	round uint32
+}
+
+// MaxRunnerUps is the most runner-up scores kept for a key, for the winner to fall back to if its node is gone
+const MaxRunnerUps = 3
+
+// ErrTooManyEvaluators is returned by RecordAndWait when a new key would exceed maxEvaluators
+var ErrTooManyEvaluators = errors.New("too many in-flight score evaluators")
+
+// ErrAlreadyDecided is returned by RecordAndWait, along with the winner, for a score that arrives after its key's
+// winner was decided without it
+var ErrAlreadyDecided = errors.New("score arrived after the winner was decided")
+
+// decidedKey is a key whose winner was recently decided
+type decidedKey struct {
+	winner Score
+	// round is the Round the winner was decided in
+	round uint32
+	until time.Time
+}
+
+// isNewRound reports whether score starts another round of scoring for the key, e.g. after a failed bind,
+// rather than straggling in from the decided one
+func (d decidedKey) isNewRound(score Score) bool {
+	return score.Round > d.round
 }
 
 type ScoreEvaluator struct {
 	lock         sync.Mutex
 	schedulerSet *schedulerset.SchedulerSet
 	evaluators   map[string]*oneEvaluator
-	delay        time.Duration
+	// decided remembers keys for a window after their winner is decided, to turn away stragglers. decidedOrder
+	// is the keys in the order they were decided, to expire them
+	decided      map[string]decidedKey
+	decidedOrder []string
+	// delay is how long a key waits for scores per relay tier, as pods take longer to reach deeper trees' leaves.
+	// A time.Duration, as it can be changed while keys are being evaluated
+	delay atomic.Int64
+	// timeout, if set, is the total window regardless of the relay depth, in place of delay. A time.Duration
+	timeout atomic.Int64
+	// maxEvaluators bounds the number of keys being evaluated at once, and thus the number of
+	// goroutines blocked in RecordAndWait. 0 means unbounded.
+	maxEvaluators int
+	// minLimit is the fewest scores a key needs before it can fire early, in case the member count
+	// reads transiently low during a scale-up
+	minLimit    uint32
+	decisionLog *DecisionLog
+	validator   *Validator
 }
 
-func New(delay time.Duration, schedulerSet *schedulerset.SchedulerSet) *ScoreEvaluator {
-	return &ScoreEvaluator{
-		lock:         sync.Mutex{},
-		schedulerSet: schedulerSet,
-		evaluators:   make(map[string]*oneEvaluator),
-		delay:        delay,
+// New returns a ScoreEvaluator that waits up to delay per relay tier below the leader for every scheduler's score
+func New(delay time.Duration, schedulerSet *schedulerset.SchedulerSet, maxEvaluators int) *ScoreEvaluator {
+	e := &ScoreEvaluator{
+		lock:          sync.Mutex{},
+		schedulerSet:  schedulerSet,
+		evaluators:    make(map[string]*oneEvaluator),
+		decided:       make(map[string]decidedKey),
+		maxEvaluators: maxEvaluators,
 	}
+	e.SetDelay(delay)
+	return e
+}
+
+// SetDelay changes how long keys wait for scores per relay tier, clearing any timeout. Keys already being
+// evaluated keep their window.
+func (e *ScoreEvaluator) SetDelay(delay time.Duration) {
+	e.delay.Store(int64(delay))
+	e.timeout.Store(0)
 }
 
-func (e *ScoreEvaluator) RecordAndWait(key string, score Score) Score {
-	// returns the highest score for the key among all recorded
+// SetTimeout makes keys wait for scores this long in total, however deep the relay tree, instead of a fixed
+// delay per relay tier. 0 goes back to the delay.
+func (e *ScoreEvaluator) SetTimeout(timeout time.Duration) {
+	e.timeout.Store(int64(timeout))
+}
+
+// Delay is how long keys wait for scores per relay tier. With a timeout, it is the timeout divided by the relay depth
+func (e *ScoreEvaluator) Delay() time.Duration {
+	if timeout := time.Duration(e.timeout.Load()); timeout > 0 {
+		return timeout / time.Duration(max(e.schedulerSet.RelayDepth(), 1))
+	}
+	return time.Duration(e.delay.Load())
+}
+
+// RecordAndWait records a score for the key and blocks until the key's winner is decided.
+// Returns the highest score for the key among all recorded.
+// Scores for a key that is not yet being evaluated are shed with ErrTooManyEvaluators
+// if maxEvaluators keys are already in flight. A score for a key that was just decided without it
+// returns right away with ErrAlreadyDecided.
+func (e *ScoreEvaluator) RecordAndWait(key string, score Score) (Score, error) {
+	highestScore, _, err := e.RecordAndWaitRanked(key, score)
+	return highestScore, err
+}
+
+// RecordAndWaitRanked is RecordAndWait, also returning up to MaxRunnerUps of the next best scores, best first
+func (e *ScoreEvaluator) RecordAndWaitRanked(key string, score Score) (Score, []Score, error) {
 	e.lock.Lock()
 	o, ok := e.evaluators[key]
 	if !ok {
+		if d, decided := e.decided[key]; decided && time.Now().Before(d.until) && !d.isNewRound(score) {
+			e.lock.Unlock()
+			lateScoresCounter.Inc()
+			return d.winner, nil, ErrAlreadyDecided
+		}
+		delete(e.decided, key)
+		if e.maxEvaluators > 0 && len(e.evaluators) >= e.maxEvaluators {
+			e.lock.Unlock()
+			shedScoresCounter.Inc()
+			return Score{}, nil, ErrTooManyEvaluators
+		}
 		o = startOneEvaluator(key, e)
+		o.round = score.Round
 		e.evaluators[key] = o
+		activeEvaluatorsGauge.Set(float64(len(e.evaluators)))
 	}
 	e.lock.Unlock()
 
 	o.cond.L.Lock()
 	defer o.cond.L.Unlock()
+	if o.highestScore.Score != -1 {
+		// Fired in between looking up the evaluator and locking it. Waiting would never be woken
+		lateScoresCounter.Inc()
+		return o.highestScore, nil, ErrAlreadyDecided
+	}
 	o.scores = append(o.scores, score)
+	if len(o.scores) >= int(o.limit) {
+		// Schedulers may have joined since the evaluator started
+		o.limit = max(o.limit, e.scoreLimit())
+	}
 	if len(o.scores) >= int(o.limit) {
 		// We have scores from all schedulers so fire early
 		o.fire(e, key, true)
-		return o.highestScore
+		return o.highestScore, o.runnerUps, nil
 	}
+	blockedWaitersGauge.Inc()
 	o.cond.Wait()
-	return o.highestScore
+	blockedWaitersGauge.Dec()
+	return o.highestScore, o.runnerUps, nil
+}
+
+// SetMinLimit sets the fewest scores a key needs before its winner is decided without waiting out the delay
+func (e *ScoreEvaluator) SetMinLimit(n int) {
+	e.minLimit = uint32(max(n, 0))
+}
+
+// scoreLimit is the number of scores after which a key fires early
+func (e *ScoreEvaluator) scoreLimit() uint32 {
+	return max(e.schedulerSet.GetMemberCountNoRelays(), e.minLimit)
+}
+
+// window is how long a key waits for scores before its winner is decided without them all
+func (e *ScoreEvaluator) window() time.Duration {
+	// A solo or empty set still gets one tier's worth
+	return e.Delay() * time.Duration(max(e.schedulerSet.RelayDepth(), 1))
+}
+
+// SetDecisionLog records every decided key to the given log
+func (e *ScoreEvaluator) SetDecisionLog(d *DecisionLog) {
+	e.decisionLog = d
+}
+
+// SetValidator logs a sample of decided keys for offline comparison
+func (e *ScoreEvaluator) SetValidator(v *Validator) {
+	e.validator = v
 }
 
 func startOneEvaluator(key string, e *ScoreEvaluator) *oneEvaluator {
@@ -69,9 +221,9 @@ func startOneEvaluator(key string, e *ScoreEvaluator) *oneEvaluator {
 		cond: sync.Cond{
 			L: &sync.Mutex{},
 		},
-		limit:  e.schedulerSet.GetMemberCountNoRelays(),
+		limit:  e.scoreLimit(),
 		scores: []Score{},
-		ticker: time.NewTicker(e.delay),
+		ticker: time.NewTicker(e.window()),
 		highestScore: Score{
 			NodeName: "",
 			Score:    -1,
@@ -85,6 +237,35 @@ func startOneEvaluator(key string, e *ScoreEvaluator) *oneEvaluator {
 	return o
 }
 
+// runnerUps returns up to n of scores other than winner, best first
+func runnerUps(scores []Score, winner Score, n int) []Score {
+	top := make([]Score, 0, n)
+	skippedWinner := false
+	for _, sc := range scores {
+		if !sc.viable() {
+			continue
+		}
+		if !skippedWinner && sc == winner {
+			skippedWinner = true
+			continue
+		}
+		// Insert sc behind every score at least as good, keeping the top n
+		i := len(top)
+		for i > 0 && top[i-1].weighted() < sc.weighted() {
+			i--
+		}
+		if i >= n {
+			continue
+		}
+		if len(top) < n {
+			top = append(top, Score{})
+		}
+		copy(top[i+1:], top[i:len(top)-1])
+		top[i] = sc
+	}
+	return top
+}
+
 func (o *oneEvaluator) fire(e *ScoreEvaluator, key string, alreadyHasLock bool) {
 	logger := klog.FromContext(context.Background()).WithName("ScoreEvaluator")
 	if !alreadyHasLock {
@@ -96,19 +277,22 @@ func (o *oneEvaluator) fire(e *ScoreEvaluator, key string, alreadyHasLock bool)
 		return
 	}
 
-	// Pick highest score
+	// Pick highest weighted score
 	// highestScores keeps all the scores that have the highest score, and then we pick randomly among them. Only pick from 100
-	maxScore := -1
+	maxScore := math.Inf(-1)
 	candidates := make([]Score, 0, 100)
 
 	for _, sc := range o.scores {
-		switch {
-		case sc.Score > maxScore:
+		if !sc.viable() {
+			continue
+		}
+		switch w := sc.weighted(); {
+		case w > maxScore:
 			// found a new best
-			maxScore = sc.Score
+			maxScore = w
 			candidates = candidates[:0] // reset the list
 			candidates = append(candidates, sc)
-		case sc.Score == maxScore:
+		case w == maxScore:
 			// tie for best, add but cap at 100
 			if len(candidates) < 100 {
 				candidates = append(candidates, sc)
@@ -116,11 +300,93 @@ func (o *oneEvaluator) fire(e *ScoreEvaluator, key string, alreadyHasLock bool)
 		}
 	}
 
-	// There should always be at least one
-	o.highestScore = candidates[rand.Intn(len(candidates))]
-	logger.Info("Fired", "key", key, "winner", o.highestScore.NodeName, "winning_score", o.highestScore.Score, "score_count", len(o.scores), "duration_ms", time.Since(o.start).Milliseconds())
+	duration := time.Since(o.start)
+	if o.limit > 0 {
+		// More scores than expected (the membership shrank) still counts as complete
+		scoreCompletenessHistogram.Observe(min(float64(len(o.scores))/float64(o.limit), 1))
+	}
+	scoresCollectedHistogram.Observe(float64(len(o.scores)))
+	if len(candidates) == 0 {
+		// Every scheduler that scored had no feasible node, as opposed to scores lost on the way, so nobody
+		// would bind
+		o.highestScore = Score{NodeName: "", Score: 0}
+		noWinnerCounter.Inc()
+		logger.Info("Fired with no viable node", "key", key, "score_count", len(o.scores), "expected_count", o.limit, "duration_ms", duration.Milliseconds())
+	} else {
+		// There should always be at least one
+		o.highestScore = candidates[rand.Intn(len(candidates))]
+		o.runnerUps = runnerUps(o.scores, o.highestScore, MaxRunnerUps)
+		winningScoreHistogram.Observe(float64(o.highestScore.Score))
+		logger.Info("Fired", "key", key, "winner", o.highestScore.NodeName, "winning_score", o.highestScore.Score, "score_count", len(o.scores), "expected_count", o.limit, "duration_ms", duration.Milliseconds())
+	}
+	hops, ok := e.schedulerSet.Hops(o.highestScore.Scheduler)
+	if !ok {
+		hops = -1
+	}
+	e.decisionLog.Record(key, o.highestScore, len(o.scores), duration, hops)
+	e.validator.Log(context.Background(), key, o.highestScore, o.scores)
+	until := time.Now().Add(e.window())
 	e.lock.Lock()
 	delete(e.evaluators, key)
+	activeEvaluatorsGauge.Set(float64(len(e.evaluators)))
+	e.expireDecided()
+	e.decided[key] = decidedKey{winner: o.highestScore, round: o.round, until: until}
+	e.decidedOrder = append(e.decidedOrder, key)
 	e.lock.Unlock()
 	o.cond.Broadcast()
 }
+
+// janitorWindows is how many windows old an evaluator must be for the janitor to decide it. Its own timer
+// should have done so after one
+const janitorWindows = 3
+
+// RunJanitor decides, with the scores they have, the keys that have outlived janitorWindows windows, so that
+// the evaluators can't pile up if their timers fail to. Runs until ctx is done.
+func (e *ScoreEvaluator) RunJanitor(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.window()):
+			if reaped := e.reap(time.Now().Add(-janitorWindows * e.window())); reaped > 0 {
+				klog.Warningf("ScoreEvaluator janitor decided %d keys started before %v", reaped, janitorWindows*e.window())
+			}
+		}
+	}
+}
+
+// reap decides the keys that started before cutoff and returns how many there were
+func (e *ScoreEvaluator) reap(cutoff time.Time) int {
+	type stale struct {
+		key string
+		o   *oneEvaluator
+	}
+	var reaped []stale
+	e.lock.Lock()
+	for key, o := range e.evaluators {
+		if o.start.Before(cutoff) {
+			reaped = append(reaped, stale{key, o})
+		}
+	}
+	e.lock.Unlock()
+	// fire takes the lock itself
+	for _, r := range reaped {
+		r.o.fire(e, r.key, false)
+	}
+	return len(reaped)
+}
+
+// expireDecided forgets the decided keys whose window has passed. Must be called with lock held.
+func (e *ScoreEvaluator) expireDecided() {
+	now := time.Now()
+	for len(e.decidedOrder) > 0 {
+		key := e.decidedOrder[0]
+		if d, ok := e.decided[key]; ok {
+			if now.Before(d.until) {
+				return
+			}
+			delete(e.decided, key)
+		}
+		e.decidedOrder = e.decidedOrder[1:]
+	}
+}
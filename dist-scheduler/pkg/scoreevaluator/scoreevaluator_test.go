@@ -0,0 +1,504 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package scoreevaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/schedulerset"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func newTestSchedulerSet(t *testing.T, podNames ...string) *schedulerset.SchedulerSet {
+	ss, err := schedulerset.NewSchedulerSet(context.Background(), fake.NewSimpleClientset(), "default", "test-pod", 10, false, 0)
+	if err != nil {
+		t.Fatalf("NewSchedulerSet() error = %v", err)
+	}
+	members := make([]schedulerset.EndpointItem, len(podNames))
+	for i, podName := range podNames {
+		members[i] = schedulerset.EndpointItem{
+			PodName:   podName,
+			Addresses: []string{podName},
+		}
+	}
+	ss.SetMembersForTest(members)
+	return ss
+}
+
+func TestRecordAndWaitMaxEvaluators(t *testing.T) {
+	// Two schedulers so that a single score blocks until the delay fires
+	ss := newTestSchedulerSet(t, "scheduler-1", "scheduler-2")
+	e := New(200*time.Millisecond, ss, 2)
+
+	type result struct {
+		score Score
+		err   error
+	}
+	results := make(chan result, 2)
+	for _, key := range []string{"ns/pod-a", "ns/pod-b"} {
+		go func(key string) {
+			sc, err := e.RecordAndWait(key, Score{NodeName: "node-1", Score: 10})
+			results <- result{sc, err}
+		}(key)
+	}
+
+	// Wait for both keys to be in flight
+	deadline := time.Now().Add(time.Second)
+	for {
+		e.lock.Lock()
+		n := len(e.evaluators)
+		e.lock.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("evaluators = %d, want 2", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A third key is shed
+	if _, err := e.RecordAndWait("ns/pod-c", Score{NodeName: "node-1", Score: 10}); !errors.Is(err, ErrTooManyEvaluators) {
+		t.Errorf("RecordAndWait() error = %v, want %v", err, ErrTooManyEvaluators)
+	}
+
+	// A score for a key already in flight is accepted and completes it
+	sc, err := e.RecordAndWait("ns/pod-a", Score{NodeName: "node-2", Score: 20})
+	if err != nil {
+		t.Fatalf("RecordAndWait() error = %v", err)
+	}
+	if sc.NodeName != "node-2" {
+		t.Errorf("RecordAndWait() winner = %q, want node-2", sc.NodeName)
+	}
+
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Errorf("RecordAndWait() error = %v", r.err)
+		}
+	}
+
+	// Once the in-flight keys have fired there is room again
+	if _, err := e.RecordAndWait("ns/pod-c", Score{NodeName: "node-1", Score: 10}); err != nil {
+		t.Errorf("RecordAndWait() after drain error = %v", err)
+	}
+}
+
+func TestRecordAndWaitUnbounded(t *testing.T) {
+	ss := newTestSchedulerSet(t, "scheduler-1")
+	e := New(time.Second, ss, 0)
+	for _, key := range []string{"ns/pod-a", "ns/pod-b", "ns/pod-c"} {
+		sc, err := e.RecordAndWait(key, Score{NodeName: "node-1", Score: 10})
+		if err != nil {
+			t.Fatalf("RecordAndWait(%q) error = %v", key, err)
+		}
+		if sc.NodeName != "node-1" {
+			t.Errorf("RecordAndWait(%q) winner = %q, want node-1", key, sc.NodeName)
+		}
+	}
+}
+
+func TestRecordAndWaitAfterDecided(t *testing.T) {
+	// node-2's scheduler straggles, so pod-a is decided after the delay with node-1's score alone
+	e := New(50*time.Millisecond, newTestSchedulerSet(t, "scheduler-1", "scheduler-2"), 0)
+	if _, err := e.RecordAndWait("ns/pod-a", Score{NodeName: "node-1", Score: 10}); err != nil {
+		t.Fatalf("RecordAndWait() error = %v", err)
+	}
+
+	start := time.Now()
+	winner, err := e.RecordAndWait("ns/pod-a", Score{NodeName: "node-2", Score: 90})
+	if !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("RecordAndWait() late error = %v, want %v", err, ErrAlreadyDecided)
+	}
+	if winner.NodeName != "node-1" {
+		t.Errorf("RecordAndWait() late winner = %q, want node-1", winner.NodeName)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("RecordAndWait() late score waited %v, want no wait", elapsed)
+	}
+
+	// A straggler scoring a node already scored this round is still late
+	if _, err := e.RecordAndWait("ns/pod-a", Score{NodeName: "node-1", Score: 20}); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("RecordAndWait() late rescore error = %v, want %v", err, ErrAlreadyDecided)
+	}
+
+	// The next round, e.g. after a failed bind, is scored afresh whichever node it scores
+	winner, err = e.RecordAndWait("ns/pod-a", Score{NodeName: "node-3", Score: 20, Round: 1})
+	if err != nil {
+		t.Errorf("RecordAndWait() new round error = %v", err)
+	}
+	if winner.NodeName != "node-3" || winner.Score != 20 {
+		t.Errorf("RecordAndWait() new round winner = %v, want node-3/20", winner)
+	}
+	// As is a scheduler that finds no feasible node in it
+	if _, err := e.RecordAndWait("ns/pod-a", Score{Round: 2}); errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("RecordAndWait() new round without a node error = %v, want none", err)
+	}
+}
+
+func TestRecordAndWaitWeighted(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []Score
+		want   string
+	}{
+		{
+			name:   "unweighted picks highest score",
+			scores: []Score{{NodeName: "node-1", Score: 10}, {NodeName: "node-2", Score: 20}},
+			want:   "node-2",
+		},
+		{
+			name:   "weight of 1 matches unweighted",
+			scores: []Score{{NodeName: "node-1", Score: 10, Weight: 1}, {NodeName: "node-2", Score: 20, Weight: 1}},
+			want:   "node-2",
+		},
+		{
+			name:   "weight overrides a higher raw score",
+			scores: []Score{{NodeName: "node-1", Score: 10, Weight: 3}, {NodeName: "node-2", Score: 20}},
+			want:   "node-1",
+		},
+		{
+			name:   "fractional weight demotes a higher raw score",
+			scores: []Score{{NodeName: "node-1", Score: 10}, {NodeName: "node-2", Score: 15, Weight: 0.5}},
+			want:   "node-1",
+		},
+		{
+			name:   "non-positive weight means 1",
+			scores: []Score{{NodeName: "node-1", Score: 10, Weight: -2}, {NodeName: "node-2", Score: 5}},
+			want:   "node-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podNames := make([]string, len(tt.scores))
+			for i := range podNames {
+				podNames[i] = fmt.Sprintf("scheduler-%d", i)
+			}
+			e := New(time.Second, newTestSchedulerSet(t, podNames...), 0)
+
+			results := make(chan Score, len(tt.scores))
+			for _, sc := range tt.scores {
+				go func(sc Score) {
+					winner, err := e.RecordAndWait("ns/pod-a", sc)
+					if err != nil {
+						t.Errorf("RecordAndWait() error = %v", err)
+					}
+					results <- winner
+				}(sc)
+			}
+			for range tt.scores {
+				winner := <-results
+				if winner.NodeName != tt.want {
+					t.Errorf("RecordAndWait() winner = %q, want %q", winner.NodeName, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordAndWaitMinLimit(t *testing.T) {
+	// Only one scheduler has shown up so far, but three are starting
+	ss := newTestSchedulerSet(t, "scheduler-1")
+	e := New(time.Second, ss, 0)
+	e.SetMinLimit(2)
+
+	results := make(chan Score, 3)
+	record := func(sc Score) {
+		go func() {
+			winner, err := e.RecordAndWait("ns/pod-a", sc)
+			if err != nil {
+				t.Errorf("RecordAndWait() error = %v", err)
+			}
+			results <- winner
+		}()
+	}
+	assertWaiting := func(scores int) {
+		t.Helper()
+		select {
+		case <-results:
+			t.Fatalf("RecordAndWait() fired with %d scores", scores)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	record(Score{NodeName: "node-1", Score: 10})
+	// Without the floor the member count of 1 would fire right away
+	assertWaiting(1)
+
+	// The rest of the schedulers join before the floor is reached, so the limit grows with them
+	members := make([]schedulerset.EndpointItem, 0, 3)
+	for _, podName := range []string{"scheduler-1", "scheduler-2", "scheduler-3"} {
+		members = append(members, schedulerset.EndpointItem{PodName: podName, Addresses: []string{podName}})
+	}
+	ss.SetMembersForTest(members)
+	record(Score{NodeName: "node-2", Score: 5})
+	assertWaiting(2)
+
+	record(Score{NodeName: "node-3", Score: 1})
+	for i := 0; i < 3; i++ {
+		select {
+		case winner := <-results:
+			if winner.NodeName != "node-1" {
+				t.Errorf("RecordAndWait() winner = %q, want node-1", winner.NodeName)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("RecordAndWait() did not fire once all 3 scores arrived")
+		}
+	}
+}
+
+func TestFireHistograms(t *testing.T) {
+	RegisterMetrics()
+	countBefore, _ := testutil.GetHistogramMetricCount(scoreCompletenessHistogram.ObserverMetric)
+	sumBefore, _ := testutil.GetHistogramMetricValue(scoreCompletenessHistogram.ObserverMetric)
+
+	// Only one of two schedulers reports, so the key fires after the delay with half the scores
+	ss := newTestSchedulerSet(t, "scheduler-1", "scheduler-2")
+	e := New(50*time.Millisecond, ss, 0)
+	if _, err := e.RecordAndWait("ns/pod-a", Score{NodeName: "node-1", Score: 10}); err != nil {
+		t.Fatalf("RecordAndWait() error = %v", err)
+	}
+
+	count, err := testutil.GetHistogramMetricCount(scoreCompletenessHistogram.ObserverMetric)
+	if err != nil {
+		t.Fatalf("GetHistogramMetricCount() error = %v", err)
+	}
+	if count-countBefore != 1 {
+		t.Errorf("completeness observations = %d, want 1", count-countBefore)
+	}
+	sum, err := testutil.GetHistogramMetricValue(scoreCompletenessHistogram.ObserverMetric)
+	if err != nil {
+		t.Fatalf("GetHistogramMetricValue() error = %v", err)
+	}
+	if sum-sumBefore != 0.5 {
+		t.Errorf("completeness = %v, want 0.5", sum-sumBefore)
+	}
+
+	collectedBefore, _ := testutil.GetHistogramMetricValue(scoresCollectedHistogram.ObserverMetric)
+	winningBefore, _ := testutil.GetHistogramMetricValue(winningScoreHistogram.ObserverMetric)
+	if _, err := e.RecordAndWait("ns/pod-b", Score{NodeName: "node-1", Score: 40}); err != nil {
+		t.Fatalf("RecordAndWait() error = %v", err)
+	}
+	if collected, _ := testutil.GetHistogramMetricValue(scoresCollectedHistogram.ObserverMetric); collected-collectedBefore != 1 {
+		t.Errorf("scores collected = %v, want 1", collected-collectedBefore)
+	}
+	if winning, _ := testutil.GetHistogramMetricValue(winningScoreHistogram.ObserverMetric); winning-winningBefore != 40 {
+		t.Errorf("winning score = %v, want 40", winning-winningBefore)
+	}
+}
+
+func TestFireNoViableNode(t *testing.T) {
+	RegisterMetrics()
+	before, _ := testutil.GetCounterMetricValue(noWinnerCounter)
+
+	// One scheduler has no feasible node and the other's score is negative
+	e := New(time.Second, newTestSchedulerSet(t, "scheduler-1", "scheduler-2"), 0)
+	results := make(chan Score, 2)
+	for _, sc := range []Score{{NodeName: "", Score: 0}, {NodeName: "node-2", Score: -1}} {
+		go func(sc Score) {
+			winner, runnerUps, err := e.RecordAndWaitRanked("ns/pod-a", sc)
+			if err != nil {
+				t.Errorf("RecordAndWaitRanked() error = %v", err)
+			}
+			if len(runnerUps) != 0 {
+				t.Errorf("RecordAndWaitRanked() runner-ups = %v, want none", runnerUps)
+			}
+			results <- winner
+		}(sc)
+	}
+	for i := 0; i < 2; i++ {
+		if winner := <-results; winner.NodeName != "" {
+			t.Errorf("RecordAndWaitRanked() winner = %q, want none", winner.NodeName)
+		}
+	}
+	after, err := testutil.GetCounterMetricValue(noWinnerCounter)
+	if err != nil {
+		t.Fatalf("GetCounterMetricValue() error = %v", err)
+	}
+	if after-before != 1 {
+		t.Errorf("no winner count increased by %v, want 1", after-before)
+	}
+}
+
+func TestFireZeroScoreWins(t *testing.T) {
+	RegisterMetrics()
+	before, _ := testutil.GetCounterMetricValue(noWinnerCounter)
+
+	// One scheduler has no feasible node and the other's only node is full, so every score plugin gave it 0
+	e := New(time.Second, newTestSchedulerSet(t, "scheduler-1", "scheduler-2"), 0)
+	results := make(chan Score, 2)
+	for _, sc := range []Score{{NodeName: "", Score: 0}, {NodeName: "node-2", Score: 0}} {
+		go func(sc Score) {
+			winner, err := e.RecordAndWait("ns/pod-a", sc)
+			if err != nil {
+				t.Errorf("RecordAndWait() error = %v", err)
+			}
+			results <- winner
+		}(sc)
+	}
+	for i := 0; i < 2; i++ {
+		if winner := <-results; winner.NodeName != "node-2" {
+			t.Errorf("RecordAndWait() winner = %q, want node-2", winner.NodeName)
+		}
+	}
+	if after, _ := testutil.GetCounterMetricValue(noWinnerCounter); after != before {
+		t.Errorf("no winner count increased by %v, want 0", after-before)
+	}
+}
+
+func TestReapStaleEvaluators(t *testing.T) {
+	RegisterMetrics()
+
+	// Only one of three schedulers scores, and the window is too long for the timers to fire in the test, as if
+	// the other scores were lost
+	e := New(time.Hour, newTestSchedulerSet(t, "scheduler-1", "scheduler-2", "scheduler-3"), 0)
+	results := make(chan Score, 2)
+	for _, key := range []string{"ns/pod-a", "ns/pod-b"} {
+		go func(key string) {
+			winner, _, err := e.RecordAndWaitRanked(key, Score{NodeName: "node-1", Score: 50})
+			if err != nil {
+				t.Errorf("RecordAndWaitRanked(%q) error = %v", key, err)
+			}
+			results <- winner
+		}(key)
+	}
+	for {
+		e.lock.Lock()
+		n := len(e.evaluators)
+		e.lock.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if active, _ := testutil.GetGaugeMetricValue(activeEvaluatorsGauge); active != 2 {
+		t.Errorf("active evaluators = %v, want 2", active)
+	}
+
+	if reaped := e.reap(time.Now().Add(-time.Minute)); reaped != 0 {
+		t.Errorf("reap() of evaluators that are too young = %d, want 0", reaped)
+	}
+	if reaped := e.reap(time.Now()); reaped != 2 {
+		t.Errorf("reap() = %d, want 2", reaped)
+	}
+	for i := 0; i < 2; i++ {
+		if winner := <-results; winner.NodeName != "node-1" {
+			t.Errorf("RecordAndWaitRanked() winner = %q, want node-1", winner.NodeName)
+		}
+	}
+	if active, _ := testutil.GetGaugeMetricValue(activeEvaluatorsGauge); active != 0 {
+		t.Errorf("active evaluators = %v, want 0", active)
+	}
+}
+
+func TestWindowGrowsWithDepth(t *testing.T) {
+	tests := []struct {
+		members int
+		want    time.Duration
+	}{
+		{members: 1, want: time.Second},
+		{members: 11, want: time.Second},
+		{members: 12, want: 2 * time.Second},
+		{members: 111, want: 2 * time.Second},
+		{members: 112, want: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d members", tt.members), func(t *testing.T) {
+			podNames := make([]string, tt.members)
+			for i := range podNames {
+				podNames[i] = fmt.Sprintf("scheduler-%d", i)
+			}
+			e := New(time.Second, newTestSchedulerSet(t, podNames...), 0)
+			if got := e.window(); got != tt.want {
+				t.Errorf("window() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDelay(t *testing.T) {
+	podNames := make([]string, 12)
+	for i := range podNames {
+		podNames[i] = fmt.Sprintf("scheduler-%d", i)
+	}
+	e := New(time.Second, newTestSchedulerSet(t, podNames...), 0)
+	e.SetDelay(300 * time.Millisecond)
+	if got := e.Delay(); got != 300*time.Millisecond {
+		t.Errorf("Delay() = %v, want 300ms", got)
+	}
+	// Still scaled by the two tiers
+	if got := e.window(); got != 600*time.Millisecond {
+		t.Errorf("window() = %v, want 600ms", got)
+	}
+}
+
+func TestSetTimeout(t *testing.T) {
+	podNames := make([]string, 12)
+	for i := range podNames {
+		podNames[i] = fmt.Sprintf("scheduler-%d", i)
+	}
+	e := New(time.Second, newTestSchedulerSet(t, podNames...), 0)
+	e.SetTimeout(3 * time.Second)
+	// Split over the two tiers
+	if got := e.Delay(); got != 1500*time.Millisecond {
+		t.Errorf("Delay() = %v, want 1.5s", got)
+	}
+	if got := e.window(); got != 3*time.Second {
+		t.Errorf("window() = %v, want 3s", got)
+	}
+	e.SetDelay(300 * time.Millisecond)
+	if got := e.window(); got != 600*time.Millisecond {
+		t.Errorf("window() after SetDelay() = %v, want 600ms", got)
+	}
+}
+
+func TestRecordAndWaitRankedRunnerUps(t *testing.T) {
+	scores := []Score{
+		{NodeName: "node-1", Score: 10},
+		{NodeName: "node-2", Score: 50},
+		{NodeName: "node-3", Score: 30},
+		{NodeName: "node-4", Score: 20, Weight: 2},
+		// A scheduler that found no feasible node
+		{NodeName: "", Score: 0},
+		{NodeName: "node-5", Score: 5},
+	}
+	podNames := make([]string, len(scores))
+	for i := range podNames {
+		podNames[i] = fmt.Sprintf("scheduler-%d", i)
+	}
+	e := New(time.Second, newTestSchedulerSet(t, podNames...), 0)
+
+	type result struct {
+		winner    Score
+		runnerUps []Score
+	}
+	results := make(chan result, len(scores))
+	for _, sc := range scores {
+		go func(sc Score) {
+			winner, runnerUps, err := e.RecordAndWaitRanked("ns/pod-a", sc)
+			if err != nil {
+				t.Errorf("RecordAndWaitRanked() error = %v", err)
+			}
+			results <- result{winner, runnerUps}
+		}(sc)
+	}
+	want := []string{"node-4", "node-3", "node-1"}
+	for range scores {
+		r := <-results
+		if r.winner.NodeName != "node-2" {
+			t.Errorf("RecordAndWaitRanked() winner = %q, want node-2", r.winner.NodeName)
+		}
+		got := make([]string, len(r.runnerUps))
+		for i, sc := range r.runnerUps {
+			got[i] = sc.NodeName
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("RecordAndWaitRanked() runner-ups = %v, want %v", got, want)
+		}
+	}
+}
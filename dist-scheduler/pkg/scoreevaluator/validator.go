@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package scoreevaluator
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// Validator logs a sample of decided keys with every candidate score, for comparison offline against what a
+// single scheduler with a view of every node would have chosen. No scheduler holds every node, so there is no
+// such reference to compare against while running.
+type Validator struct {
+	// sampleRate is the fraction of keys logged, 0 to 1
+	sampleRate float64
+}
+
+// NewValidator returns a Validator sampling sampleRate of keys
+func NewValidator(sampleRate float64) *Validator {
+	return &Validator{
+		sampleRate: sampleRate,
+	}
+}
+
+// Sampled reports whether key is logged. Sampling is by a hash of the key, so every scheduler agrees on it.
+func (v *Validator) Sampled(key string) bool {
+	if v == nil || v.sampleRate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()%1000000)/1000000 < v.sampleRate
+}
+
+// Log logs the distributed winner for key and scores, every score received for key, if the key is sampled
+func (v *Validator) Log(ctx context.Context, key string, winner Score, scores []Score) {
+	if !v.Sampled(key) {
+		return
+	}
+	validationSampleCounter.Inc()
+	klog.FromContext(ctx).WithName("Validator").Info("Validation sample", "key", key, "winner", winner.NodeName, "winning_score", winner.Score, "candidates", formatCandidates(scores))
+}
+
+// formatCandidates renders scores as node=score[*weight] pairs, highest weighted score first
+func formatCandidates(scores []Score) string {
+	sorted := make([]Score, len(scores))
+	copy(sorted, scores)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].weighted() > sorted[j].weighted()
+	})
+	var b strings.Builder
+	for i, sc := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sc.NodeName)
+		b.WriteByte('=')
+		b.WriteString(strconv.Itoa(sc.Score))
+		if sc.Weight > 0 && sc.Weight != 1 {
+			b.WriteByte('*')
+			b.WriteString(strconv.FormatFloat(sc.Weight, 'g', -1, 64))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package scoreevaluator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestValidatorSampled(t *testing.T) {
+	var nilValidator *Validator
+	if nilValidator.Sampled("ns/pod-1") {
+		t.Errorf("nil Validator sampled a key")
+	}
+	if NewValidator(0).Sampled("ns/pod-1") {
+		t.Errorf("Validator with rate 0 sampled a key")
+	}
+	if !NewValidator(1).Sampled("ns/pod-1") {
+		t.Errorf("Validator with rate 1 did not sample a key")
+	}
+
+	v := NewValidator(0.25)
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("ns/pod-%d", i)
+		if v.Sampled(key) {
+			sampled++
+		}
+		if v.Sampled(key) != NewValidator(0.25).Sampled(key) {
+			t.Fatalf("Sampled(%q) differs between validators", key)
+		}
+	}
+	if sampled < 2000 || sampled > 3000 {
+		t.Errorf("sampled %d of 10000 keys, want about 2500", sampled)
+	}
+}
+
+func TestFireValidates(t *testing.T) {
+	RegisterMetrics()
+	ss := newTestSchedulerSet(t, "scheduler-1", "scheduler-2")
+	e := New(time.Second, ss, 0)
+	e.SetValidator(NewValidator(1))
+	before, _ := testutil.GetCounterMetricValue(validationSampleCounter)
+
+	done := make(chan struct{})
+	go func() {
+		e.RecordAndWait("ns/pod-1", Score{NodeName: "node-1", Score: 90})
+		close(done)
+	}()
+	e.RecordAndWait("ns/pod-1", Score{NodeName: "node-2", Score: 10})
+	<-done
+
+	after, _ := testutil.GetCounterMetricValue(validationSampleCounter)
+	if got := after - before; got != 1 {
+		t.Errorf("validation samples = %v, want 1", got)
+	}
+}
+
+func TestFormatCandidates(t *testing.T) {
+	got := formatCandidates([]Score{
+		{NodeName: "node-1", Score: 50},
+		{NodeName: "node-2", Score: 40, Weight: 2},
+		{NodeName: "node-3", Score: 60, Weight: 1},
+	})
+	if want := "node-2=40*2,node-3=60,node-1=50"; got != want {
+		t.Errorf("formatCandidates() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+
+// Package selftest checks that the relay tree delivers every pod to every scheduler exactly once.
+// The leader enqueues marker pods, every scheduler reports each marker it receives back to the
+// leader, and the leader compares the reports with the current membership.
+package selftest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MarkerAnnotationKey marks a pod as a self-test marker. Markers are relayed but never scheduled.
+const MarkerAnnotationKey = "dist-scheduler.dev/self-test-marker"
+
+// MarkerNamespace is the namespace of the marker pods. They are never created, so it need not exist
+const MarkerNamespace = "dist-scheduler-self-test"
+
+func IsMarker(pod *v1.Pod) bool {
+	_, ok := pod.Annotations[MarkerAnnotationKey]
+	return ok
+}
+
+// NewMarkers returns count marker pods for the run
+func NewMarkers(runID string, count int) []*v1.Pod {
+	pods := make([]*v1.Pod, count)
+	for i := range pods {
+		pods[i] = &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("selftest-%s-%d", runID, i),
+				Namespace:   MarkerNamespace,
+				Annotations: map[string]string{MarkerAnnotationKey: runID},
+			},
+		}
+	}
+	return pods
+}
+
+// Recorder counts deliveries of each marker to each scheduler
+type Recorder struct {
+	mu         sync.Mutex
+	deliveries map[string]map[string]int
+	total      int
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		deliveries: make(map[string]map[string]int),
+	}
+}
+
+func (r *Recorder) Record(marker string, scheduler string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.deliveries[marker]
+	if !ok {
+		m = make(map[string]int)
+		r.deliveries[marker] = m
+	}
+	m[scheduler]++
+	r.total++
+}
+
+// Total returns the number of deliveries recorded across all markers
+func (r *Recorder) Total() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// Report is the outcome of Verify. Each map is keyed by marker name.
+type Report struct {
+	Markers    int `json:"markers"`
+	Schedulers int `json:"schedulers"`
+	// Missing lists the expected schedulers that never received the marker
+	Missing map[string][]string `json:"missing,omitempty"`
+	// Duplicated lists the schedulers that received the marker more than once
+	Duplicated map[string][]string `json:"duplicated,omitempty"`
+	// Unexpected lists the schedulers that received the marker but are not members
+	Unexpected map[string][]string `json:"unexpected,omitempty"`
+}
+
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Duplicated) == 0 && len(r.Unexpected) == 0
+}
+
+// Verify checks that each marker was delivered exactly once to each of the expected schedulers
+func (r *Recorder) Verify(markers []string, expected []string) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := &Report{
+		Markers:    len(markers),
+		Schedulers: len(expected),
+		Missing:    map[string][]string{},
+		Duplicated: map[string][]string{},
+		Unexpected: map[string][]string{},
+	}
+	for _, marker := range markers {
+		got := r.deliveries[marker]
+		for _, scheduler := range expected {
+			switch n := got[scheduler]; {
+			case n == 0:
+				report.Missing[marker] = append(report.Missing[marker], scheduler)
+			case n > 1:
+				report.Duplicated[marker] = append(report.Duplicated[marker], scheduler)
+			}
+		}
+		for scheduler := range got {
+			if !slices.Contains(expected, scheduler) {
+				report.Unexpected[marker] = append(report.Unexpected[marker], scheduler)
+			}
+		}
+		slices.Sort(report.Unexpected[marker])
+	}
+	return report
+}
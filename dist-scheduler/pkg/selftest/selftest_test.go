@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package selftest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMarkers(t *testing.T) {
+	pods := NewMarkers("run1", 3)
+	if len(pods) != 3 {
+		t.Fatalf("NewMarkers() = %d pods, want 3", len(pods))
+	}
+	for _, pod := range pods {
+		if !IsMarker(pod) {
+			t.Errorf("IsMarker(%s) = false, want true", pod.Name)
+		}
+	}
+	if pods[0].Name == pods[1].Name {
+		t.Errorf("NewMarkers() names are not unique: %s", pods[0].Name)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	schedulers := []string{"dist-scheduler-0", "dist-scheduler-1", "dist-scheduler-2"}
+	markers := []string{"m0", "m1", "m2"}
+
+	r := NewRecorder()
+	// m0 is delivered correctly
+	for _, s := range schedulers {
+		r.Record("m0", s)
+	}
+	// m1 is dropped on dist-scheduler-2 and duplicated on dist-scheduler-1
+	r.Record("m1", "dist-scheduler-0")
+	r.Record("m1", "dist-scheduler-1")
+	r.Record("m1", "dist-scheduler-1")
+	// m2 also reaches a scheduler that is not a member
+	for _, s := range schedulers {
+		r.Record("m2", s)
+	}
+	r.Record("m2", "dist-scheduler-9")
+
+	if got := r.Total(); got != 10 {
+		t.Errorf("Total() = %d, want 10", got)
+	}
+
+	report := r.Verify(markers, schedulers)
+	if report.OK() {
+		t.Fatalf("Verify().OK() = true, want false")
+	}
+	if want := map[string][]string{"m1": {"dist-scheduler-2"}}; !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("Missing = %v, want %v", report.Missing, want)
+	}
+	if want := map[string][]string{"m1": {"dist-scheduler-1"}}; !reflect.DeepEqual(report.Duplicated, want) {
+		t.Errorf("Duplicated = %v, want %v", report.Duplicated, want)
+	}
+	if want := map[string][]string{"m2": {"dist-scheduler-9"}}; !reflect.DeepEqual(report.Unexpected, want) {
+		t.Errorf("Unexpected = %v, want %v", report.Unexpected, want)
+	}
+
+	if report := r.Verify([]string{"m0"}, schedulers); !report.OK() {
+		t.Errorf("Verify(m0).OK() = false, report %+v", report)
+	}
+}
@@ -2,12 +2,52 @@
 // Copyright 2025 Benjamin Chess
 package util
 
-import "strings"
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// UnixScheme prefixes an address that is a Unix domain socket path rather than host:port
+const UnixScheme = "unix://"
+
+// DefaultGRPCPort is the port of the --grpc-addr default
+const DefaultGRPCPort = "50051"
 
 func GRPCAddress(addr string, port string) string {
 	// Returns an address that can be used with grpc.NewClient
+	if strings.HasPrefix(addr, UnixScheme) {
+		// grpc.NewClient resolves unix:// itself, and a socket has no port
+		return addr
+	}
 	if strings.Contains(addr, ":") {
 		addr = "[" + addr + "]"
 	}
 	return addr + ":" + port
 }
+
+// ListenAddress splits a server address into the network and address for net.Listen.
+// unix:///path/to.sock listens on a Unix domain socket, anything else is a TCP host:port.
+func ListenAddress(address string) (network string, addr string) {
+	if path, ok := strings.CutPrefix(address, UnixScheme); ok {
+		return "unix", path
+	}
+	return "tcp", address
+}
+
+// GRPCPort is the port of a --grpc-addr server address, which the other members listen on too. A Unix domain
+// socket has no port, so a scheduler listening on one still dials the others on DefaultGRPCPort.
+func GRPCPort(address string) (string, error) {
+	network, addr := ListenAddress(address)
+	if network == "unix" {
+		return DefaultGRPCPort, nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid gRPC address %q: %w", address, err)
+	}
+	if port == "" {
+		return "", fmt.Errorf("invalid gRPC address %q: missing port", address)
+	}
+	return port, nil
+}
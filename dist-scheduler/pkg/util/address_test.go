@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import "testing"
+
+func TestGRPCAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.1:50051"},
+		{"fd00::1", "[fd00::1]:50051"},
+		{"unix:///run/dist-scheduler/grpc.sock", "unix:///run/dist-scheduler/grpc.sock"},
+	}
+	for _, tt := range tests {
+		if got := GRPCAddress(tt.addr, "50051"); got != tt.want {
+			t.Errorf("GRPCAddress(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestGRPCPort(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{address: ":50051", want: "50051"},
+		{address: "0.0.0.0:6000", want: "6000"},
+		{address: "[::]:6000", want: "6000"},
+		{address: "unix:///run/dist-scheduler/grpc.sock", want: DefaultGRPCPort},
+		{address: "localhost", wantErr: true},
+		{address: "localhost:", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := GRPCPort(tt.address)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("GRPCPort(%q) = %q, %v, want %q, error %v", tt.address, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		address     string
+		wantNetwork string
+		wantAddr    string
+	}{
+		{":50051", "tcp", ":50051"},
+		{"127.0.0.1:50051", "tcp", "127.0.0.1:50051"},
+		{"unix:///run/dist-scheduler/grpc.sock", "unix", "/run/dist-scheduler/grpc.sock"},
+	}
+	for _, tt := range tests {
+		network, addr := ListenAddress(tt.address)
+		if network != tt.wantNetwork || addr != tt.wantAddr {
+			t.Errorf("ListenAddress(%q) = %q, %q, want %q, %q", tt.address, network, addr, tt.wantNetwork, tt.wantAddr)
+		}
+	}
+}
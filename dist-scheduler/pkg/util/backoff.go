@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// ReconnectBackoff tracks connection failures per destination. After maxFailures failures within
+// window, the destination is considered dead and Allow returns false until cooldown has passed.
+// A nil *ReconnectBackoff or a maxFailures of 0 never marks a destination dead.
+type ReconnectBackoff struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	cooldown    time.Duration
+	now         func() time.Time
+	// onDeadChange is called with the lock held whenever a destination becomes dead or is retried
+	onDeadChange func(destination string, dead bool)
+	destinations map[string]*destinationState
+}
+
+type destinationState struct {
+	failures  []time.Time
+	deadUntil time.Time
+}
+
+func NewReconnectBackoff(maxFailures int, window time.Duration, cooldown time.Duration, onDeadChange func(destination string, dead bool)) *ReconnectBackoff {
+	if onDeadChange == nil {
+		onDeadChange = func(string, bool) {}
+	}
+	return &ReconnectBackoff{
+		maxFailures:  maxFailures,
+		window:       window,
+		cooldown:     cooldown,
+		now:          time.Now,
+		onDeadChange: onDeadChange,
+		destinations: make(map[string]*destinationState),
+	}
+}
+
+// Allow reports whether a connection to the destination may be attempted.
+func (b *ReconnectBackoff) Allow(destination string) bool {
+	if b == nil || b.maxFailures <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, ok := b.destinations[destination]
+	if !ok || d.deadUntil.IsZero() {
+		return true
+	}
+	if b.now().Before(d.deadUntil) {
+		return false
+	}
+	// Cooldown has passed, let the next attempt through. Another maxFailures failures are needed to mark it dead again.
+	d.deadUntil = time.Time{}
+	d.failures = d.failures[:0]
+	b.onDeadChange(destination, false)
+	return true
+}
+
+// RecordFailure records a failed connection attempt and returns true if the destination is now dead.
+func (b *ReconnectBackoff) RecordFailure(destination string) bool {
+	if b == nil || b.maxFailures <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, ok := b.destinations[destination]
+	if !ok {
+		d = &destinationState{}
+		b.destinations[destination] = d
+	}
+	if !d.deadUntil.IsZero() {
+		return true
+	}
+	now := b.now()
+	// Drop failures that have aged out of the window
+	cutoff := now.Add(-b.window)
+	i := 0
+	for i < len(d.failures) && !d.failures[i].After(cutoff) {
+		i++
+	}
+	d.failures = append(d.failures[i:], now)
+	if len(d.failures) < b.maxFailures {
+		return false
+	}
+	d.deadUntil = now.Add(b.cooldown)
+	b.onDeadChange(destination, true)
+	return true
+}
+
+// RecordSuccess forgets previous failures for the destination.
+func (b *ReconnectBackoff) RecordSuccess(destination string) {
+	if b == nil || b.maxFailures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.destinations, destination)
+}
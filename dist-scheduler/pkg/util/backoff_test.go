@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	now := time.Unix(0, 0)
+	dead := map[string]bool{}
+	b := NewReconnectBackoff(3, 10*time.Second, 30*time.Second, func(destination string, d bool) {
+		dead[destination] = d
+	})
+	b.now = func() time.Time { return now }
+
+	// Failures spread wider than the window never mark the destination dead
+	for i := 0; i < 5; i++ {
+		if b.RecordFailure("a") {
+			t.Fatalf("RecordFailure() #%d = true, want false", i)
+		}
+		now = now.Add(6 * time.Second)
+	}
+
+	// Three failures within the window do
+	now = now.Add(10 * time.Second)
+	if b.RecordFailure("a") || b.RecordFailure("a") {
+		t.Fatalf("RecordFailure() = true before reaching maxFailures")
+	}
+	if !b.RecordFailure("a") {
+		t.Fatalf("RecordFailure() = false, want true")
+	}
+	if !dead["a"] {
+		t.Errorf("onDeadChange not called with dead = true")
+	}
+	if b.Allow("a") {
+		t.Errorf("Allow() during cooldown = true, want false")
+	}
+	if !b.Allow("b") {
+		t.Errorf("Allow() for other destination = false, want true")
+	}
+
+	// After the cooldown one attempt is let through
+	now = now.Add(30 * time.Second)
+	if !b.Allow("a") {
+		t.Errorf("Allow() after cooldown = false, want true")
+	}
+	if dead["a"] {
+		t.Errorf("onDeadChange not called with dead = false")
+	}
+	if b.RecordFailure("a") {
+		t.Errorf("RecordFailure() after cooldown = true, want false")
+	}
+
+	// Success forgets the failures
+	b.RecordFailure("a")
+	b.RecordSuccess("a")
+	if b.RecordFailure("a") {
+		t.Errorf("RecordFailure() after success = true, want false")
+	}
+}
+
+func TestReconnectBackoffDisabled(t *testing.T) {
+	var nilBackoff *ReconnectBackoff
+	for _, b := range []*ReconnectBackoff{nilBackoff, NewReconnectBackoff(0, time.Second, time.Second, nil)} {
+		for i := 0; i < 10; i++ {
+			if b.RecordFailure("a") {
+				t.Fatalf("RecordFailure() = true, want false")
+			}
+		}
+		if !b.Allow("a") {
+			t.Errorf("Allow() = false, want true")
+		}
+	}
+}
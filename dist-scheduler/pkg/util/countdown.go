@@ -20,6 +20,19 @@ func NewCountDownLatch(n int, ratio float64) CountDownLatch {
 	return c
 }
 
+// NewCountDownLatchAbsolute returns a latch that is released after waitFor of the n expected
+// Done() calls. If waitFor >= n, it waits for all n.
+func NewCountDownLatchAbsolute(n int, waitFor int) CountDownLatch {
+	if waitFor >= n {
+		r := &CountDownLatchAsWaitGroup{wg: sync.WaitGroup{}}
+		r.wg.Add(n)
+		return r
+	}
+	c := &CountDownLatchAsMutex{count: waitFor}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
 type CountDownLatchAsMutex struct {
 	mu    sync.Mutex
 	count int
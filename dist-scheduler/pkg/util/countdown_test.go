@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+// released reports whether latch.Wait() returns promptly
+func released(latch CountDownLatch) bool {
+	done := make(chan struct{})
+	go func() {
+		latch.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+func TestCountDownLatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		newLatch      func() CountDownLatch
+		releasedAt    int
+		wantWaitGroup bool
+	}{
+		{
+			name:          "ratio 1.0 waits for all",
+			newLatch:      func() CountDownLatch { return NewCountDownLatch(10, 1.0) },
+			releasedAt:    10,
+			wantWaitGroup: true,
+		},
+		{
+			name:       "ratio 0.8",
+			newLatch:   func() CountDownLatch { return NewCountDownLatch(10, 0.8) },
+			releasedAt: 8,
+		},
+		{
+			name:       "absolute all but 2 of 10",
+			newLatch:   func() CountDownLatch { return NewCountDownLatchAbsolute(10, 8) },
+			releasedAt: 8,
+		},
+		{
+			name:       "absolute all but 2 of 50",
+			newLatch:   func() CountDownLatch { return NewCountDownLatchAbsolute(50, 48) },
+			releasedAt: 48,
+		},
+		{
+			name:          "absolute waitFor == n",
+			newLatch:      func() CountDownLatch { return NewCountDownLatchAbsolute(10, 10) },
+			releasedAt:    10,
+			wantWaitGroup: true,
+		},
+		{
+			name:          "absolute waitFor > n",
+			newLatch:      func() CountDownLatch { return NewCountDownLatchAbsolute(10, 20) },
+			releasedAt:    10,
+			wantWaitGroup: true,
+		},
+		{
+			name:       "absolute waitFor 0",
+			newLatch:   func() CountDownLatch { return NewCountDownLatchAbsolute(10, 0) },
+			releasedAt: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latch := tt.newLatch()
+			if _, ok := latch.(*CountDownLatchAsWaitGroup); ok != tt.wantWaitGroup {
+				t.Errorf("latch is %T, want WaitGroup = %v", latch, tt.wantWaitGroup)
+			}
+			for i := 0; i < tt.releasedAt-1; i++ {
+				latch.Done()
+			}
+			if tt.releasedAt > 0 {
+				if released(latch) {
+					t.Fatalf("latch released after %d Done(), want %d", tt.releasedAt-1, tt.releasedAt)
+				}
+				latch.Done()
+			}
+			if !released(latch) {
+				t.Errorf("latch not released after %d Done()", tt.releasedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// DefaultGRPCKeepalive is how often an idle connection to another member is pinged. gRPC pings no more often
+// than every 10s
+const DefaultGRPCKeepalive = 10 * time.Second
+
+// GRPCConnectTimeout bounds each attempt to connect to a member, so one that black-holes the connection fails
+// within it rather than the OS TCP timeout
+const GRPCConnectTimeout = 5 * time.Second
+
+// grpcMaxReconnectDelay caps the backoff between attempts, so a member that comes back is reconnected to soon
+const grpcMaxReconnectDelay = 10 * time.Second
+
+var grpcKeepalive atomic.Int64
+
+// grpcTLS is the mutual TLS between members, nil for plaintext
+var grpcTLS atomic.Pointer[grpcTLSConfigs]
+
+type grpcTLSConfigs struct {
+	client *tls.Config
+	server *tls.Config
+}
+
+func init() {
+	SetGRPCKeepalive(DefaultGRPCKeepalive)
+}
+
+// SetGRPCKeepalive sets the ping interval of the connections dialed with GRPCDialOptions afterwards. 0 disables pings
+func SetGRPCKeepalive(interval time.Duration) {
+	grpcKeepalive.Store(int64(interval))
+}
+
+// SetGRPCTLS switches the connections between members to mutual TLS, each presenting the certificate in certFile
+// and keyFile and requiring the other's to be signed by the CA in caFile. The certificate must be usable for both
+// server and client auth. Members are dialed by pod IP, so their certificates are verified against the CA only,
+// not by name. Must be called before the gRPC server starts or any member is dialed
+func SetGRPCTLS(certFile string, keyFile string, caFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load gRPC TLS certificate: %v", err)
+	}
+	caBundle, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read gRPC TLS CA file: %v", err)
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(caBundle) {
+		return fmt.Errorf("no certificates found in gRPC TLS CA file %s", caFile)
+	}
+	grpcTLS.Store(&grpcTLSConfigs{
+		client: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			// The name is not verified, VerifyConnection checks the chain instead
+			InsecureSkipVerify: true,
+			VerifyConnection:   verifyMember(cas),
+		},
+		server: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			ClientCAs:    cas,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		},
+	})
+	return nil
+}
+
+// verifyMember verifies that a member's server certificate is signed by cas, whatever names it has
+func verifyMember(cas *x509.CertPool) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("member presented no certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         cas,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		return err
+	}
+}
+
+// grpcTransportCredentials are mutual TLS if SetGRPCTLS was called, otherwise plaintext
+func grpcTransportCredentials(server bool) credentials.TransportCredentials {
+	configs := grpcTLS.Load()
+	switch {
+	case configs == nil:
+		return insecure.NewCredentials()
+	case server:
+		return credentials.NewTLS(configs.server)
+	default:
+		return credentials.NewTLS(configs.client)
+	}
+}
+
+// GRPCDialOptions are the options for grpc.NewClient to another member. A connection whose pings go unanswered
+// for the keepalive interval is closed, failing its streams, and is redialed with backoff
+func GRPCDialOptions(opts ...grpc.DialOption) []grpc.DialOption {
+	interval := time.Duration(grpcKeepalive.Load())
+	reconnect := backoff.DefaultConfig
+	reconnect.MaxDelay = grpcMaxReconnectDelay
+	return append([]grpc.DialOption{
+		grpc.WithTransportCredentials(grpcTransportCredentials(false)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                interval,
+			Timeout:             interval,
+			PermitWithoutStream: true,
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           reconnect,
+			MinConnectTimeout: GRPCConnectTimeout,
+		}),
+	}, opts...)
+}
+
+// GRPCServerOptions are the options for the gRPC server the other members dial. By default a server closes
+// connections that ping more often than every 5 minutes, which would cut off GRPCDialOptions' keepalive
+func GRPCServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.Creds(grpcTransportCredentials(true)),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             5 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCDialOptionsBlackHole(t *testing.T) {
+	// Accepts connections but never answers the handshake
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), GRPCDialOptions()...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*GRPCConnectTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Check() error = %v, want Unavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*GRPCConnectTimeout {
+		t.Errorf("Check() failed after %v, want within about %v", elapsed, GRPCConnectTimeout)
+	}
+}
+
+// writeTestCert writes a certificate from template and its key as PEM files, signed by parent or self-signed if parent
+// is nil, returning the certificate and the key's file names
+func writeTestCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return cert, key, certFile, keyFile
+}
+
+func newTestMemberCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	cert, key, certFile, _ := writeTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "dist-scheduler-ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	return cert, key, certFile
+}
+
+func newTestMemberCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (string, string) {
+	_, _, certFile, keyFile := writeTestCert(t, &x509.Certificate{
+		// No IP SANs, members are verified against the CA only
+		Subject:     pkix.Name{CommonName: "dist-scheduler"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}, ca, caKey)
+	return certFile, keyFile
+}
+
+func TestGRPCMutualTLS(t *testing.T) {
+	ca, caKey, caFile := newTestMemberCA(t)
+	certFile, keyFile := newTestMemberCert(t, ca, caKey)
+	if err := SetGRPCTLS(certFile, keyFile, caFile); err != nil {
+		t.Fatalf("SetGRPCTLS() error = %v", err)
+	}
+	defer grpcTLS.Store(nil)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	s := grpc.NewServer(GRPCServerOptions()...)
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	otherCA, otherCAKey, _ := newTestMemberCA(t)
+	otherCertFile, otherKeyFile := newTestMemberCert(t, otherCA, otherCAKey)
+	otherCert, err := tls.LoadX509KeyPair(otherCertFile, otherKeyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []grpc.DialOption
+		wantErr bool
+	}{
+		{name: "member", opts: GRPCDialOptions()},
+		{name: "plaintext", opts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, wantErr: true},
+		{name: "no client cert", opts: []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true}))}, wantErr: true},
+		{
+			name: "client cert from another CA",
+			opts: []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+				Certificates:       []tls.Certificate{otherCert},
+				InsecureSkipVerify: true,
+			}))},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.NewClient(lis.Addr().String(), tt.opts...)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 3*GRPCConnectTimeout)
+			defer cancel()
+			_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			if tt.wantErr && err == nil {
+				t.Errorf("Check() succeeded, want the client rejected")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Check() error = %v", err)
+			}
+		})
+	}
+
+	// A member dialing a server whose certificate is from another CA rejects it
+	s2 := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{otherCert}})))
+	grpc_health_v1.RegisterHealthServer(s2, health.NewServer())
+	lis2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go s2.Serve(lis2)
+	defer s2.Stop()
+	conn, err := grpc.NewClient(lis2.Addr().String(), GRPCDialOptions()...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*GRPCConnectTimeout)
+	defer cancel()
+	if _, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}); err == nil {
+		t.Errorf("Check() of a server from another CA succeeded, want it rejected")
+	}
+}
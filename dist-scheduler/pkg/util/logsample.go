@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// DefaultLogSampleRate logs about 1 in 100 pods, as many as the pod names ending in "00" of a numbered load test
+const DefaultLogSampleRate = 0.01
+
+// logSampleThreshold is the rate scaled to the range of a 32-bit hash
+var logSampleThreshold atomic.Uint64
+
+func init() {
+	SetLogSampleRate(DefaultLogSampleRate)
+}
+
+// SetLogSampleRate sets the fraction of pods, from 0 to 1, that ShouldSampleLog picks
+func SetLogSampleRate(rate float64) {
+	logSampleThreshold.Store(uint64(math.Min(math.Max(rate, 0), 1) * (1 << 32)))
+}
+
+// ShouldSampleLog reports whether to log the progress of pod podName by default rather than only verbosely.
+// It hashes just the name, as that is all a relay decodes, so every scheduler picks the same pods and one
+// can be followed through the tree.
+func ShouldSampleLog(podName string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(podName))
+	return uint64(h.Sum32()) < logSampleThreshold.Load()
+}
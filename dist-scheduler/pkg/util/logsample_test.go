@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShouldSampleLog(t *testing.T) {
+	defer SetLogSampleRate(DefaultLogSampleRate)
+
+	const pods = 100000
+	tests := []struct {
+		rate     float64
+		min, max int
+	}{
+		{rate: 0, min: 0, max: 0},
+		{rate: 1, min: pods, max: pods},
+		{rate: 0.01, min: pods / 100 * 9 / 10, max: pods / 100 * 11 / 10},
+		{rate: 2, min: pods, max: pods},
+		{rate: -1, min: 0, max: 0},
+	}
+	for _, tt := range tests {
+		SetLogSampleRate(tt.rate)
+		sampled := 0
+		for i := 0; i < pods; i++ {
+			if ShouldSampleLog(fmt.Sprintf("res-%d", i)) {
+				sampled++
+			}
+		}
+		if sampled < tt.min || sampled > tt.max {
+			t.Errorf("rate %v sampled %d of %d pods, want %d to %d", tt.rate, sampled, pods, tt.min, tt.max)
+		}
+	}
+
+	// Short names, which the old last-two-characters check indexed out of range on
+	SetLogSampleRate(1)
+	for _, name := range []string{"", "a"} {
+		if !ShouldSampleLog(name) {
+			t.Errorf("ShouldSampleLog(%q) = false at rate 1", name)
+		}
+	}
+}
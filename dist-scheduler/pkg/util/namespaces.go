@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+// OtherNamespace is the metric label value for every namespace that is not a known tenant namespace
+const OtherNamespace = "other"
+
+// NamespaceBuckets maps namespaces to metric label values. Known namespaces keep their own name and every
+// other namespace shares OtherNamespace, bounding the label's cardinality however many namespaces there are.
+// A nil *NamespaceBuckets buckets every namespace as OtherNamespace.
+type NamespaceBuckets struct {
+	known map[string]struct{}
+}
+
+func NewNamespaceBuckets(namespaces []string) *NamespaceBuckets {
+	known := make(map[string]struct{}, len(namespaces))
+	for _, namespace := range namespaces {
+		known[namespace] = struct{}{}
+	}
+	return &NamespaceBuckets{known: known}
+}
+
+// Bucket returns the label value for namespace
+func (b *NamespaceBuckets) Bucket(namespace string) string {
+	if b == nil {
+		return OtherNamespace
+	}
+	if _, ok := b.known[namespace]; ok {
+		return namespace
+	}
+	return OtherNamespace
+}
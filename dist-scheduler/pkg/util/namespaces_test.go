@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import "testing"
+
+func TestNamespaceBuckets(t *testing.T) {
+	b := NewNamespaceBuckets([]string{"team-a", "team-b"})
+	tests := []struct {
+		namespace string
+		want      string
+	}{
+		{"team-a", "team-a"},
+		{"team-b", "team-b"},
+		{"team-c", OtherNamespace},
+		{"", OtherNamespace},
+	}
+	for _, tt := range tests {
+		if got := b.Bucket(tt.namespace); got != tt.want {
+			t.Errorf("Bucket(%q) = %q, want %q", tt.namespace, got, tt.want)
+		}
+	}
+
+	var nilBuckets *NamespaceBuckets
+	if got := nilBuckets.Bucket("team-a"); got != OtherNamespace {
+		t.Errorf("nil Bucket() = %q, want %q", got, OtherNamespace)
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const UrgentAnnotationKey = "dist-scheduler.dev/urgent"
+
+// PodQueue holds the pods waiting for ProcessOne. Pods annotated with UrgentAnnotationKey=true
+// go on a separate channel that is always drained before the normal one.
+// While paused, Enqueue still accepts pods but Dequeue does not hand any out.
+type PodQueue struct {
+	normal chan *v1.Pod
+	urgent chan *v1.Pod
+
+	pauseLock sync.Mutex
+	// resumed is non-nil while paused, and is closed on Resume()
+	resumed chan struct{}
+}
+
+// NewPodQueue holds up to size normal pods and urgentSize urgent ones. Urgent pods are expected to be few, so
+// urgentSize can be much smaller than size.
+func NewPodQueue(size, urgentSize int) *PodQueue {
+	return &PodQueue{
+		normal: make(chan *v1.Pod, size),
+		urgent: make(chan *v1.Pod, urgentSize),
+	}
+}
+
+func IsUrgent(pod *v1.Pod) bool {
+	return pod.Annotations[UrgentAnnotationKey] == "true"
+}
+
+func (q *PodQueue) Enqueue(pod *v1.Pod) {
+	if IsUrgent(pod) {
+		q.urgent <- pod
+	} else {
+		q.normal <- pod
+	}
+}
+
+// TryEnqueue is Enqueue without blocking. Returns false, leaving the pod out, if the queue is full.
+func (q *PodQueue) TryEnqueue(pod *v1.Pod) bool {
+	queue := q.normal
+	if IsUrgent(pod) {
+		queue = q.urgent
+	}
+	select {
+	case queue <- pod:
+		return true
+	default:
+		return false
+	}
+}
+
+// Dequeue blocks until a pod is available and the queue is not paused, preferring urgent pods.
+// Returns false if ctx is done.
+func (q *PodQueue) Dequeue(ctx context.Context) (*v1.Pod, bool) {
+	if !q.waitForResume(ctx) {
+		return nil, false
+	}
+
+	var pod *v1.Pod
+	select {
+	case pod = <-q.urgent:
+	default:
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case pod = <-q.urgent:
+		case pod = <-q.normal:
+		}
+	}
+
+	// We may have been paused while blocked above. Hold on to the pod until resumed.
+	if !q.waitForResume(ctx) {
+		return nil, false
+	}
+	return pod, true
+}
+
+func (q *PodQueue) waitForResume(ctx context.Context) bool {
+	q.pauseLock.Lock()
+	resumed := q.resumed
+	q.pauseLock.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-resumed:
+		return true
+	}
+}
+
+func (q *PodQueue) Pause() {
+	q.pauseLock.Lock()
+	defer q.pauseLock.Unlock()
+	if q.resumed == nil {
+		q.resumed = make(chan struct{})
+	}
+}
+
+func (q *PodQueue) Resume() {
+	q.pauseLock.Lock()
+	defer q.pauseLock.Unlock()
+	if q.resumed != nil {
+		close(q.resumed)
+		q.resumed = nil
+	}
+}
+
+func (q *PodQueue) Paused() bool {
+	q.pauseLock.Lock()
+	defer q.pauseLock.Unlock()
+	return q.resumed != nil
+}
+
+// Len returns the number of queued pods, urgent and normal.
+func (q *PodQueue) Len() int {
+	return len(q.normal) + len(q.urgent)
+}
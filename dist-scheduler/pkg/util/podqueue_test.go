@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestPod(name string, urgent bool) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if urgent {
+		pod.Annotations = map[string]string{UrgentAnnotationKey: "true"}
+	}
+	return pod
+}
+
+func TestPodQueueUrgentFirst(t *testing.T) {
+	q := NewPodQueue(100, 100)
+	for i := 0; i < 50; i++ {
+		q.Enqueue(newTestPod(fmt.Sprintf("normal-%d", i), false))
+	}
+	q.Enqueue(newTestPod("urgent", true))
+
+	if got := q.Len(); got != 51 {
+		t.Fatalf("Len() = %d, want 51", got)
+	}
+
+	pod, ok := q.Dequeue(context.Background())
+	if !ok {
+		t.Fatalf("Dequeue() returned !ok")
+	}
+	if pod.Name != "urgent" {
+		t.Errorf("Dequeue() = %s, want urgent", pod.Name)
+	}
+
+	pod, _ = q.Dequeue(context.Background())
+	if pod.Name != "normal-0" {
+		t.Errorf("Dequeue() = %s, want normal-0", pod.Name)
+	}
+}
+
+func TestPodQueueDequeueCancelled(t *testing.T) {
+	q := NewPodQueue(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := q.Dequeue(ctx); ok {
+		t.Errorf("Dequeue() on cancelled context returned ok")
+	}
+}
+
+func TestPodQueueTryEnqueue(t *testing.T) {
+	q := NewPodQueue(1, 1)
+	if !q.TryEnqueue(newTestPod("normal-0", false)) {
+		t.Fatalf("TryEnqueue() = false on an empty queue")
+	}
+	if q.TryEnqueue(newTestPod("normal-1", false)) {
+		t.Errorf("TryEnqueue() = true on a full queue")
+	}
+	// Urgent pods have room of their own
+	if !q.TryEnqueue(newTestPod("urgent", true)) {
+		t.Errorf("TryEnqueue(urgent) = false with only the normal queue full")
+	}
+	if q.TryEnqueue(newTestPod("urgent-1", true)) {
+		t.Errorf("TryEnqueue(urgent) = true on a full urgent queue")
+	}
+	if got := q.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+}
+
+func TestPodQueuePauseResume(t *testing.T) {
+	q := NewPodQueue(100, 100)
+	q.Pause()
+	if !q.Paused() {
+		t.Fatalf("Paused() = false after Pause()")
+	}
+
+	dequeued := make(chan *v1.Pod, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		go func() {
+			for {
+				pod, ok := q.Dequeue(ctx)
+				if !ok {
+					return
+				}
+				dequeued <- pod
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		q.Enqueue(newTestPod(fmt.Sprintf("normal-%d", i), false))
+	}
+	select {
+	case pod := <-dequeued:
+		t.Fatalf("Dequeue() returned %s while paused", pod.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got := q.Len(); got != 5 {
+		t.Errorf("Len() while paused = %d, want 5", got)
+	}
+
+	q.Resume()
+	if q.Paused() {
+		t.Fatalf("Paused() = true after Resume()")
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-dequeued:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d pods dequeued after Resume(), want 5", i)
+		}
+	}
+}
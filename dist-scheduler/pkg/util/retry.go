@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// IsRetryable, RetryAfter and Retry duplicate bchess.org/util, which is the authoritative copy. The
+// dist-scheduler Dockerfile builds from this module's directory alone, so it can't import that module. Change
+// both together.
+
+// IsRetryable reports whether an apiserver request that failed with err is worth retrying as is:
+// throttling (429), server errors and timeouts, or a connection that failed before any response.
+// Errors about the request itself, e.g. Invalid, Forbidden, NotFound or AlreadyExists, are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller gave up, so there is no point in trying again
+		return false
+	}
+	if _, ok := apierrors.SuggestsClientDelay(err); ok {
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		code := status.Status().Code
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError ||
+			apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err)
+}
+
+// RetryAfter is how long the apiserver asked to wait before retrying, from the Retry-After header of a 429 or
+// 5xx response. 0 if it did not say.
+func RetryAfter(err error) time.Duration {
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// DefaultAttempts is how many times a request that keeps failing with IsRetryable errors is tried
+const DefaultAttempts = 5
+
+// retryBackoff is the first wait between attempts when the apiserver gives no Retry-After. It doubles each attempt.
+const retryBackoff = 100 * time.Millisecond
+
+// Retry calls fn until it succeeds, fails with an error that is not IsRetryable, or has been called attempts
+// times, and returns its last error. Between calls it waits for RetryAfter, or an exponential backoff if the
+// apiserver gave none.
+func Retry(ctx context.Context, attempts int, fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !IsRetryable(err) {
+			return err
+		}
+		wait := RetryAfter(err)
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
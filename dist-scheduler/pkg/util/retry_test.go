@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var nodesResource = schema.GroupResource{Resource: "nodes"}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 0), want: true},
+		{name: "generic 429", err: apierrors.NewGenericServerResponse(429, "create", nodesResource, "node-1", "", 0, true), want: true},
+		{name: "internal error", err: apierrors.NewInternalError(errors.New("etcd went away")), want: true},
+		{name: "server timeout", err: apierrors.NewServerTimeout(nodesResource, "create", 0), want: true},
+		{name: "gateway timeout", err: apierrors.NewTimeoutError("timed out", 0), want: true},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("shutting down"), want: true},
+		{name: "wrapped internal error", err: fmt.Errorf("creating node: %w", apierrors.NewInternalError(errors.New("boom"))), want: true},
+		{name: "invalid", err: apierrors.NewInvalid(schema.GroupKind{Kind: "Node"}, "node-1", field.ErrorList{field.Required(field.NewPath("metadata", "name"), "")}), want: false},
+		{name: "forbidden", err: apierrors.NewForbidden(nodesResource, "node-1", errors.New("no")), want: false},
+		{name: "not found", err: apierrors.NewNotFound(nodesResource, "node-1"), want: false},
+		{name: "already exists", err: apierrors.NewAlreadyExists(nodesResource, "node-1"), want: false},
+		{name: "conflict", err: apierrors.NewConflict(nodesResource, "node-1", errors.New("stale")), want: false},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, want: true},
+		{name: "unknown host", err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, want: false},
+		{name: "connection reset", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, want: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "client timeout", err: &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, want: true},
+		{name: "context canceled", err: context.Canceled, want: false},
+		{name: "context deadline", err: fmt.Errorf("request: %w", context.DeadlineExceeded), want: false},
+		{name: "other", err: errors.New("something else"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 3), want: 3 * time.Second},
+		// client-go turns the Retry-After header of a response it cannot decode into RetryAfterSeconds
+		{name: "Retry-After header on a 429", err: apierrors.NewGenericServerResponse(429, "create", nodesResource, "node-1", "", 7, true), want: 7 * time.Second},
+		{name: "Retry-After header on a 503", err: apierrors.NewGenericServerResponse(503, "create", nodesResource, "node-1", "", 2, true), want: 2 * time.Second},
+		{name: "no Retry-After header", err: apierrors.NewGenericServerResponse(429, "create", nodesResource, "node-1", "", 0, true), want: 0},
+		{name: "wrapped", err: fmt.Errorf("creating node: %w", apierrors.NewTooManyRequests("slow down", 5)), want: 5 * time.Second},
+		{name: "not retryable", err: apierrors.NewForbidden(nodesResource, "node-1", errors.New("no")), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RetryAfter(tt.err); got != tt.want {
+				t.Errorf("RetryAfter(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	throttled := apierrors.NewTooManyRequests("slow down", 0)
+	forbidden := apierrors.NewForbidden(nodesResource, "node-1", errors.New("no"))
+	tests := []struct {
+		name      string
+		errs      []error
+		attempts  int
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "succeeds", errs: []error{nil}, attempts: 3, wantCalls: 1},
+		{name: "succeeds after retries", errs: []error{throttled, throttled, nil}, attempts: 3, wantCalls: 3},
+		{name: "gives up", errs: []error{throttled, throttled, throttled}, attempts: 2, wantErr: throttled, wantCalls: 2},
+		{name: "not retryable", errs: []error{forbidden, nil}, attempts: 3, wantErr: forbidden, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Retry(context.Background(), tt.attempts, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if err != tt.wantErr {
+				t.Errorf("Retry() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Retry() called fn %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	// The apiserver asks for a long wait, which the canceled context cuts short
+	throttled := apierrors.NewTooManyRequests("slow down", 60)
+	if err := Retry(ctx, 3, func() error { calls++; return throttled }); err != throttled {
+		t.Errorf("Retry() error = %v, want %v", err, throttled)
+	}
+	if calls != 1 {
+		t.Errorf("Retry() called fn %d times, want 1", calls)
+	}
+}
@@ -2,6 +2,28 @@
 // Copyright 2025 Benjamin Chess
 package util
 
+import (
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+)
+
 type schedulerDoneChanKey struct{}
 
 var SchedulerDoneChannelKey = schedulerDoneChanKey{}
+
+type forceLocalPermitKey struct{}
+
+// ForceLocalPermitKey marks a scheduling cycle whose Permit should accept the locally chosen node
+// without consulting CollectScore
+var ForceLocalPermitKey = forceLocalPermitKey{}
+
+// BindRetriesAnnotationKey counts how many times a pod has been sent back for scoring after a failed bind,
+// or after its winning node was gone. It only exists on the relayed copy of the pod, never in the apiserver.
+const BindRetriesAnnotationKey = "dist-scheduler.dev/bind-retries"
+
+// ScoringRound is the round of scoring pod is in: 0 at first, and one more each time it is sent back to be scored
+func ScoringRound(pod *v1.Pod) uint32 {
+	round, _ := strconv.ParseUint(pod.Annotations[BindRetriesAnnotationKey], 10, 32)
+	return uint32(round)
+}
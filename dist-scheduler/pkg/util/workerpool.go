@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// WorkerPool runs a resizable number of workers, each calling work in a loop with its own index.
+// No two running workers share an index. A worker that is no longer wanted has its ctx cancelled
+// and exits after the current call to work returns.
+type WorkerPool struct {
+	mu sync.Mutex
+	// ctx is nil until Start
+	ctx  context.Context
+	work func(ctx context.Context, index int)
+	max  int
+	size int
+	// cancels[i] is non-nil while worker i is running
+	cancels []context.CancelFunc
+	// ctxs[i] is the ctx passed to worker i's next call to work
+	ctxs   []context.Context
+	active int
+	wg     sync.WaitGroup
+}
+
+func NewWorkerPool() *WorkerPool {
+	return &WorkerPool{}
+}
+
+// Start runs size workers until ctx is done. size is capped at max.
+// work is called repeatedly with the worker's ctx and index, and should return promptly once that ctx is done.
+func (p *WorkerPool) Start(ctx context.Context, max int, size int, work func(ctx context.Context, index int)) {
+	p.mu.Lock()
+	p.ctx = ctx
+	p.work = work
+	p.max = max
+	p.cancels = make([]context.CancelFunc, max)
+	p.ctxs = make([]context.Context, max)
+	p.mu.Unlock()
+	p.SetSize(size)
+}
+
+// SetSize grows or shrinks the number of workers, returning the new size after capping it at max.
+func (p *WorkerPool) SetSize(size int) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx == nil {
+		return 0, fmt.Errorf("worker pool not started")
+	}
+	if size < 0 {
+		return p.size, fmt.Errorf("size must not be negative")
+	}
+	size = min(size, p.max)
+	p.size = size
+	for i := 0; i < p.max; i++ {
+		switch {
+		case i >= size && p.cancels[i] != nil:
+			p.cancels[i]()
+		case i < size && p.cancels[i] == nil:
+			p.active++
+			p.ctxs[i], p.cancels[i] = context.WithCancel(p.ctx)
+			p.wg.Add(1)
+			go p.run(i)
+		case i < size && p.ctxs[i].Err() != nil:
+			// Shrunk and grown again before the worker exited. Let it carry on with a fresh ctx
+			p.ctxs[i], p.cancels[i] = context.WithCancel(p.ctx)
+		}
+	}
+	return size, nil
+}
+
+func (p *WorkerPool) run(index int) {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		if index >= p.size || p.ctx.Err() != nil {
+			p.cancels[index]()
+			p.cancels[index] = nil
+			p.ctxs[index] = nil
+			p.active--
+			p.mu.Unlock()
+			return
+		}
+		ctx := p.ctxs[index]
+		p.mu.Unlock()
+		p.work(ctx, index)
+	}
+}
+
+// Size returns the number of workers wanted
+func (p *WorkerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Active returns the number of workers running, including ones that will exit after their current work
+func (p *WorkerPool) Active() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// Wait blocks until every worker has exited
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package util
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it is true or a second has passed
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var completed atomic.Int32
+	var mu sync.Mutex
+	running := map[int]bool{}
+	work := func(ctx context.Context, index int) {
+		mu.Lock()
+		if running[index] {
+			t.Errorf("two workers running with index %d", index)
+		}
+		running[index] = true
+		mu.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Millisecond):
+			completed.Add(1)
+		}
+		mu.Lock()
+		running[index] = false
+		mu.Unlock()
+	}
+
+	throughput := func() int32 {
+		start := completed.Load()
+		time.Sleep(100 * time.Millisecond)
+		return completed.Load() - start
+	}
+
+	p := NewWorkerPool()
+	if _, err := p.SetSize(2); err == nil {
+		t.Errorf("SetSize() before Start error = nil, want error")
+	}
+	p.Start(ctx, 8, 1, work)
+	low := throughput()
+
+	if got, err := p.SetSize(4); err != nil || got != 4 {
+		t.Fatalf("SetSize(4) = %d, %v, want 4, nil", got, err)
+	}
+	high := throughput()
+	if high <= low*2 {
+		t.Errorf("throughput with 4 workers = %d, want well above %d with 1", high, low)
+	}
+
+	if got, _ := p.SetSize(100); got != 8 {
+		t.Errorf("SetSize(100) = %d, want capped at 8", got)
+	}
+	if _, err := p.SetSize(-1); err == nil {
+		t.Errorf("SetSize(-1) error = nil, want error")
+	}
+
+	p.SetSize(2)
+	if !waitFor(func() bool { return p.Active() == 2 }) {
+		t.Errorf("Active() after shrinking = %d, want 2", p.Active())
+	}
+
+	// Shrink and regrow immediately, before the excess workers have exited
+	p.SetSize(0)
+	p.SetSize(3)
+	if !waitFor(func() bool { return p.Active() == 3 }) {
+		t.Errorf("Active() after regrowing = %d, want 3", p.Active())
+	}
+	if p.Size() != 3 {
+		t.Errorf("Size() = %d, want 3", p.Size())
+	}
+
+	cancel()
+	p.Wait()
+	if p.Active() != 0 {
+		t.Errorf("Active() after ctx done = %d, want 0", p.Active())
+	}
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ServiceName is the Service whose Endpoints the leader points at itself
+	ServiceName = "dist-scheduler-webhook"
+	// ServicePort is the port of ServiceName, which targets the webhook server's port on the leader
+	ServicePort = 443
+	// DefaultPort is the port the webhook server listens on unless --webhook-addr is set
+	DefaultPort = 8443
+	// Path is the only path the webhook server accepts reviews on
+	Path = "/validate"
+	// CertDir holds tls.crt, tls.key and ca.crt, mounted from the webhook TLS secret
+	CertDir = "/etc/webhook/certs"
+	// ConfigName is the name of the ValidatingWebhookConfiguration
+	ConfigName = "dist-scheduler-webhook"
+	// SchedulerName is the spec.schedulerName of the pods the webhook queues
+	SchedulerName = "dist-scheduler"
+)
+
+// AddrPort is the port of a host:port webhook server address, which the leader points the ServiceName endpoints at
+func AddrPort(addr string) (int32, error) {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook address %q: %v", addr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return 0, fmt.Errorf("invalid webhook address %q: port must be 1-65535", addr)
+	}
+	return int32(port), nil
+}
+
+// ReadCABundle returns the CA certificate mounted alongside the webhook's serving certificate
+func ReadCABundle() ([]byte, error) {
+	caBundle, err := os.ReadFile(filepath.Join(CertDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	return caBundle, nil
+}
+
+// NewValidatingWebhookConfiguration returns the configuration that sends pod creations to the webhook
+// server through ServiceName in namespace. Only pods for SchedulerName that are not already bound,
+// and that match objectSelector if it is not nil, are sent.
+func NewValidatingWebhookConfiguration(namespace string, caBundle []byte, objectSelector *metav1.LabelSelector) *admissionregistrationv1.ValidatingWebhookConfiguration {
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: ConfigName,
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name: "dist-scheduler.bchess.org",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Name:      ServiceName,
+						Namespace: namespace,
+						Path:      ptr.To(Path),
+						Port:      ptr.To[int32](ServicePort),
+					},
+					CABundle: caBundle,
+				},
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{""},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"pods"},
+							Scope:       ptr.To(admissionregistrationv1.NamespacedScope),
+						},
+					},
+				},
+				ObjectSelector: objectSelector,
+				// An objectSelector can only match labels, so the schedulerName is matched here instead
+				MatchConditions: []admissionregistrationv1.MatchCondition{
+					{
+						Name:       "dist-scheduler-pods",
+						Expression: fmt.Sprintf("object.spec.schedulerName == %q && (!has(object.spec.nodeName) || object.spec.nodeName == \"\")", SchedulerName),
+					},
+				},
+				// The webhook always allows, it only exists to learn about new pods
+				FailurePolicy:           ptr.To(admissionregistrationv1.Ignore),
+				SideEffects:             ptr.To(admissionregistrationv1.SideEffectClassNone),
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+}
+
+// ApplyValidatingWebhookConfiguration creates vwc, or replaces the existing one with the same name
+func ApplyValidatingWebhookConfiguration(ctx context.Context, cs kubernetes.Interface, vwc *admissionregistrationv1.ValidatingWebhookConfiguration) error {
+	client := cs.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	_, err := client.Create(ctx, vwc, metav1.CreateOptions{})
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return err
+	}
+	existing, err := client.Get(ctx, vwc.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	vwc = vwc.DeepCopy()
+	vwc.ResourceVersion = existing.ResourceVersion
+	_, err = client.Update(ctx, vwc, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyValidatingWebhookConfiguration(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewSimpleClientset()
+
+	vwc := NewValidatingWebhookConfiguration("kube-system", []byte("ca-1"), nil)
+	if err := ApplyValidatingWebhookConfiguration(ctx, cs, vwc); err != nil {
+		t.Fatalf("ApplyValidatingWebhookConfiguration() create error = %v", err)
+	}
+
+	// Applying again with a rotated CA replaces the existing configuration
+	vwc = NewValidatingWebhookConfiguration("kube-system", []byte("ca-2"), nil)
+	if err := ApplyValidatingWebhookConfiguration(ctx, cs, vwc); err != nil {
+		t.Fatalf("ApplyValidatingWebhookConfiguration() update error = %v", err)
+	}
+
+	got, err := cs.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, ConfigName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Webhooks) != 1 {
+		t.Fatalf("Webhooks = %d, want 1", len(got.Webhooks))
+	}
+	wh := got.Webhooks[0]
+	if string(wh.ClientConfig.CABundle) != "ca-2" {
+		t.Errorf("CABundle = %q, want ca-2", wh.ClientConfig.CABundle)
+	}
+	svc := wh.ClientConfig.Service
+	if svc == nil || svc.Name != ServiceName || svc.Namespace != "kube-system" || *svc.Path != Path || *svc.Port != ServicePort {
+		t.Errorf("Service = %+v, want %s/%s:%d%s", svc, "kube-system", ServiceName, ServicePort, Path)
+	}
+	if len(wh.MatchConditions) != 1 {
+		t.Errorf("MatchConditions = %d, want 1", len(wh.MatchConditions))
+	}
+}
+
+func TestAddrPort(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    int32
+		wantErr bool
+	}{
+		{addr: ":8443", want: 8443},
+		{addr: "0.0.0.0:9443", want: 9443},
+		{addr: "[::]:9443", want: 9443},
+		{addr: "8443", wantErr: true},
+		{addr: ":0", wantErr: true},
+		{addr: ":70000", wantErr: true},
+		{addr: ":https", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := AddrPort(tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("AddrPort(%q) = %d, %v, want %d, error %v", tt.addr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
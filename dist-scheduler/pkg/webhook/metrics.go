@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package webhook
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// Reasons counted by webhookSkippedCounter
+const (
+	skipWrongScheduler = "wrong_scheduler"
+	skipAlreadyBound   = "already_bound"
+	skipPodSelector    = "pod_selector"
+)
+
+var (
+	webhookSkippedCounter = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name: "distscheduler_webhook_skipped_count",
+			Help: "Number of pods the admission hook received but did not queue: wrong_scheduler, already_bound or pod_selector",
+		},
+		[]string{"reason"},
+	)
+	podDroppedCounter = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Name: "distscheduler_pod_dropped_count",
+			Help: "Number of pods the admission hook dropped because the pod queue was full, with --queue-full-policy=drop",
+		},
+	)
+	once sync.Once
+)
+
+func RegisterMetrics() {
+	once.Do(func() {
+		legacyregistry.MustRegister(webhookSkippedCounter)
+		legacyregistry.MustRegister(podDroppedCounter)
+	})
+}
@@ -4,35 +4,83 @@ package webhook
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
 
+	"bchess.org/dist-scheduler/pkg/util"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 )
 
 type WebhookServer struct {
 	server   *http.Server
-	podQueue chan<- *corev1.Pod
+	podQueue *util.PodQueue
 	addr     string
+	// podSelector limits which of our pods are queued
+	podSelector labels.Selector
+	// clientCAFile, if set, is the CA bundle client certificates must verify against. Otherwise any client is accepted
+	clientCAFile string
+	// dropWhenFull drops pods instead of waiting for room in a full podQueue
+	dropWhenFull bool
 }
 
-func NewWebhookServer(addr string, podQueue chan<- *corev1.Pod) *WebhookServer {
+// NewWebhookServer returns a server that queues pods for our scheduler. A nil podSelector queues all of them.
+func NewWebhookServer(addr string, podQueue *util.PodQueue, podSelector labels.Selector) *WebhookServer {
+	if podSelector == nil {
+		podSelector = labels.Everything()
+	}
 	return &WebhookServer{
-		addr:     addr,
-		podQueue: podQueue,
+		addr:        addr,
+		podQueue:    podQueue,
+		podSelector: podSelector,
+	}
+}
+
+// RequireClientCert makes the server reject clients, i.e. anything but the apiserver, that don't present
+// a certificate signed by a CA in caFile. Must be called before Start.
+func (ws *WebhookServer) RequireClientCert(caFile string) {
+	ws.clientCAFile = caFile
+}
+
+// DropWhenFull makes the server drop pods, rather than wait for room, when the pod queue is full. Waiting holds
+// up the admission request, which the apiserver times out. Must be called before Start.
+func (ws *WebhookServer) DropWhenFull() {
+	ws.dropWhenFull = true
+}
+
+// tlsConfig returns the server's TLS config serving cert
+func (ws *WebhookServer) tlsConfig(cert tls.Certificate) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if ws.clientCAFile != "" {
+		caBundle, err := os.ReadFile(ws.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", ws.clientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
+	return tlsConfig, nil
 }
 
 func (ws *WebhookServer) Start() error {
 	// Load TLS certificates
-	certPath := filepath.Join("/etc/webhook/certs", "tls.crt")
-	keyPath := filepath.Join("/etc/webhook/certs", "tls.key")
+	certPath := filepath.Join(CertDir, "tls.crt")
+	keyPath := filepath.Join(CertDir, "tls.key")
 
 	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
 	if err != nil {
@@ -40,9 +88,9 @@ func (ws *WebhookServer) Start() error {
 	}
 
 	// Create TLS config
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+	tlsConfig, err := ws.tlsConfig(cert)
+	if err != nil {
+		return err
 	}
 
 	// Create HTTP server
@@ -69,7 +117,7 @@ func (ws *WebhookServer) Stop() error {
 }
 
 func (ws *WebhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/validate" {
+	if r.URL.Path != Path {
 		http.Error(w, "Not found", http.StatusNotFound)
 		r.Body.Close()
 		return
@@ -117,10 +165,33 @@ func (ws *WebhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only queue pods that use our scheduler
-	if pod.Name[len(pod.Name)-1] == '0' && pod.Name[len(pod.Name)-2] == '0' {
+	if util.ShouldSampleLog(pod.Name) {
 		klog.Info("AdmissionReview for pod ", pod.Name, " using scheduler ", pod.Spec.SchedulerName)
 	}
-	if pod.Spec.SchedulerName == "dist-scheduler" {
-		ws.podQueue <- &pod
+	if pod.Spec.SchedulerName != SchedulerName {
+		// Expected if the webhook configuration sends every pod, but also hides a mistyped schedulerName
+		webhookSkippedCounter.WithLabelValues(skipWrongScheduler).Inc()
+		klog.V(4).Info("Skipping pod ", pod.Namespace, "/", pod.Name, " using scheduler ", pod.Spec.SchedulerName)
+		return
+	}
+	if pod.Spec.NodeName != "" {
+		// Already bound (e.g. created with spec.nodeName set), nothing to schedule
+		webhookSkippedCounter.WithLabelValues(skipAlreadyBound).Inc()
+		klog.V(4).Info("Skipping pre-bound pod ", pod.Namespace, "/", pod.Name, " on node ", pod.Spec.NodeName)
+		return
+	}
+	if !ws.podSelector.Matches(labels.Set(pod.Labels)) {
+		webhookSkippedCounter.WithLabelValues(skipPodSelector).Inc()
+		klog.V(4).Info("Skipping pod ", pod.Namespace, "/", pod.Name, " not matching the pod selector")
+		return
+	}
+	if !ws.dropWhenFull {
+		ws.podQueue.Enqueue(&pod)
+		return
+	}
+	if !ws.podQueue.TryEnqueue(&pod) {
+		// The pod stays pending until something else queues it, e.g. the leader's --watch-pods
+		podDroppedCounter.Inc()
+		klog.V(2).Info("Dropping pod ", pod.Namespace, "/", pod.Name, ", the pod queue is full")
 	}
 }
@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bchess.org/dist-scheduler/pkg/util"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+func postPod(t *testing.T, ws *WebhookServer, pod *corev1.Pod) {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("Marshal(pod) error = %v", err)
+	}
+	review := admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:    "test-uid",
+			Object: runtime.RawExtension{Raw: raw},
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("Marshal(review) error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	ws.handleWebhook(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handleWebhook() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// dropped reads distscheduler_pod_dropped_count from the registry
+func dropped(t *testing.T) float64 {
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "distscheduler_pod_dropped_count" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// skipped reads distscheduler_webhook_skipped_count for reason from the registry
+func skipped(t *testing.T, reason string) float64 {
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "distscheduler_webhook_skipped_count" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "reason" && label.GetValue() == reason {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestHandleWebhook(t *testing.T) {
+	RegisterMetrics()
+	tests := []struct {
+		name        string
+		podName     string
+		scheduler   string
+		nodeName    string
+		wantQueued  bool
+		wantSkipped string
+	}{
+		{
+			name:       "unscheduled pod",
+			scheduler:  "dist-scheduler",
+			wantQueued: true,
+		},
+		{
+			// Sampling used to index the last two characters of the name
+			name:       "one-character pod name",
+			podName:    "a",
+			scheduler:  "dist-scheduler",
+			wantQueued: true,
+		},
+		{
+			name:        "pre-bound pod",
+			scheduler:   "dist-scheduler",
+			nodeName:    "node-1",
+			wantSkipped: skipAlreadyBound,
+		},
+		{
+			name:        "other scheduler",
+			scheduler:   "default-scheduler",
+			wantSkipped: skipWrongScheduler,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := util.NewPodQueue(10, 10)
+			ws := NewWebhookServer(":0", q, nil)
+			before := map[string]float64{}
+			for _, reason := range []string{skipWrongScheduler, skipAlreadyBound, skipPodSelector} {
+				before[reason] = skipped(t, reason)
+			}
+			podName := tt.podName
+			if podName == "" {
+				podName = "pod-1"
+			}
+			postPod(t, ws, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: "default"},
+				Spec: corev1.PodSpec{
+					SchedulerName: tt.scheduler,
+					NodeName:      tt.nodeName,
+				},
+			})
+			if got := q.Len() == 1; got != tt.wantQueued {
+				t.Errorf("queued = %v, want %v", got, tt.wantQueued)
+			}
+			for reason, n := range before {
+				want := 0.0
+				if reason == tt.wantSkipped {
+					want = 1
+				}
+				if got := skipped(t, reason) - n; got != want {
+					t.Errorf("skipped{reason=%s} increased by %v, want %v", reason, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebhookPodSelector(t *testing.T) {
+	selector, err := labels.Parse("app=canary,tier!=batch")
+	if err != nil {
+		t.Fatalf("labels.Parse() error = %v", err)
+	}
+	q := util.NewPodQueue(10, 10)
+	ws := NewWebhookServer(":0", q, selector)
+
+	pods := []struct {
+		name   string
+		labels map[string]string
+		match  bool
+	}{
+		{name: "canary", labels: map[string]string{"app": "canary"}, match: true},
+		{name: "canary-web", labels: map[string]string{"app": "canary", "tier": "web"}, match: true},
+		{name: "canary-batch", labels: map[string]string{"app": "canary", "tier": "batch"}},
+		{name: "other-app", labels: map[string]string{"app": "other"}},
+		{name: "unlabeled"},
+	}
+	want := map[string]bool{}
+	for _, p := range pods {
+		postPod(t, ws, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: p.name, Namespace: "default", Labels: p.labels},
+			Spec:       corev1.PodSpec{SchedulerName: SchedulerName},
+		})
+		if p.match {
+			want[p.name] = true
+		}
+	}
+
+	if q.Len() != len(want) {
+		t.Fatalf("queued %d pods, want %d", q.Len(), len(want))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for range want {
+		pod, ok := q.Dequeue(ctx)
+		if !ok {
+			t.Fatalf("Dequeue() timed out")
+		}
+		if !want[pod.Name] {
+			t.Errorf("queued %s, which does not match the selector", pod.Name)
+		}
+	}
+}
+
+// testCert is a certificate and its key, signed by parent, or self-signed if parent is nil
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	tlsCert tls.Certificate
+}
+
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		tlsCert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+}
+
+func newTestCA(t *testing.T, name string) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+}
+
+func newTestClientCert(t *testing.T, ca *testCert) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "kube-apiserver"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}, ca)
+}
+
+func TestRequireClientCert(t *testing.T) {
+	ca := newTestCA(t, "webhook-ca")
+	serverCert := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: ServiceName},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}, ca)
+	caFile := filepath.Join(t.TempDir(), "client-ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+
+	tests := []struct {
+		name        string
+		requireCert bool
+		clientCert  *testCert
+		wantErr     bool
+	}{
+		{name: "permissive without client cert", requireCert: false},
+		{name: "no client cert", requireCert: true, wantErr: true},
+		{name: "client cert from another CA", requireCert: true, clientCert: newTestClientCert(t, newTestCA(t, "other-ca")), wantErr: true},
+		{name: "valid client cert", requireCert: true, clientCert: newTestClientCert(t, ca)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWebhookServer("", nil, nil)
+			if tt.requireCert {
+				ws.RequireClientCert(caFile)
+			}
+			tlsConfig, err := ws.tlsConfig(serverCert.tlsCert)
+			if err != nil {
+				t.Fatalf("tlsConfig() error = %v", err)
+			}
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(ws.handleWebhook))
+			srv.TLS = tlsConfig
+			srv.StartTLS()
+			defer srv.Close()
+
+			clientTLS := &tls.Config{RootCAs: rootCAs}
+			if tt.clientCert != nil {
+				clientTLS.Certificates = []tls.Certificate{tt.clientCert.tlsCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			// Any path other than Path is a 404, which is enough to know the handshake succeeded
+			resp, err := client.Get(srv.URL + "/healthz")
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("Get() succeeded, want the client rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("Get() status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestRequireClientCertInvalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "client-ca.crt")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	ws := NewWebhookServer("", nil, nil)
+	ws.RequireClientCert(caFile)
+	if _, err := ws.tlsConfig(tls.Certificate{}); err == nil {
+		t.Errorf("tlsConfig() error = nil, want an error for a CA file without certificates")
+	}
+}
+
+func TestHandleWebhookDropWhenFull(t *testing.T) {
+	RegisterMetrics()
+	q := util.NewPodQueue(1, 1)
+	ws := NewWebhookServer(":0", q, nil)
+	ws.DropWhenFull()
+	before := dropped(t)
+
+	// The second pod finds the queue full. Blocking would hang the test
+	for _, name := range []string{"pod-1", "pod-2"} {
+		postPod(t, ws, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       corev1.PodSpec{SchedulerName: "dist-scheduler"},
+		})
+	}
+	if got := q.Len(); got != 1 {
+		t.Errorf("queued %d pods, want 1", got)
+	}
+	if got := dropped(t) - before; got != 1 {
+		t.Errorf("dropped increased by %v, want 1", got)
+	}
+}
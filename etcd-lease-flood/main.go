@@ -17,14 +17,18 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"bchess.org/util"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	coordv1 "k8s.io/api/coordination/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -38,14 +42,42 @@ func main() {
 		endpoints  = flag.String("endpoints", "localhost:2379", "comma-separated etcd endpoints")
 		numKeys    = flag.Int("num-keys", 100, "number of Lease keys to create and flood")
 		namespace  = flag.String("namespace", "default", "Kubernetes namespace for Lease keys")
-		keyPrefix  = flag.String("key-prefix", "", "etcd key prefix")
+		keyPrefix  = flag.String("key-prefix", "", "prefix of the Lease names, e.g. to keep parallel runs apart")
 		numWorkers = flag.Int("workers", 10, "number of concurrent worker goroutines")
+		caFile     = flag.String("cacert", "", "CA bundle to verify the etcd server with. Setting any of -cacert, -cert and -key connects with TLS, otherwise plaintext")
+		certFile   = flag.String("cert", "", "client certificate to authenticate to etcd with, together with -key")
+		keyFile    = flag.String("key", "", "client key for -cert")
+		duration   = flag.Duration("duration", 0, "stop flooding after this long. 0 runs until interrupted")
+		maxPuts    = flag.Int64("max-puts", 0, "stop flooding after about this many puts, give or take one per worker. 0 is unlimited")
+		ramp       = flag.Duration("ramp-duration", 0, "start the workers one by one, evenly spread over this long, instead of all at once")
+		padBytes   = flag.Int("pad-bytes", 0, "add this many bytes of filler in an annotation to every Lease, to make the values bigger")
+		// kube-apiserver stores a Lease at <--etcd-prefix>/leases/<namespace>/<name>
+		registryPrefix = flag.String("registry-prefix", "/registry", "etcd prefix of the Kubernetes objects, the --etcd-prefix of kube-apiserver. The default matches a stock kube-apiserver")
 	)
 	flag.Parse()
 
+	if *duration < 0 {
+		log.Fatal("-duration must not be negative")
+	}
+	if *maxPuts < 0 {
+		log.Fatal("-max-puts must not be negative")
+	}
+	if *ramp < 0 {
+		log.Fatal("-ramp-duration must not be negative")
+	}
+	if *padBytes < 0 {
+		log.Fatal("-pad-bytes must not be negative")
+	}
+	padding := strings.Repeat("x", *padBytes)
+
+	tlsConfig, err := clientTLSConfig(*caFile, *certFile, *keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
 	cli, err := clientv3.New(clientv3.Config{
 		Endpoints:   strings.Split(*endpoints, ","),
 		DialTimeout: 5 * time.Second,
+		TLS:         tlsConfig,
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -57,22 +89,28 @@ func main() {
 	coordv1.AddToScheme(scheme)
 	serializer := serializer.NewCodecFactory(scheme).LegacyCodec(schema.GroupVersion{Group: "coordination.k8s.io", Version: "v1"})
 
+	ctx, stop := util.SignalContext()
+	defer stop()
+
 	// Create initial keys
 	log.Printf("Creating %d initial Lease keys...", *numKeys)
 	keys := make([]string, *numKeys)
-	for i := 0; i < *numKeys; i++ {
+	for i := 0; i < *numKeys && ctx.Err() == nil; i++ {
 		leaseName := fmt.Sprintf("%slease-%d", *keyPrefix, i)
-		key := fmt.Sprintf("/registry/leases/%s/%s", *namespace, leaseName)
+		key := path.Join("/", *registryPrefix, "leases", *namespace, leaseName)
 		keys[i] = key
 
-		lease := createLease(leaseName, *namespace)
+		lease := createLease(leaseName, *namespace, padding)
 		data, err := runtime.Encode(serializer, &lease)
 		if err != nil {
 			log.Printf("Failed to encode lease %d: %v", i, err)
 			continue
 		}
+		if i == 0 {
+			log.Printf("Lease values are %d bytes", len(data))
+		}
 
-		_, err = cli.Put(context.Background(), key, string(data))
+		_, err = cli.Put(ctx, key, string(data))
 		if err != nil {
 			log.Printf("Failed to create key %s: %v", key, err)
 		}
@@ -80,45 +118,91 @@ func main() {
 	log.Printf("Created %d initial keys", *numKeys)
 
 	// Metrics tracking
-	var putCount int64
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	var puts, activeWorkers int64
+	start := time.Now()
+
+	// The workers stop on a signal, at -duration or at -max-puts
+	ctx, stopFlood := context.WithCancel(ctx)
+	defer stopFlood()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
 
 	// Start metrics goroutine
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
+		var last int64
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				count := atomic.LoadInt64(&putCount)
-				fmt.Printf("Puts/sec: %d\n", count)
-				atomic.StoreInt64(&putCount, 0)
+				now := atomic.LoadInt64(&puts)
+				fmt.Printf("Puts/sec: %d (%d workers)\n", now-last, atomic.LoadInt64(&activeWorkers))
+				last = now
 			}
 		}
 	}()
 
 	// Create worker pool
+	if *ramp > 0 {
+		log.Printf("Starting %d workers over %v...", *numWorkers, *ramp)
+	}
 	var wg sync.WaitGroup
-	for i := 0; i < *numWorkers; i++ {
+	for i := 0; i < *numWorkers && ctx.Err() == nil; i++ {
+		// Worker i starts i/numWorkers of the way through the ramp
+		select {
+		case <-time.After(time.Until(start.Add(*ramp * time.Duration(i) / time.Duration(*numWorkers)))):
+		case <-ctx.Done():
+			continue
+		}
 		wg.Add(1)
+		atomic.AddInt64(&activeWorkers, 1)
 		go func(workerID int) {
 			defer wg.Done()
-			worker(cli, keys, serializer, *namespace, &putCount, workerID, *numWorkers)
+			defer atomic.AddInt64(&activeWorkers, -1)
+			worker(ctx, stopFlood, cli, keys, serializer, *namespace, padding, &puts, *maxPuts, workerID, *numWorkers)
 		}(i)
 	}
 
-	log.Printf("Started %d workers, flooding etcd with Lease updates...", *numWorkers)
+	log.Printf("Started %d workers, flooding etcd with Lease updates...", atomic.LoadInt64(&activeWorkers))
 	wg.Wait()
+
+	elapsed := time.Since(start)
+	total := atomic.LoadInt64(&puts)
+	fmt.Printf("Total puts: %d in %s (%.0f puts/sec)\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
 }
 
-func worker(cli *clientv3.Client, keys []string, serializer runtime.Codec, namespace string, putCount *int64, workerID int, numWorkers int) {
+// clientTLSConfig is the TLS config for the etcd client, or nil for plaintext when no files are given
+func clientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("-cert and -key must be set together")
+	}
+	info := transport.TLSInfo{
+		TrustedCAFile: caFile,
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+	}
+	config, err := info.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load etcd TLS config: %w", err)
+	}
+	return config, nil
+}
+
+// worker updates its share of keys until ctx is done, counting the puts in putCount. It calls stop once
+// putCount reaches maxPuts, unless that is 0.
+func worker(ctx context.Context, stop context.CancelFunc, cli *clientv3.Client, keys []string, serializer runtime.Codec, namespace string, padding string, putCount *int64, maxPuts int64, workerID int, numWorkers int) {
 	start := (len(keys) / numWorkers) * workerID
 	end := start + (len(keys) / numWorkers)
 	keyIndex := start
-	for {
+	for ctx.Err() == nil {
 		// Pick a random key to update
 		key := keys[keyIndex]
 		keyIndex++
@@ -131,7 +215,7 @@ func worker(cli *clientv3.Client, keys []string, serializer runtime.Codec, names
 		leaseName := parts[len(parts)-1]
 
 		// Create updated lease
-		lease := createLease(leaseName, namespace)
+		lease := createLease(leaseName, namespace, padding)
 		data, err := runtime.Encode(serializer, &lease)
 		if err != nil {
 			log.Printf("Worker %d: Failed to encode lease: %v", workerID, err)
@@ -139,20 +223,26 @@ func worker(cli *clientv3.Client, keys []string, serializer runtime.Codec, names
 		}
 
 		// Update the key
-		_, err = cli.Put(context.Background(), key, string(data))
+		_, err = cli.Put(ctx, key, string(data))
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Printf("Worker %d: Failed to update key %s: %v", workerID, key, err)
-		} else {
-			atomic.AddInt64(putCount, 1)
+		} else if n := atomic.AddInt64(putCount, 1); maxPuts > 0 && n >= maxPuts {
+			stop()
 		}
 	}
 }
 
-func createLease(name, namespace string) coordv1.Lease {
+// paddingAnnotation holds the -pad-bytes filler
+const paddingAnnotation = "etcd-lease-flood/padding"
+
+func createLease(name, namespace, padding string) coordv1.Lease {
 	now := metav1.NowMicro()
 	leaseDurationSeconds := int32(15)
 
-	return coordv1.Lease{
+	lease := coordv1.Lease{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
@@ -166,4 +256,8 @@ func createLease(name, namespace string) coordv1.Lease {
 			RenewTime:            &now,
 		},
 	}
+	if padding != "" {
+		lease.Annotations = map[string]string{paddingAnnotation: padding}
+	}
+	return lease
 }
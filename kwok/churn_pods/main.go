@@ -0,0 +1,349 @@
+/*
+Copyright 2025 Benjamin Chess
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bchess.org/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var numClientSets = 10
+
+// podAppLabel is the app label of every churned pod, so they can be watched and cleaned up apart from other pods
+const podAppLabel = "churn-pods"
+
+func main() {
+	target := flag.Int("target", 1000, "Number of pods to keep. Once this many exist, every create also deletes the oldest pod")
+	rate := flag.Float64("rate", 100, "Pods created per second")
+	duration := flag.Duration("duration", 0, "Stop churning after this long. 0 runs until interrupted")
+	reportInterval := flag.Duration("report-interval", 10*time.Second, "How often to print the create, delete and scheduled rates")
+	cleanup := flag.Bool("cleanup", true, "Delete every churned pod on exit")
+	namePrefix := flag.String("name-prefix", "churn-", "Name prefix of churned pods")
+	kubeconfig := flag.String("kubeconfig", "", "Path to the kubeconfig file (optional)")
+	schedulerName := flag.String("scheduler-name", "dist-scheduler", "schedulerName. Default dist-scheduler")
+	flag.Parse()
+
+	errlog := log.New(os.Stderr, "", log.LstdFlags)
+
+	if *target < 1 {
+		log.Fatalf("-target must be at least 1")
+	}
+	if *rate <= 0 {
+		log.Fatalf("-rate must be positive")
+	}
+
+	config, err := buildConfig(*kubeconfig)
+	if err != nil {
+		log.Fatalf("Error building kubeconfig: %v", err)
+	}
+	config.RateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+
+	clientsets := make([]*kubernetes.Clientset, numClientSets)
+	for i := 0; i < numClientSets; i++ {
+		// This ensures that the transport is not shared between clientsets
+		config.Proxy = func(req *http.Request) (*url.URL, error) {
+			return nil, nil
+		}
+		clientsets[i], err = kubernetes.NewForConfig(config)
+		if err != nil {
+			log.Fatalf("Error creating Kubernetes client: %v", err)
+		}
+	}
+
+	ctx, stop := util.SignalContext()
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	c := &churner{
+		clientsets: clientsets,
+		podSpec:    newPodSpec(*schedulerName),
+		namePrefix: *namePrefix,
+		target:     *target,
+	}
+	if err := c.watch(ctx); err != nil {
+		errlog.Fatalf("Error watching pods: %v", err)
+	}
+	go c.report(ctx, *reportInterval)
+
+	start := time.Now()
+	c.run(ctx, *rate, errlog)
+	elapsed := time.Since(start)
+
+	fmt.Printf("Churned for %v: %d created, %d deleted, %d scheduled, %d failed. %.1f created/s, %.1f deleted/s, %.1f scheduled/s.\n",
+		elapsed.Round(time.Second), c.created.Load(), c.deleted.Load(), c.scheduled.Load(), c.failed.Load(),
+		float64(c.created.Load())/elapsed.Seconds(), float64(c.deleted.Load())/elapsed.Seconds(), float64(c.scheduled.Load())/elapsed.Seconds())
+
+	if *cleanup {
+		// ctx is done by now, so clean up on a fresh one
+		cctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		err := clientsets[0].CoreV1().Pods(metav1.NamespaceDefault).DeleteCollection(cctx, metav1.DeleteOptions{}, metav1.ListOptions{
+			LabelSelector: "app=" + podAppLabel,
+		})
+		if err != nil {
+			errlog.Fatalf("Error cleaning up churned pods: %v", err)
+		}
+		fmt.Println("Churned pods deleted.")
+	}
+}
+
+// churner keeps target pods in existence, replacing the oldest one with a new one at a fixed rate
+type churner struct {
+	clientsets []*kubernetes.Clientset
+	podSpec    *corev1.PodSpec
+	namePrefix string
+	target     int
+
+	lock sync.Mutex
+	// live holds the names of created pods, oldest first
+	live []string
+
+	next                                atomic.Int64
+	created, deleted, scheduled, failed atomic.Int64
+
+	podInformer cache.SharedIndexInformer
+}
+
+// run creates a pod every 1/rate seconds until ctx is done, deleting the oldest pod first once target pods exist
+func (c *churner) run(ctx context.Context, rate float64, errlog *log.Logger) {
+	limiter := flowcontrol.NewTokenBucketRateLimiter(float32(rate), max(1, int(rate)))
+	defer limiter.Stop()
+
+	// Limit concurrency to 100*10
+	sem := make(chan struct{}, 100*numClientSets)
+	var wg sync.WaitGroup
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		i := c.next.Add(1) - 1
+		victim := ""
+		c.lock.Lock()
+		if len(c.live) >= c.target {
+			victim = c.live[0]
+			c.live = c.live[1:]
+		}
+		c.lock.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cs := c.clientsets[i%int64(numClientSets)]
+			if victim != "" {
+				err := util.Retry(ctx, util.DefaultAttempts, func() error {
+					return cs.CoreV1().Pods(metav1.NamespaceDefault).Delete(ctx, victim, metav1.DeleteOptions{})
+				})
+				if ctx.Err() != nil {
+					// Stopped mid-request, the delete did not fail
+					return
+				}
+				if err != nil {
+					c.failed.Add(1)
+					errlog.Printf("Error deleting %s: %v", victim, err)
+				} else {
+					c.deleted.Add(1)
+				}
+			}
+			name, err := c.createPod(ctx, cs, i)
+			if err != nil {
+				if ctx.Err() != nil {
+					// Stopped mid-request, the create did not fail
+					return
+				}
+				c.failed.Add(1)
+				errlog.Printf("Error creating pod %d: %v", i, err)
+				return
+			}
+			c.created.Add(1)
+			c.lock.Lock()
+			c.live = append(c.live, name)
+			c.lock.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *churner) createPod(ctx context.Context, clientset *kubernetes.Clientset, index int64) (string, error) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s%d", c.namePrefix, index),
+			Labels: map[string]string{
+				"app": podAppLabel,
+			},
+		},
+		Spec: *c.podSpec.DeepCopy(),
+	}
+	err := util.Retry(ctx, util.DefaultAttempts, func() error {
+		_, err := clientset.CoreV1().Pods(metav1.NamespaceDefault).Create(ctx, pod, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return pod.Name, nil
+}
+
+// watch starts an informer on the churned pods that counts them as they are bound, and waits for it to sync
+func (c *churner) watch(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clientsets[0], 0,
+		informers.WithNamespace(metav1.NamespaceDefault),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = "app=" + podAppLabel
+		}),
+	)
+	c.podInformer = factory.Core().V1().Pods().Informer()
+	_, err := c.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			newPod, ok := newObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			if oldPod.Spec.NodeName == "" && newPod.Spec.NodeName != "" {
+				c.scheduled.Add(1)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.podInformer.HasSynced) {
+		return fmt.Errorf("pod informer did not sync")
+	}
+	return nil
+}
+
+// report prints the rates over each interval and how many churned pods exist, until ctx is done
+func (c *churner) report(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastCreated, lastDeleted, lastScheduled int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		created, deleted, scheduled := c.created.Load(), c.deleted.Load(), c.scheduled.Load()
+		pods, bound := 0, 0
+		for _, obj := range c.podInformer.GetStore().List() {
+			pods++
+			if obj.(*corev1.Pod).Spec.NodeName != "" {
+				bound++
+			}
+		}
+		seconds := interval.Seconds()
+		fmt.Printf("%.1f created/s, %.1f deleted/s, %.1f scheduled/s, %d failed. %d pods, %d bound.\n",
+			float64(created-lastCreated)/seconds, float64(deleted-lastDeleted)/seconds, float64(scheduled-lastScheduled)/seconds,
+			c.failed.Load(), pods, bound)
+		lastCreated, lastDeleted, lastScheduled = created, deleted, scheduled
+	}
+}
+
+// newPodSpec builds the spec shared by every churned pod
+func newPodSpec(schedulerName string) *corev1.PodSpec {
+	return &corev1.PodSpec{
+		SchedulerName:                 schedulerName,
+		TerminationGracePeriodSeconds: &[]int64{1}[0],
+		Containers: []corev1.Container{
+			{
+				Name:            "busybox",
+				Image:           "gcr.io/google-containers/busybox",
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Command:         []string{"sleep", "99999"},
+			},
+		},
+		Tolerations: []corev1.Toleration{
+			{
+				Key:      "kwok.x-k8s.io/node",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			},
+			{
+				Key:      "node.kubernetes.io/not-ready",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			},
+			{
+				Key:      "node.kubernetes.io/not-ready",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoExecute,
+			},
+		},
+	}
+}
+
+func buildConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err == nil {
+			return config, nil
+		}
+		return nil, err
+	}
+	// In-cluster config
+	config, err := rest.InClusterConfig()
+	if err == nil {
+		return config, nil
+	}
+	// If no in-cluster config, try default config from home dir
+	if home := os.Getenv("HOME"); home != "" {
+		kubeconfigPath := home + "/.kube/config"
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+		if err == nil {
+			return config, nil
+		}
+	}
+	return nil, fmt.Errorf("could not create Kubernetes configuration")
+}
@@ -22,7 +22,9 @@ import (
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 
+	"bchess.org/util"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -52,36 +54,59 @@ func main() {
 		}
 	}
 
+	ctx, stop := util.SignalContext()
+	defer stop()
+
 	// Limit concurrency to 100*10
 	sem := make(chan struct{}, 100*numClientSets)
 
-	// WaitGroup to wait for all creations
+	// WaitGroup to wait for all deletions
 	var wg sync.WaitGroup
-	wg.Add(*numResources)
+	var deleted, failed atomic.Int64
 
 	for i := *skip; i < *numResources; i++ {
 		// Acquire a token
-		sem <- struct{}{}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer func() { <-sem }()
-			err := deleteResource(clientsets[i%numClientSets], i)
+			err := deleteResource(ctx, clientsets[i%numClientSets], i)
 			if err != nil {
+				if ctx.Err() != nil {
+					// Interrupted mid-request, the delete did not fail
+					return
+				}
+				failed.Add(1)
 				log.Printf("Error handling resource %d: %v", i, err)
+				return
 			}
+			deleted.Add(1)
 		}()
 	}
 
 	// Wait for all goroutines to finish
 	wg.Wait()
-	fmt.Println("All resources deleted.")
+	if ctx.Err() != nil {
+		fmt.Printf("Interrupted. %d resources deleted, %d failed.\n", deleted.Load(), failed.Load())
+		os.Exit(1)
+	}
+	fmt.Printf("All resources deleted. %d deleted, %d failed.\n", deleted.Load(), failed.Load())
 }
 
-func deleteResource(clientset *kubernetes.Clientset, index int) error {
+func deleteResource(ctx context.Context, clientset *kubernetes.Clientset, index int) error {
 	resourceName := fmt.Sprintf("res-%d", index)
 
 	fmt.Printf("Creating %s...\n", resourceName)
-	err := clientset.CoreV1().Pods(metav1.NamespaceDefault).Delete(context.TODO(), resourceName, metav1.DeleteOptions{})
+	err := util.Retry(ctx, util.DefaultAttempts, func() error {
+		return clientset.CoreV1().Pods(metav1.NamespaceDefault).Delete(ctx, resourceName, metav1.DeleteOptions{})
+	})
 	if err != nil {
 		return err
 	} else {
@@ -21,28 +21,75 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"bchess.org/util"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/flowcontrol"
 )
 
-var numClientSets = 10
+// defaultClientSets is the number of clientsets nodes are created through unless -clientsets is set
+const defaultClientSets = 10
 
-func getSchedulerPods(clientset *kubernetes.Clientset) ([]string, error) {
+// stringsFlag collects every value of a repeatable flag
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// mapFlag collects every key=value of a repeatable flag. A later value for the same key wins
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	kvs := make([]string, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func (m mapFlag) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid %q, expected key=value", value)
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("invalid key %q: %s", key, strings.Join(errs, "; "))
+	}
+	m[key] = v
+	return nil
+}
+
+// schedulerLabel assigns a node to a scheduler
+const schedulerLabel = "dist-scheduler.dev/scheduler"
+
+func getSchedulerPods(ctx context.Context, clientset *kubernetes.Clientset) ([]string, error) {
 	selector := labels.Set{
 		"app":  "dist-scheduler",
 		"role": "scheduler",
 	}.AsSelector()
 
-	pods, err := clientset.CoreV1().Pods("kube-system").List(context.TODO(), metav1.ListOptions{
+	pods, err := clientset.CoreV1().Pods("kube-system").List(ctx, metav1.ListOptions{
 		LabelSelector: selector.String(),
 	})
 	if err != nil {
@@ -62,58 +109,208 @@ func main() {
 	numNodes := flag.Int("count", 1, "Number of nodes to create")
 	kubeconfig := flag.String("kubeconfig", "", "Path to the kubeconfig file (optional)")
 	ppn := flag.Int("podsPerNode", 32, "Pod capacity per node")
+	cpu := flag.String("cpu", "32", "CPU capacity per node, as a resource quantity")
+	memory := flag.String("memory", "256Gi", "Memory capacity per node, as a resource quantity")
 	perKwokGroup := flag.Int("perKwokGroup", 10000, "Nodes per kwok group")
+	topologySpec := flag.String("topology", "", "Lay nodes out across regions and zones with an instance-type label, e.g. regions=3,zones-per-region=3,nodes-per-zone=1000. Defaults --count to the total (optional)")
+	rate := flag.Float64("rate", 0, "Create at most this many nodes per second, to grow the cluster gradually. 0 creates them as fast as possible")
+	burst := flag.Int("burst", 1, "With -rate, how many nodes can be created at once after an idle period (token bucket size)")
+	maxRetries := flag.Int("max-retries", util.DefaultAttempts-1, "Retry creating a node up to this many times, with exponential backoff, when the apiserver throttles or times out the request or the connection fails. 0 disables")
+	numClientSets := flag.Int("clientsets", defaultClientSets, "Number of clientsets to create nodes through. Up to 100 nodes are created at once per clientset")
+	var finalizers stringsFlag
+	flag.Var(&finalizers, "finalizer", "Add this finalizer to every node. Repeatable. None by default; use wrangler.cattle.io/node for the previous Rancher behavior")
+	extraLabels, extraAnnotations := mapFlag{}, mapFlag{}
+	flag.Var(extraLabels, "label", "Add this key=value label to every node, e.g. topology.kubernetes.io/zone=zone-a. Repeatable. Overrides the built-in labels of the same key")
+	flag.Var(extraAnnotations, "annotation", "Add this key=value annotation to every node. Repeatable. Overrides the built-in annotations of the same key")
+	dryRun := flag.Bool("dry-run", false, "Print the nodes that would be created, with their key fields, instead of creating them")
+	allowOverride := flag.Bool("allow-override", false, "Let -label set "+schedulerLabel+", which otherwise spreads the nodes across the scheduler pods")
 	flag.Parse()
 
+	if *rate < 0 {
+		log.Fatalf("-rate must not be negative")
+	}
+	if *burst < 1 {
+		log.Fatalf("-burst must be at least 1")
+	}
+	if *maxRetries < 0 {
+		log.Fatalf("-max-retries must not be negative")
+	}
+	if *numClientSets < 1 {
+		log.Fatalf("-clientsets must be at least 1")
+	}
+	for key, value := range extraLabels {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			log.Fatalf("-label %s has an invalid value %q: %s", key, value, strings.Join(errs, "; "))
+		}
+	}
+	if _, ok := extraLabels[schedulerLabel]; ok && !*allowOverride {
+		log.Fatalf("-label %s would override the scheduler assignment; pass -allow-override to do it anyway", schedulerLabel)
+	}
+	// Parse up front so a typo fails before any node is created
+	resources, err := nodeResources(*cpu, *memory, *ppn)
+	if err != nil {
+		log.Fatalf("Error parsing node resources: %v", err)
+	}
+
+	var topo *topology
+	if *topologySpec != "" {
+		var err error
+		topo, err = parseTopology(*topologySpec)
+		if err != nil {
+			log.Fatalf("Error parsing --topology: %v", err)
+		}
+		countSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "count" {
+				countSet = true
+			}
+		})
+		if !countSet {
+			*numNodes = topo.totalNodes()
+		} else if *numNodes > topo.totalNodes() {
+			log.Fatalf("--count %d exceeds the %d nodes in --topology", *numNodes, topo.totalNodes())
+		}
+		topo.printSummary(*skip, *numNodes)
+	}
+
 	config, err := buildConfig(*kubeconfig)
 	if err != nil {
 		log.Fatalf("Error building kubeconfig: %v", err)
 	}
 	config.RateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
 
-	clientsets := make([]*kubernetes.Clientset, numClientSets)
-	for i := 0; i < numClientSets; i++ {
+	clientsets := make([]*kubernetes.Clientset, *numClientSets)
+	for i := 0; i < *numClientSets; i++ {
 		clientsets[i], err = kubernetes.NewForConfig(config)
 		if err != nil {
 			log.Fatalf("Error creating Kubernetes client: %v", err)
 		}
 	}
 
+	ctx, stop := util.SignalContext()
+	defer stop()
+
 	// Get scheduler pods using the first clientset
-	schedulerPodNames, err := getSchedulerPods(clientsets[0])
+	schedulerPodNames, err := getSchedulerPods(ctx, clientsets[0])
 	if err != nil {
 		log.Printf("Error getting scheduler pods: %v\n", err)
 	}
 
-	// Limit concurrency to 100
-	sem := make(chan struct{}, 100*numClientSets)
+	// Limit concurrency to 100 per clientset
+	sem := make(chan struct{}, 100*len(clientsets))
 
 	// WaitGroup to wait for all creations
 	var wg sync.WaitGroup
-	wg.Add(*numNodes - *skip)
+	var created, failed atomic.Int64
 
-	podsPerNode := resource.MustParse(fmt.Sprintf("%d", *ppn))
+	var limiter flowcontrol.RateLimiter
+	if *rate > 0 {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(float32(*rate), *burst)
+		defer limiter.Stop()
+	}
+	start := time.Now()
+	reportCtx, stopReport := context.WithCancel(ctx)
+	go reportRate(reportCtx, &created, &failed)
 
 	for i := *skip; i < *numNodes; i++ {
 		i := i
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
 		// Acquire a token
-		sem <- struct{}{}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer func() { <-sem }()
-			err := createNode(clientsets[i%numClientSets], i, *perKwokGroup, podsPerNode, schedulerPodNames)
+			err := createNode(ctx, clientsets[i%len(clientsets)], i, *perKwokGroup, resources, schedulerPodNames, topo, finalizers, extraLabels, extraAnnotations, *maxRetries+1, *dryRun)
 			if err != nil {
+				if ctx.Err() != nil {
+					// Interrupted mid-request, the node did not fail
+					return
+				}
+				failed.Add(1)
 				log.Printf("Error handling node %d: %v", i, err)
+				return
 			}
+			created.Add(1)
 		}()
 	}
 
 	// Wait for all goroutines to finish
 	wg.Wait()
-	fmt.Println("All nodes created.")
+	stopReport()
+	elapsed := time.Since(start)
+	if *dryRun && ctx.Err() == nil {
+		fmt.Printf("Dry run. %d nodes would have been created.\n", created.Load())
+		return
+	}
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted.")
+	} else {
+		fmt.Println("All nodes created.")
+	}
+	printSummary(created.Load(), failed.Load(), elapsed)
+	if ctx.Err() != nil {
+		os.Exit(1)
+	}
+}
+
+// printSummary prints the totals for the run, for benchmarking
+func printSummary(created int64, failed int64, elapsed time.Duration) {
+	fmt.Printf("Attempted: %d\n", created+failed)
+	fmt.Printf("Succeeded: %d\n", created)
+	fmt.Printf("Failed:    %d\n", failed)
+	fmt.Printf("Elapsed:   %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("Rate:      %.1f nodes/s\n", float64(created)/elapsed.Seconds())
+}
+
+// reportRate prints how many nodes were created in each second, and the running totals, until ctx is done
+func reportRate(ctx context.Context, created *atomic.Int64, failed *atomic.Int64) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := created.Load()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := created.Load()
+		fmt.Printf("%d nodes/s, %d created, %d failed.\n", now-last, now, failed.Load())
+		last = now
+	}
+}
+
+// nodeResources is the capacity, and allocatable, of every node
+func nodeResources(cpu string, memory string, podsPerNode int) (corev1.ResourceList, error) {
+	cpuQuantity, err := resource.ParseQuantity(cpu)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -cpu %q: %v", cpu, err)
+	}
+	memoryQuantity, err := resource.ParseQuantity(memory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -memory %q: %v", memory, err)
+	}
+	if podsPerNode < 1 {
+		return nil, fmt.Errorf("-podsPerNode must be at least 1")
+	}
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    cpuQuantity,
+		corev1.ResourceMemory: memoryQuantity,
+		corev1.ResourcePods:   *resource.NewQuantity(int64(podsPerNode), resource.DecimalSI),
+	}, nil
 }
 
-func createNode(clientset *kubernetes.Clientset, index int, perKwokGroup int, podsPerNode resource.Quantity, schedulerPodNames []string) error {
+func createNode(ctx context.Context, clientset *kubernetes.Clientset, index int, perKwokGroup int, resources corev1.ResourceList, schedulerPodNames []string, topo *topology, finalizers []string, extraLabels map[string]string, extraAnnotations map[string]string, attempts int, dryRun bool) error {
 	nodeName := fmt.Sprintf("kwok-node-%d", index)
 
 	// This is optional but will speed up a test so that the nodes already have the scheduler label assigned
@@ -140,11 +337,9 @@ func createNode(clientset *kubernetes.Clientset, index int, perKwokGroup int, po
 				"node-role.kubernetes.io/agent": "",
 				"type":                          "kwok",
 				"kwok-group":                    strconv.Itoa(index / perKwokGroup),
-				"dist-scheduler.dev/scheduler":  schedulerName,
-			},
-			Finalizers: []string{
-				"wrangler.cattle.io/node",
+				schedulerLabel:                  schedulerName,
 			},
+			Finalizers: finalizers,
 		},
 		Spec: corev1.NodeSpec{
 			Taints: []corev1.Taint{
@@ -156,16 +351,8 @@ func createNode(clientset *kubernetes.Clientset, index int, perKwokGroup int, po
 			},
 		},
 		Status: corev1.NodeStatus{
-			Allocatable: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("32"),
-				corev1.ResourceMemory: resource.MustParse("256Gi"),
-				corev1.ResourcePods:   podsPerNode,
-			},
-			Capacity: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("32"),
-				corev1.ResourceMemory: resource.MustParse("256Gi"),
-				corev1.ResourcePods:   podsPerNode,
-			},
+			Allocatable: resources.DeepCopy(),
+			Capacity:    resources.DeepCopy(),
 			NodeInfo: corev1.NodeSystemInfo{
 				Architecture:            "amd64",
 				BootID:                  "",
@@ -181,8 +368,34 @@ func createNode(clientset *kubernetes.Clientset, index int, perKwokGroup int, po
 		},
 	}
 
+	if topo != nil {
+		for k, v := range topo.labels(index) {
+			node.Labels[k] = v
+		}
+	}
+	for k, v := range extraLabels {
+		node.Labels[k] = v
+	}
+	for k, v := range extraAnnotations {
+		node.Annotations[k] = v
+	}
+
+	if dryRun {
+		fmt.Printf("Would create node %s\n", describeNode(node))
+		return nil
+	}
+
 	fmt.Printf("Creating node %s...\n", nodeName)
-	_, err := clientset.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{})
+	tried := false
+	err := util.Retry(ctx, attempts, func() error {
+		_, err := clientset.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{})
+		if tried && apierrors.IsAlreadyExists(err) {
+			// An earlier attempt that timed out or lost its connection went through after all
+			return nil
+		}
+		tried = true
+		return err
+	})
 	if err != nil {
 		return err
 	} else {
@@ -227,6 +440,22 @@ func createNode(clientset *kubernetes.Clientset, index int, perKwokGroup int, po
 	return nil
 }
 
+// describeNode is the name and the fields of node that the flags control, for -dry-run
+func describeNode(node *corev1.Node) string {
+	capacity := node.Status.Capacity
+	desc := fmt.Sprintf("%s: scheduler=%s kwok-group=%s capacity=cpu:%s,memory:%s,pods:%s",
+		node.Name, node.Labels[schedulerLabel], node.Labels["kwok-group"], capacity.Cpu(), capacity.Memory(), capacity.Pods())
+	for _, key := range []string{corev1.LabelTopologyRegion, corev1.LabelTopologyZone, corev1.LabelInstanceTypeStable} {
+		if value, ok := node.Labels[key]; ok {
+			desc += fmt.Sprintf(" %s=%s", key, value)
+		}
+	}
+	if len(node.Finalizers) > 0 {
+		desc += fmt.Sprintf(" finalizers=%s", strings.Join(node.Finalizers, ","))
+	}
+	return desc
+}
+
 func buildConfig(kubeconfig string) (*rest.Config, error) {
 	if kubeconfig != "" {
 		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
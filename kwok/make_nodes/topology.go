@@ -0,0 +1,108 @@
+/*
+Copyright 2025 Benjamin Chess
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// instanceTypes are cycled through within each zone so every zone has a mix
+var instanceTypes = []string{"kwok.small", "kwok.medium", "kwok.large"}
+
+// topology lays nodes out across regions and zones, filling one zone before moving to the next
+type topology struct {
+	regions        int
+	zonesPerRegion int
+	nodesPerZone   int
+}
+
+// parseTopology parses a spec like "regions=3,zones-per-region=3,nodes-per-zone=1000"
+func parseTopology(spec string) (*topology, error) {
+	t := &topology{regions: 1, zonesPerRegion: 1}
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid topology entry %q, expected key=value", kv)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid topology value for %s: %q", key, value)
+		}
+		switch key {
+		case "regions":
+			t.regions = n
+		case "zones-per-region":
+			t.zonesPerRegion = n
+		case "nodes-per-zone":
+			t.nodesPerZone = n
+		default:
+			return nil, fmt.Errorf("unknown topology key %q", key)
+		}
+	}
+	if t.nodesPerZone == 0 {
+		return nil, fmt.Errorf("topology requires nodes-per-zone")
+	}
+	return t, nil
+}
+
+func (t *topology) totalNodes() int {
+	return t.regions * t.zonesPerRegion * t.nodesPerZone
+}
+
+// labels returns the region, zone and instance-type labels for the node at index
+func (t *topology) labels(index int) map[string]string {
+	zoneIndex := index / t.nodesPerZone
+	region := fmt.Sprintf("region-%d", zoneIndex/t.zonesPerRegion)
+	return map[string]string{
+		corev1.LabelTopologyRegion:     region,
+		corev1.LabelTopologyZone:       fmt.Sprintf("%s-zone-%d", region, zoneIndex%t.zonesPerRegion),
+		corev1.LabelInstanceTypeStable: instanceTypes[index%len(instanceTypes)],
+	}
+}
+
+// printSummary prints the node count per region, zone and instance type for nodes [skip, count)
+func (t *topology) printSummary(skip, count int) {
+	fmt.Printf("Topology: %d regions x %d zones-per-region x %d nodes-per-zone\n", t.regions, t.zonesPerRegion, t.nodesPerZone)
+	for r := 0; r < t.regions; r++ {
+		for z := 0; z < t.zonesPerRegion; z++ {
+			zoneIndex := r*t.zonesPerRegion + z
+			start := max(zoneIndex*t.nodesPerZone, skip)
+			end := min((zoneIndex+1)*t.nodesPerZone, count)
+			if start >= end {
+				continue
+			}
+			perType := make([]string, len(instanceTypes))
+			for i, it := range instanceTypes {
+				// nodes in [start, end) whose index % len(instanceTypes) == i
+				n := countCongruent(end, i, len(instanceTypes)) - countCongruent(start, i, len(instanceTypes))
+				perType[i] = fmt.Sprintf("%s=%d", it, n)
+			}
+			fmt.Printf("  region-%d-zone-%d: %d nodes (%s)\n", r, z, end-start, strings.Join(perType, ", "))
+		}
+	}
+}
+
+// countCongruent returns how many of [0, n) are congruent to r modulo m
+func countCongruent(n, r, m int) int {
+	if n <= r {
+		return 0
+	}
+	return (n-r-1)/m + 1
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 Benjamin Chess
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// daemonSetNodeLabel records the node a -daemonset pod must land on, so verify can find them
+const daemonSetNodeLabel = "make-pods/daemonset-node"
+
+// daemonSet places pod i on node <nodePrefix><firstNode+i>, like a DaemonSet would place one pod per node.
+// With dist-scheduler each node is owned by one sub-scheduler, so only that sub-scheduler can place the pod.
+// Every other sub-scheduler filters out all of its nodes and reports no viable node.
+type daemonSet struct {
+	nodePrefix string
+	firstNode  int
+}
+
+func (d *daemonSet) nodeName(index int) string {
+	return fmt.Sprintf("%s%d", d.nodePrefix, d.firstNode+index)
+}
+
+// apply pins the pod to its node with a required nodeAffinity on the hostname label
+func (d *daemonSet) apply(pod *corev1.Pod, index int) {
+	nodeName := d.nodeName(index)
+	pod.Labels[daemonSetNodeLabel] = nodeName
+	pod.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      corev1.LabelHostname,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{nodeName},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// verify waits up to timeout for every -daemonset pod to be bound, then reports how many landed on their target node.
+// Returns false if any pod is unbound or on another node.
+func (d *daemonSet) verify(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string, want int, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		pods, err := listPods(ctx, clientset, namespaces, daemonSetNodeLabel)
+		if err != nil {
+			return false, fmt.Errorf("error listing daemonset pods: %w", err)
+		}
+		onTarget, unbound := 0, 0
+		var misplaced []corev1.Pod
+		for _, pod := range pods {
+			switch pod.Spec.NodeName {
+			case "":
+				unbound++
+			case pod.Labels[daemonSetNodeLabel]:
+				onTarget++
+			default:
+				misplaced = append(misplaced, pod)
+			}
+		}
+		missing := max(want-len(pods), 0)
+		done := unbound == 0 && missing == 0
+		if done || time.Now().After(deadline) || ctx.Err() != nil {
+			for _, pod := range misplaced {
+				fmt.Printf("%s landed on %s, want %s\n", pod.Name, pod.Spec.NodeName, pod.Labels[daemonSetNodeLabel])
+			}
+			fmt.Printf("Daemonset verification: %d on target node, %d on another node, %d unbound, %d missing.\n", onTarget, len(misplaced), unbound, missing)
+			return done && len(misplaced) == 0, nil
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -23,10 +23,15 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"bchess.org/util"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -42,10 +47,94 @@ func main() {
 	numResources := flag.Int("count", 1, "Number of resources to create")
 	kubeconfig := flag.String("kubeconfig", "", "Path to the kubeconfig file (optional)")
 	schedulerName := flag.String("scheduler-name", "dist-scheduler", "schedulerName. Default dist-scheduler")
+	numContainers := flag.Int("containers", 1, "Number of containers per pod")
+	numInitContainers := flag.Int("init-containers", 0, "Number of init containers per pod")
+	image := flag.String("image", defaultImage, "Image of every container. kwok never pulls it, but a real node, or an admission webhook, might")
+	command := flag.String("command", strings.Join(defaultCommand, ","), "Comma-separated command of every container and -sidecar. Init containers run true")
+	sidecar := flag.Bool("sidecar", false, "Add a native sidecar (init container with restartPolicy: Always) to each pod")
+	cpuRequest := flag.String("cpu-request", "", "CPU request for each container, e.g. 100m (optional)")
+	memoryRequest := flag.String("memory-request", "", "Memory request for each container, e.g. 64Mi (optional)")
+	// On kwok nothing actually provisions or mounts storage, but the scheduler's VolumeBinding plugin still runs its logic
+	pvcName := flag.String("pvc", "", "Mount this existing PersistentVolumeClaim in every pod (optional)")
+	pvcPerPod := flag.Bool("pvc-per-pod", false, "Create a PersistentVolumeClaim <pod>-data before each pod and mount it")
+	storageClass := flag.String("storage-class", "", "StorageClass for -pvc-per-pod claims (optional, uses the cluster default)")
+	pvcSize := flag.String("pvc-size", "1Gi", "Requested size of -pvc-per-pod claims")
+	configMapName := flag.String("configmap", "", "Mount this ConfigMap in every pod (optional, not created)")
+	secretName := flag.String("secret", "", "Mount this Secret in every pod (optional, not created)")
+	daemonSetMode := flag.Bool("daemonset", false, "Pin pod N to node <node-prefix><first-node+N> with a required nodeAffinity, one pod per node like a DaemonSet")
+	nodePrefix := flag.String("node-prefix", "kwok-node-", "Node name prefix for -daemonset")
+	firstNode := flag.Int("first-node", 0, "Index of the node that pod 0 targets with -daemonset")
+	spreadTopologyKey := flag.String("spread-topology-key", "", "Add a topologySpreadConstraint over this node label, e.g. topology.kubernetes.io/zone, selecting every pod by its app label (optional)")
+	spreadMaxSkew := flag.Int("spread-max-skew", 1, "maxSkew of the -spread-topology-key constraint")
+	spreadWhenUnsatisfiable := flag.String("spread-when-unsatisfiable", string(corev1.DoNotSchedule), "whenUnsatisfiable of the -spread-topology-key constraint: DoNotSchedule or ScheduleAnyway")
+	verifyTimeout := flag.Duration("verify-timeout", time.Minute, "With -daemonset or -spread-topology-key, how long to wait for every pod to be bound before checking where they landed. 0 skips the check")
+	numNamespaces := flag.Int("namespaces", 0, "Spread the pods over this many namespaces, res-ns-0 and up, creating them if needed. Pod i goes into res-ns-<i % N>. 0 puts every pod in default")
+	dryRun := flag.Bool("dry-run", false, "Print the pods and claims that would be created, with their key fields, instead of creating them")
 	flag.Parse()
 
 	errlog := log.New(os.Stderr, "", log.LstdFlags)
 
+	if *numContainers < 1 {
+		log.Fatalf("-containers must be at least 1")
+	}
+	if *numNamespaces < 0 {
+		log.Fatalf("-namespaces must not be negative")
+	}
+	if *image == "" {
+		log.Fatalf("-image must not be empty")
+	}
+	if *command == "" {
+		log.Fatalf("-command must not be empty")
+	}
+	requests := corev1.ResourceList{}
+	if *cpuRequest != "" {
+		q, err := resource.ParseQuantity(*cpuRequest)
+		if err != nil {
+			log.Fatalf("Invalid -cpu-request: %v", err)
+		}
+		requests[corev1.ResourceCPU] = q
+	}
+	if *memoryRequest != "" {
+		q, err := resource.ParseQuantity(*memoryRequest)
+		if err != nil {
+			log.Fatalf("Invalid -memory-request: %v", err)
+		}
+		requests[corev1.ResourceMemory] = q
+	}
+	if *pvcName != "" && *pvcPerPod {
+		log.Fatalf("-pvc and -pvc-per-pod are mutually exclusive")
+	}
+	volumes := podVolumes{
+		pvcName:       *pvcName,
+		pvcPerPod:     *pvcPerPod,
+		configMapName: *configMapName,
+		secretName:    *secretName,
+	}
+	if *pvcPerPod {
+		q, err := resource.ParseQuantity(*pvcSize)
+		if err != nil {
+			log.Fatalf("Invalid -pvc-size: %v", err)
+		}
+		volumes.pvcSize = q
+		if *storageClass != "" {
+			volumes.storageClass = storageClass
+		}
+	}
+	var ds *daemonSet
+	if *daemonSetMode {
+		ds = &daemonSet{nodePrefix: *nodePrefix, firstNode: *firstNode}
+	}
+	podSpec := newPodSpec(*schedulerName, *image, strings.Split(*command, ","), *numContainers, *numInitContainers, *sidecar, requests, volumes)
+	var spread *topologySpread
+	if *spreadTopologyKey != "" {
+		var err error
+		spread, err = newTopologySpread(*spreadTopologyKey, *spreadMaxSkew, *spreadWhenUnsatisfiable)
+		if err != nil {
+			log.Fatalf("Invalid -spread-topology-key constraint: %v", err)
+		}
+		spread.apply(podSpec)
+	}
+
 	config, err := buildConfig(*kubeconfig)
 	if err != nil {
 		log.Fatalf("Error building kubeconfig: %v", err)
@@ -64,111 +153,396 @@ func main() {
 		}
 	}
 
-	// WaitGroup to wait for all creations
-	var wg sync.WaitGroup
-	wg.Add(*numResources - *skip)
+	ctx, stop := util.SignalContext()
+	defer stop()
+
+	namespaces := []string{metav1.NamespaceDefault}
+	if *numNamespaces > 0 {
+		namespaces = namespaceNames(*numNamespaces)
+		if err := createNamespaces(ctx, clientsets[0], namespaces, *dryRun); err != nil && ctx.Err() == nil {
+			errlog.Fatalf("Error creating namespaces: %v", err)
+		}
+	}
 
-	ownerUid := types.UID("")
+	var created, failed atomic.Int64
+
+	// The first pod in each namespace owns the rest of the pods in it, as owner references can't cross namespaces.
+	// With -skip the owners are not recreated, so the pods get no owner.
+	ownerUids := make([]types.UID, len(namespaces))
+	first := *skip
 	if *skip == 0 {
-		ownerUid, err = createResource(clientsets[0%numClientSets], 0, ownerUid, *schedulerName)
-		if err != nil {
-			errlog.Fatalf("Error creating resource: %v", err)
+		for i := 0; i < min(len(namespaces), *numResources); i++ {
+			ownerUids[i], err = createResource(ctx, clientsets[i%numClientSets], i, namespaces[i], "", "", podSpec, volumes, ds, *dryRun)
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				errlog.Fatalf("Error creating resource: %v", err)
+			}
+			created.Add(1)
 		}
-		*skip = 1
-		wg.Done()
+		first = len(namespaces)
 	}
 
-	start := int32(*skip) - 1
-	end := int32(*skip+*numResources) - 1
+	start := int32(first) - 1
+	end := int32(*skip + *numResources)
+
+	// WaitGroup to wait for all workers
+	var wg sync.WaitGroup
 
 	// Create worker pool
 	numWorkers := 100 * numClientSets
 	for w := 0; w < numWorkers; w++ {
 		// log.Printf("Creating worker %d clientset %d", w, (w % numClientSets))
+		wg.Add(1)
 		go func(ww int) {
+			defer wg.Done()
 			cs := clientsets[ww%numClientSets]
-			for {
+			for ctx.Err() == nil {
 				i := atomic.AddInt32(&start, 1)
 				if i >= end {
 					break
 				}
-				_, err := createResource(cs, int(i), ownerUid, *schedulerName)
+				ns := int(i) % len(namespaces)
+				_, err := createResource(ctx, cs, int(i), namespaces[ns], resourceName(ns), ownerUids[ns], podSpec, volumes, ds, *dryRun)
 				if err != nil {
+					if ctx.Err() != nil {
+						// Interrupted mid-request, the resource did not fail
+						break
+					}
+					failed.Add(1)
 					errlog.Printf("Error handling resource %d: %v", i, err)
+					continue
 				}
-				wg.Done()
+				created.Add(1)
 			}
 		}(w)
 	}
 
 	// Wait for all work to complete
 	wg.Wait()
-	fmt.Println("All resources created.")
+	if ctx.Err() != nil {
+		fmt.Printf("Interrupted. %d resources created, %d failed.\n", created.Load(), failed.Load())
+		os.Exit(1)
+	}
+	if *dryRun {
+		fmt.Printf("Dry run. %d resources would have been created.\n", created.Load())
+		return
+	}
+	fmt.Printf("All resources created. %d created, %d failed.\n", created.Load(), failed.Load())
+
+	if ds != nil && *verifyTimeout > 0 {
+		ok, err := ds.verify(ctx, clientsets[0], namespaces, int(created.Load()), *verifyTimeout)
+		if err != nil {
+			errlog.Fatalf("Error verifying daemonset pods: %v", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	}
+	if spread != nil && *verifyTimeout > 0 {
+		if err := spread.report(ctx, clientsets[0], namespaces, *verifyTimeout); err != nil {
+			errlog.Fatalf("Error reporting topology spread: %v", err)
+		}
+	}
 }
 
-func createResource(clientset *kubernetes.Clientset, index int, uid types.UID, schedulerName string) (types.UID, error) {
-	resourceName := fmt.Sprintf("res-%d", index)
-	pod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: resourceName,
-			Labels: map[string]string{
-				"app": "busybox",
+// podVolumes describes the volumes mounted into the first container of every pod
+type podVolumes struct {
+	pvcName       string
+	pvcPerPod     bool
+	storageClass  *string
+	pvcSize       resource.Quantity
+	configMapName string
+	secretName    string
+}
+
+// pvcVolumeName is the name of the PVC volume in the pod spec, whose claim is filled in per pod with -pvc-per-pod
+const pvcVolumeName = "data"
+
+// defaultImage and defaultCommand are what every container runs unless -image and -command are set
+const defaultImage = "gcr.io/google-containers/busybox"
+
+var defaultCommand = []string{"sleep", "99999"}
+
+// newPodSpec builds the spec shared by every created pod. Each container gets the same requests,
+// so the pod's aggregate request scales with the number of containers.
+func newPodSpec(schedulerName string, image string, command []string, numContainers int, numInitContainers int, sidecar bool, requests corev1.ResourceList, volumes podVolumes) *corev1.PodSpec {
+	newContainer := func(name string, command ...string) corev1.Container {
+		return corev1.Container{
+			Name:            name,
+			Image:           image,
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Command:         command,
+			Resources: corev1.ResourceRequirements{
+				Requests: requests.DeepCopy(),
+			},
+		}
+	}
+
+	spec := &corev1.PodSpec{
+		SchedulerName:                 schedulerName,
+		TerminationGracePeriodSeconds: &[]int64{1}[0],
+		Tolerations: []corev1.Toleration{
+			{
+				Key:      "kwok.x-k8s.io/node",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			},
+			{
+				Key:      "node.kubernetes.io/not-ready",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			},
+			{
+				Key:      "node.kubernetes.io/not-ready",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoExecute,
 			},
 		},
-		Spec: corev1.PodSpec{
-			SchedulerName:                 schedulerName,
-			TerminationGracePeriodSeconds: &[]int64{1}[0],
-			Tolerations: []corev1.Toleration{
-				{
-					Key:      "kwok.x-k8s.io/node",
-					Operator: corev1.TolerationOpExists,
-					Effect:   corev1.TaintEffectNoSchedule,
-				},
-				{
-					Key:      "node.kubernetes.io/not-ready",
-					Operator: corev1.TolerationOpExists,
-					Effect:   corev1.TaintEffectNoSchedule,
-				},
-				{
-					Key:      "node.kubernetes.io/not-ready",
-					Operator: corev1.TolerationOpExists,
-					Effect:   corev1.TaintEffectNoExecute,
+	}
+
+	for i := 0; i < numInitContainers; i++ {
+		spec.InitContainers = append(spec.InitContainers, newContainer(fmt.Sprintf("busybox-init-%d", i), "true"))
+	}
+	if sidecar {
+		c := newContainer("sidecar", command...)
+		c.RestartPolicy = &[]corev1.ContainerRestartPolicy{corev1.ContainerRestartPolicyAlways}[0]
+		spec.InitContainers = append(spec.InitContainers, c)
+	}
+	for i := 0; i < numContainers; i++ {
+		name := "busybox"
+		if i > 0 {
+			name = fmt.Sprintf("busybox-%d", i)
+		}
+		spec.Containers = append(spec.Containers, newContainer(name, command...))
+	}
+
+	addVolume := func(v corev1.Volume, mountPath string) {
+		spec.Volumes = append(spec.Volumes, v)
+		spec.Containers[0].VolumeMounts = append(spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      v.Name,
+			MountPath: mountPath,
+		})
+	}
+	if volumes.pvcName != "" || volumes.pvcPerPod {
+		addVolume(corev1.Volume{
+			Name: pvcVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: volumes.pvcName},
+			},
+		}, "/data")
+	}
+	if volumes.configMapName != "" {
+		addVolume(corev1.Volume{
+			Name: "config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: volumes.configMapName},
 				},
 			},
-			Containers: []corev1.Container{
-				{
-					Name:            "busybox",
-					Image:           "gcr.io/google-containers/busybox",
-					ImagePullPolicy: corev1.PullIfNotPresent,
-					Command: []string{
-						"sleep",
-						"99999",
-					},
+		}, "/config")
+	}
+	if volumes.secretName != "" {
+		addVolume(corev1.Volume{
+			Name: "secret",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: volumes.secretName},
+			},
+		}, "/secret")
+	}
+	return spec
+}
+
+// namespaceNames are the names of the -namespaces
+func namespaceNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("res-ns-%d", i)
+	}
+	return names
+}
+
+// createNamespaces creates the namespaces that don't exist yet
+func createNamespaces(ctx context.Context, clientset *kubernetes.Clientset, names []string, dryRun bool) error {
+	for _, name := range names {
+		if dryRun {
+			fmt.Printf("Would create namespace %s\n", name)
+			continue
+		}
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		err := util.Retry(ctx, util.DefaultAttempts, func() error {
+			_, err := clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error creating namespace %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// listPods lists the pods matching selector in every namespace
+func listPods(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string, selector string) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	for _, namespace := range namespaces {
+		list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, list.Items...)
+	}
+	return pods, nil
+}
+
+// createPVC creates the per-pod claim for podName and returns its name
+func createPVC(ctx context.Context, clientset *kubernetes.Clientset, namespace string, podName string, volumes podVolumes, dryRun bool) (string, error) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName + "-data",
+			Namespace: namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: volumes.storageClass,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: volumes.pvcSize,
 				},
 			},
 		},
 	}
-	if index != 0 && uid != "" {
+	if dryRun {
+		fmt.Printf("Would create PVC %s/%s: size=%s storageClass=%s\n", namespace, pvc.Name, volumes.pvcSize.String(), ptrString(volumes.storageClass, "<default>"))
+		return pvc.Name, nil
+	}
+	tried := false
+	err := util.Retry(ctx, util.DefaultAttempts, func() error {
+		created, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
+		if tried && apierrors.IsAlreadyExists(err) {
+			// An earlier attempt that timed out or lost its connection went through after all
+			return nil
+		}
+		tried = true
+		if err == nil {
+			pvc = created
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating PVC for %s: %w", podName, err)
+	}
+	return pvc.Name, nil
+}
+
+// podAppLabel is the app label of every created pod
+const podAppLabel = "busybox"
+
+// dryRunUID stands in for the UID of the owner pods with -dry-run, so the owner references of the other pods still show
+const dryRunUID = types.UID("dry-run")
+
+func resourceName(index int) string {
+	return fmt.Sprintf("res-%d", index)
+}
+
+// createResource creates pod index in namespace and returns its UID. Unless ownerUid is empty, the pod is owned by
+// pod ownerName, which must be in the same namespace.
+func createResource(ctx context.Context, clientset *kubernetes.Clientset, index int, namespace string, ownerName string, ownerUid types.UID, podSpec *corev1.PodSpec, volumes podVolumes, ds *daemonSet, dryRun bool) (types.UID, error) {
+	resourceName := resourceName(index)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resourceName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": podAppLabel,
+			},
+		},
+		Spec: *podSpec.DeepCopy(),
+	}
+	if ds != nil {
+		ds.apply(pod, index)
+	}
+	if volumes.pvcPerPod {
+		claimName, err := createPVC(ctx, clientset, namespace, resourceName, volumes, dryRun)
+		if err != nil {
+			return "", err
+		}
+		for i := range pod.Spec.Volumes {
+			if pod.Spec.Volumes[i].Name == pvcVolumeName {
+				pod.Spec.Volumes[i].PersistentVolumeClaim.ClaimName = claimName
+			}
+		}
+	}
+	if ownerUid != "" {
 		pod.OwnerReferences = []metav1.OwnerReference{
 			{
 				APIVersion: "v1",
 				Kind:       "Pod",
-				Name:       "res-0",
-				UID:        uid,
+				Name:       ownerName,
+				UID:        ownerUid,
 			},
 		}
 	}
 
-	fmt.Printf("Creating %s...\n", resourceName)
-	pod, err := clientset.CoreV1().Pods(metav1.NamespaceDefault).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if dryRun {
+		fmt.Printf("Would create %s\n", describePod(pod))
+		return dryRunUID, nil
+	}
+
+	fmt.Printf("Creating %s/%s...\n", namespace, resourceName)
+	tried := false
+	err := util.Retry(ctx, util.DefaultAttempts, func() error {
+		created, err := clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if tried && apierrors.IsAlreadyExists(err) {
+			// An earlier attempt that timed out or lost its connection went through after all. Its UID is
+			// needed for the pods it owns
+			created, err = clientset.CoreV1().Pods(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		}
+		tried = true
+		if err == nil {
+			pod = created
+		}
+		return err
+	})
 	if err != nil {
 		return "", err
 	} else {
-		fmt.Printf("%s created successfully.\n", resourceName)
+		fmt.Printf("%s/%s created successfully.\n", namespace, resourceName)
+	}
+
+	return pod.ObjectMeta.UID, nil
+}
+
+// describePod is the name and the fields of pod that the flags control, for -dry-run
+func describePod(pod *corev1.Pod) string {
+	desc := fmt.Sprintf("%s/%s: schedulerName=%s image=%s command=%s containers=%d initContainers=%d", pod.Namespace, pod.Name, pod.Spec.SchedulerName,
+		pod.Spec.Containers[0].Image, strings.Join(pod.Spec.Containers[0].Command, " "), len(pod.Spec.Containers), len(pod.Spec.InitContainers))
+	for _, owner := range pod.OwnerReferences {
+		desc += fmt.Sprintf(" owner=%s/%s(uid=%s)", owner.Kind, owner.Name, owner.UID)
+	}
+	if requests := pod.Spec.Containers[0].Resources.Requests; len(requests) > 0 {
+		desc += fmt.Sprintf(" requests=cpu:%s,memory:%s", requests.Cpu(), requests.Memory())
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil {
+			desc += fmt.Sprintf(" claim=%s", v.PersistentVolumeClaim.ClaimName)
+		}
 	}
+	if node, ok := pod.Labels[daemonSetNodeLabel]; ok {
+		desc += fmt.Sprintf(" node=%s", node)
+	}
+	for _, c := range pod.Spec.TopologySpreadConstraints {
+		desc += fmt.Sprintf(" spread=%s(maxSkew=%d)", c.TopologyKey, c.MaxSkew)
+	}
+	return desc
+}
 
-	uid = pod.ObjectMeta.UID
-	return uid, nil
+// ptrString is *s, or def if s is nil
+func ptrString(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+	return *s
 }
 
 func buildConfig(kubeconfig string) (*rest.Config, error) {
@@ -0,0 +1,135 @@
+/*
+Copyright 2025 Benjamin Chess
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// topologySpread spreads every created pod across the values of topologyKey, counting pods by their app label.
+// With dist-scheduler each sub-scheduler only sees the nodes it owns and the pods it placed itself,
+// so maxSkew is only enforced within each partition. The skew across the whole cluster can be larger.
+type topologySpread struct {
+	topologyKey       string
+	maxSkew           int32
+	whenUnsatisfiable corev1.UnsatisfiableConstraintAction
+}
+
+func newTopologySpread(topologyKey string, maxSkew int, whenUnsatisfiable string) (*topologySpread, error) {
+	if maxSkew < 1 {
+		return nil, fmt.Errorf("max skew must be at least 1")
+	}
+	action := corev1.UnsatisfiableConstraintAction(whenUnsatisfiable)
+	if action != corev1.DoNotSchedule && action != corev1.ScheduleAnyway {
+		return nil, fmt.Errorf("whenUnsatisfiable must be %s or %s", corev1.DoNotSchedule, corev1.ScheduleAnyway)
+	}
+	return &topologySpread{
+		topologyKey:       topologyKey,
+		maxSkew:           int32(maxSkew),
+		whenUnsatisfiable: action,
+	}, nil
+}
+
+func (t *topologySpread) apply(spec *corev1.PodSpec) {
+	spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           t.maxSkew,
+			TopologyKey:       t.topologyKey,
+			WhenUnsatisfiable: t.whenUnsatisfiable,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": podAppLabel},
+			},
+		},
+	}
+}
+
+// report waits up to timeout for every pod in namespaces to be bound, then prints how many landed in each domain and the
+// skew between them. The constraint only applies within a namespace, so with -namespaces the skew is the sum over them
+func (t *topologySpread) report(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string, timeout time.Duration) error {
+	// ResourceVersion 0 is served from the apiserver cache, which matters with a million nodes
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		return fmt.Errorf("error listing nodes: %w", err)
+	}
+	nodeDomains := make(map[string]string, len(nodes.Items))
+	counts := map[string]int{}
+	for _, node := range nodes.Items {
+		if domain, ok := node.Labels[t.topologyKey]; ok {
+			nodeDomains[node.Name] = domain
+			counts[domain] = 0
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	var pods []corev1.Pod
+	unbound := 0
+	for {
+		pods, err = listPods(ctx, clientset, namespaces, "app="+podAppLabel)
+		if err != nil {
+			return fmt.Errorf("error listing pods: %w", err)
+		}
+		unbound = 0
+		for _, pod := range pods {
+			if pod.Spec.NodeName == "" {
+				unbound++
+			}
+		}
+		if unbound == 0 || time.Now().After(deadline) || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+
+	outside := 0
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		domain, ok := nodeDomains[pod.Spec.NodeName]
+		if !ok {
+			outside++
+			continue
+		}
+		counts[domain]++
+	}
+
+	domains := make([]string, 0, len(counts))
+	for domain := range counts {
+		domains = append(domains, domain)
+	}
+	slices.Sort(domains)
+	lowest, highest := 0, 0
+	for i, domain := range domains {
+		if i == 0 || counts[domain] < lowest {
+			lowest = counts[domain]
+		}
+		highest = max(highest, counts[domain])
+		fmt.Printf("%s=%s %d\n", t.topologyKey, domain, counts[domain])
+	}
+	fmt.Printf("Topology spread over %s: %d domains, skew %d (maxSkew %d), %d unbound, %d on nodes without the key.\n",
+		t.topologyKey, len(domains), highest-lowest, t.maxSkew, unbound, outside)
+	return nil
+}
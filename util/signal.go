@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2025 Benjamin Chess
+
+// Package util holds helpers shared by the load tools
+package util
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// SignalContext returns a context that is canceled on SIGINT or SIGTERM, so a tool can stop its workers
+// and print a final summary. A second signal exits immediately with status 1.
+// The returned func stops listening for signals and cancels the context.
+func SignalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	stopped := make(chan struct{})
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-stopped:
+			return
+		}
+		select {
+		case <-c:
+			os.Exit(1)
+		case <-stopped:
+		}
+	}()
+	return ctx, sync.OnceFunc(func() {
+		signal.Stop(c)
+		close(stopped)
+		cancel()
+	})
+}